@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/safety"
+)
+
+// maxPages bounds --paginate so a misbehaving cursor cannot loop forever.
+const maxPages = 100
+
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, and returns the positionals.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runAPI(args []string) {
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud); default from the path")
+	var queries multiFlag
+	fs.Var(&queries, "query", "query parameter k=v (repeatable)")
+	body := fs.String("body", "", "request body: json, @file or @- for stdin")
+	var headers multiFlag
+	fs.Var(&headers, "header", "extra signed cloud header k=v (repeatable)")
+	lang := fs.String("lang", "", "cloud response language (lang header)")
+	paginate := fs.Bool("paginate", false, "follow cloud pagination and print all items")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 2 {
+		fatal(fault.New(fault.Usage, "usage: tuya api <METHOD> <path> [--query k=v] [--body json|@file] [--paginate]"))
+	}
+	method := strings.ToUpper(positional[0])
+	path, query, err := splitAPIPath(positional[1], queries)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	payload, err := readAPIBody(*body)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+
+	be := *backend
+	if be == "" {
+		be = apiBackendFor(path)
+	}
+	cfg, be := loadConfig(*configPath, be)
+	if *lang != "" {
+		cfg.Cloud.Lang = *lang
+	}
+	if len(headers) > 0 {
+		merged := map[string]string{}
+		for k, v := range cfg.Cloud.Headers {
+			merged[k] = v
+		}
+		for _, h := range headers {
+			k, v, ok := strings.Cut(h, "=")
+			if !ok || k == "" {
+				fatal(fault.New(fault.Usage, "--header must be k=v, got %q", h))
+			}
+			merged[k] = v
+		}
+		cfg.Cloud.Headers = merged
+	}
+	if method != "GET" {
+		// The output is always raw JSON, so only a terminal on stdin decides
+		// whether to prompt.
+		guard(cfg, apiAction(cfg, be, method, path, payload), *yes, false)
+	}
+
+	switch be {
+	case "ha":
+		if *paginate {
+			fatal(fault.New(fault.Usage, "--paginate is only supported for the cloud backend"))
+		}
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+		data, err := haClient(cfg).Raw(method, path, payload)
+		if err != nil {
+			fatal(err)
+		}
+		writeRaw(data)
+	case "cloud":
+		client := cloudClient(cfg)
+		if *paginate {
+			items, err := paginateCloud(client, method, path, query, payload)
+			if err != nil {
+				fatal(err)
+			}
+			writeJSON(items)
+			return
+		}
+		res, err := client.Raw(method, path, query, payload)
+		if err != nil {
+			fatal(err)
+		}
+		writeRaw(res)
+	default:
+		fatal(fault.New(fault.Usage, "api not implemented for backend %s", be))
+	}
+}
+
+// apiBackendFor guesses the backend from the path: /api/... is Home
+// Assistant, /v1.0/... and friends are Tuya OpenAPI.
+func apiBackendFor(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/") || path == "/api":
+		return "ha"
+	case strings.HasPrefix(path, "/v"):
+		return "cloud"
+	}
+	return ""
+}
+
+// apiAction describes a raw write for the safety policy. Device paths carry
+// the device and the codes in the body, so device and code rules apply as
+// they do to set; Home Assistant service paths are checked like call.
+func apiAction(cfg *config.Config, be, method, path string, body json.RawMessage) safety.Action {
+	action := safety.Action{Kind: "api", Service: method + " " + path}
+	switch be {
+	case "ha":
+		if rest, ok := strings.CutPrefix(path, "/api/services/"); ok {
+			var data map[string]any
+			json.Unmarshal(body, &data)
+			action = callAction(strings.Replace(strings.Trim(rest, "/"), "/", ".", 1), data)
+			action.Kind = "api"
+		}
+	case "cloud":
+		if id := apiDeviceID(path); id != "" {
+			codes := apiCodes(body)
+			action = cloudAction(cfg, cloudClient(cfg), "api", id, codes...)
+			action.Service = method + " " + path
+		}
+	}
+	return action
+}
+
+// apiDeviceID returns the device a Tuya path acts on, the segment after
+// devices/ or thing/ (/v1.0/iot-03/devices/<id>/commands,
+// /v2.0/cloud/thing/<id>/shadow/properties/issue).
+func apiDeviceID(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "devices" || parts[i] == "thing" {
+			id, _ := url.PathUnescape(parts[i+1])
+			return id
+		}
+	}
+	return ""
+}
+
+// apiCodes returns the DP codes a request body writes: the codes of a
+// commands list, or the keys of a properties object (which the thing model
+// API sends as a JSON string).
+func apiCodes(body json.RawMessage) []string {
+	var req struct {
+		Commands []struct {
+			Code string `json:"code"`
+		} `json:"commands"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return nil
+	}
+	var codes []string
+	for _, c := range req.Commands {
+		if c.Code != "" {
+			codes = append(codes, c.Code)
+		}
+	}
+	props := []byte(req.Properties)
+	var encoded string
+	if json.Unmarshal(props, &encoded) == nil {
+		props = []byte(encoded)
+	}
+	var values map[string]any
+	if json.Unmarshal(props, &values) == nil {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		codes = append(codes, keys...)
+	}
+	return codes
+}
+
+// splitAPIPath separates a query string embedded in path and merges it with
+// --query values.
+func splitAPIPath(raw string, queries []string) (string, url.Values, error) {
+	if !strings.HasPrefix(raw, "/") {
+		raw = "/" + raw
+	}
+	path, rawQuery, _ := strings.Cut(raw, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid query in path: %w", err)
+	}
+	for _, q := range queries {
+		k, v, ok := strings.Cut(q, "=")
+		if !ok || k == "" {
+			return "", nil, fmt.Errorf("--query must be k=v, got %q", q)
+		}
+		query.Add(k, v)
+	}
+	return path, query, nil
+}
+
+func readAPIBody(spec string) (json.RawMessage, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	data := []byte(spec)
+	if name, ok := strings.CutPrefix(spec, "@"); ok {
+		var err error
+		if name == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("--body is not valid JSON")
+	}
+	return json.RawMessage(data), nil
+}
+
+// paginateCloud follows Tuya's cursor styles (has_more with last_row_key or
+// last_id, or page_no/total) and concatenates the listed items.
+func paginateCloud(client *cloud.Client, method, path string, query url.Values, body json.RawMessage) ([]json.RawMessage, error) {
+	var all []json.RawMessage
+	for page := 0; page < maxPages; page++ {
+		res, err := client.Raw(method, path, query, body)
+		if err != nil {
+			return nil, err
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(res, &obj); err != nil {
+			// A bare array is a single page.
+			var items []json.RawMessage
+			if err := json.Unmarshal(res, &items); err != nil {
+				return nil, errors.New("--paginate: result is neither a list nor a page object")
+			}
+			return append(all, items...), nil
+		}
+		items, err := pageItems(obj)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if !nextPage(obj, query, len(all), len(items)) {
+			return all, nil
+		}
+	}
+	return all, fmt.Errorf("--paginate: stopped after %d pages", maxPages)
+}
+
+func pageItems(obj map[string]json.RawMessage) ([]json.RawMessage, error) {
+	for _, key := range []string{"list", "devices", "data", "records", "logs"} {
+		if raw, ok := obj[key]; ok {
+			var items []json.RawMessage
+			if err := json.Unmarshal(raw, &items); err == nil {
+				return items, nil
+			}
+		}
+	}
+	return nil, errors.New("--paginate: no list field in result")
+}
+
+// nextPage updates query for the following page and reports whether there
+// is one.
+func nextPage(obj map[string]json.RawMessage, query url.Values, seen, got int) bool {
+	var hasMore bool
+	json.Unmarshal(obj["has_more"], &hasMore)
+	if hasMore {
+		for _, key := range []string{"last_row_key", "last_id"} {
+			raw := obj[key]
+			var cursor string
+			if json.Unmarshal(raw, &cursor) != nil {
+				// Numeric cursors are passed through verbatim.
+				cursor = strings.TrimSpace(string(raw))
+			}
+			if cursor != "" && cursor != "null" {
+				query.Set(key, cursor)
+				return true
+			}
+		}
+	}
+	var total int
+	if json.Unmarshal(obj["total"], &total) == nil && got > 0 && seen < total {
+		pageNo, _ := strconv.Atoi(query.Get("page_no"))
+		if pageNo == 0 {
+			pageNo = 1
+		}
+		query.Set("page_no", strconv.Itoa(pageNo+1))
+		return true
+	}
+	return false
+}
+
+// writeRaw pretty-prints JSON responses (keeping numbers exact) and passes
+// anything else through.
+func writeRaw(data []byte) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(data)
+	}
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	os.Stdout.Write(buf.Bytes())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/safety"
+)
+
+func TestSplitAPIPath(t *testing.T) {
+	path, query, err := splitAPIPath("v1.0/devices?source_type=tuyaUser", []string{"page_size=20", "source_id=u1"})
+	if err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	if path != "/v1.0/devices" || query.Encode() != "page_size=20&source_id=u1&source_type=tuyaUser" {
+		t.Fatalf("unexpected split: %s %s", path, query.Encode())
+	}
+	if _, _, err := splitAPIPath("/x", []string{"novalue"}); err == nil {
+		t.Fatalf("expected error for malformed --query")
+	}
+	if apiBackendFor("/api/config") != "ha" || apiBackendFor("/v2.0/cloud/thing/x") != "cloud" || apiBackendFor("/other") != "" {
+		t.Fatalf("unexpected backend guess")
+	}
+}
+
+func TestPaginateCloud(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result any
+		switch {
+		case r.URL.Path == "/v1.0/token":
+			result = map[string]any{"access_token": "tok", "expire_time": 7200, "uid": "u"}
+		case r.URL.Query().Get("last_row_key") == "":
+			result = map[string]any{"list": []int{1, 2}, "has_more": true, "last_row_key": "k2"}
+		default:
+			result = map[string]any{"list": []int{3}, "has_more": false}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	defer srv.Close()
+
+	client := cloud.New(srv.URL, "id", "key", "u")
+	client.SetTokenCachePath(filepath.Join(t.TempDir(), "token.json"))
+	_, query, _ := splitAPIPath("/v1.0/iot-01/associated-users/devices", nil)
+	items, err := paginateCloud(client, "GET", "/v1.0/iot-01/associated-users/devices", query, nil)
+	if err != nil {
+		t.Fatalf("paginate failed: %v", err)
+	}
+	if len(items) != 3 || string(items[2]) != "3" {
+		t.Fatalf("unexpected items: %s", items)
+	}
+}
+
+func TestAPIActionChecksDevicesAndCodes(t *testing.T) {
+	cfg := &config.Config{Safety: config.Safety{Deny: config.SafetyRules{Codes: []string{"child_lock"}, Entities: []string{"switch.fridge"}}}}
+	cases := []struct {
+		be, path, body string
+		id             string
+		codes          []string
+	}{
+		{"cloud", "/v1.0/iot-03/devices/fridge1/commands", `{"commands":[{"code":"switch_1","value":false},{"code":"child_lock","value":true}]}`, "fridge1", []string{"switch_1", "child_lock"}},
+		{"cloud", "/v2.0/cloud/thing/fridge1/shadow/properties/issue", `{"properties":"{\"switch_1\":false}"}`, "fridge1", []string{"switch_1"}},
+		{"cloud", "/v1.0/iot-01/associated-users/devices", `{}`, "", nil},
+	}
+	for _, c := range cases {
+		a := apiAction(cfg, c.be, "POST", c.path, json.RawMessage(c.body))
+		if a.DeviceID != c.id || !reflect.DeepEqual(a.Codes, c.codes) || a.Service != "POST "+c.path {
+			t.Fatalf("%s: unexpected action %+v", c.path, a)
+		}
+	}
+	policy := safety.New(cfg.Safety)
+	if err := policy.Check(apiAction(cfg, "cloud", "POST", cases[0].path, json.RawMessage(cases[0].body))); err == nil {
+		t.Fatalf("expected the denied code to be refused")
+	}
+	call := apiAction(cfg, "ha", "POST", "/api/services/switch/turn_off", json.RawMessage(`{"entity_id":["switch.fridge"]}`))
+	if call.Service != "switch.turn_off" || policy.Check(call) == nil {
+		t.Fatalf("expected the denied entity to be refused, got %+v", call)
+	}
+}
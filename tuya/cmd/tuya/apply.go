@@ -0,0 +1,504 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/plan"
+	"tuya-hub/internal/safety"
+	"tuya-hub/internal/trace"
+	"tuya-hub/internal/verify"
+)
+
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	file := fs.String("f", "", "plan file (YAML), or - for stdin")
+	concurrency := fs.Int("concurrency", 0, "targets written at once (default: the plan's, else 4)")
+	yes := fs.Bool("yes", false, "confirm the plan and actions that need confirmation")
+	var wait waitFlag
+	fs.Var(&wait, "wait", "poll until each target reports the new value; optional timeout (default 10s)")
+	verifyFlag := fs.Bool("verify", false, "read back and report the value each target reports")
+	out := addOutputFlags(fs)
+	parseWithWait(fs, args, &wait)
+	p := out.printer("apply")
+
+	if strings.TrimSpace(*file) == "" {
+		fatal(fault.New(fault.Usage, "-f <plan.yaml> required"))
+	}
+	pl, err := plan.Load(*file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fatal(fault.Wrap(fault.NotFound, err))
+		}
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	if *concurrency > 0 {
+		pl.Concurrency = *concurrency
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	w := writer{cfg: cfg, backend: be, wait: wait, verify: *verifyFlag}
+	steps := make([][]job, 0, len(pl.Steps))
+	total := 0
+	for i, step := range pl.Steps {
+		jobs, err := w.jobs(step, step.Label(i))
+		if err != nil {
+			fatal(err)
+		}
+		steps = append(steps, jobs)
+		total += len(jobs)
+	}
+	confirmFanOut(steps, "apply", *yes, machine(p))
+	for _, jobs := range steps {
+		for _, j := range jobs {
+			guard(cfg, j.action, *yes, machine(p))
+		}
+	}
+	results := runJobs(steps, pl.Concurrency)
+	reportJobs(p, results, targetColumns, total)
+}
+
+// target is one device or entity a write goes to.
+type target struct {
+	ID   string
+	Name string
+}
+
+// job is one write to one target. value is what it sends, for dry runs.
+type job struct {
+	step   string
+	target target
+	action safety.Action
+	value  any
+	run    func() (actionResult, error)
+}
+
+// targetResult is one line of a fan-out summary.
+type targetResult struct {
+	Step     string       `json:"step,omitempty"`
+	Target   string       `json:"target"`
+	Name     string       `json:"name,omitempty"`
+	Action   string       `json:"action"`
+	OK       bool         `json:"ok"`
+	Value    any          `json:"value,omitempty"`
+	Observed any          `json:"observed,omitempty"`
+	Error    *fault.Error `json:"error,omitempty"`
+}
+
+var targetColumns = []output.Column[targetResult]{
+	{Name: "step", Value: func(r targetResult) any { return r.Step }},
+	{Name: "target", Value: func(r targetResult) any { return r.Target }},
+	{Name: "name", Value: func(r targetResult) any { return r.Name }},
+	{Name: "action", Value: func(r targetResult) any { return r.Action }},
+	{Name: "status", Value: func(r targetResult) any { return r.status() }},
+	{Name: "error", Value: func(r targetResult) any {
+		if r.Error == nil {
+			return ""
+		}
+		return r.Error.Message
+	}},
+}
+
+func (r targetResult) status() string {
+	switch {
+	case r.Error != nil:
+		return "failed (" + string(r.Error.Kind) + ")"
+	case isDryRun():
+		return "dry run"
+	case r.Observed != nil:
+		return "confirmed"
+	}
+	return "sent"
+}
+
+// writer turns steps into jobs for one backend.
+type writer struct {
+	cfg     *config.Config
+	backend string
+	wait    waitFlag
+	verify  bool
+}
+
+// jobs resolves a step's targets and builds a job for each.
+func (w writer) jobs(step plan.Step, label string) ([]job, error) {
+	if err := step.Validate(); err != nil {
+		return nil, fault.New(fault.Usage, "%s: %v", label, err)
+	}
+	switch w.backend {
+	case "cloud":
+		if len(step.Commands) == 0 {
+			return nil, fault.New(fault.Usage, "%s: cloud steps need commands (code/value pairs)", label)
+		}
+		client := cloudClient(w.cfg)
+		targets, err := cloudTargets(w.cfg, client, step.Selector)
+		if err != nil {
+			return nil, err
+		}
+		codes := make([]string, 0, len(step.Commands))
+		for _, c := range step.Commands {
+			codes = append(codes, c.Code)
+		}
+		jobs := make([]job, 0, len(targets))
+		for _, t := range targets {
+			id := t.ID
+			action := safety.Action{Kind: "set", DeviceID: id, DeviceName: t.Name, Codes: codes}
+			if t.Name == "" {
+				action = cloudAction(w.cfg, client, "set", id, codes...)
+			}
+			jobs = append(jobs, job{step: label, target: t, action: action, run: func() (actionResult, error) {
+				return cloudSet(client, id, step.Commands, w.wait, w.verify)
+			}})
+		}
+		return jobs, nil
+	case "ha":
+		if len(step.Commands) > 0 {
+			return nil, fault.New(fault.Usage, "%s: Home Assistant steps take state or service, not commands", label)
+		}
+		client := haClient(w.cfg)
+		targets, err := haTargets(w.cfg, client, step.Selector, step.State != "")
+		if err != nil {
+			return nil, err
+		}
+		jobs := make([]job, 0, len(targets))
+		for _, t := range targets {
+			entity := t.ID
+			service, want := step.Service, ""
+			if step.State != "" {
+				want = strings.ToLower(step.State)
+				service = ha.DomainFromEntity(entity) + ".turn_" + want
+			}
+			action := safety.Action{Kind: "set", Entity: entity, Service: service}
+			if step.State == "" {
+				action.Kind = "call"
+			}
+			jobs = append(jobs, job{step: label, target: t, action: action, run: func() (actionResult, error) {
+				return haSet(client, entity, service, step.Data, want, w.wait, w.verify)
+			}})
+		}
+		return jobs, nil
+	}
+	return nil, fault.New(fault.Usage, "writes not implemented for backend %s", w.backend)
+}
+
+// cloudTargets resolves a selector against the cloud device list. An empty
+// selector matches every device.
+func cloudTargets(cfg *config.Config, client *cloud.Client, sel plan.Selector) ([]target, error) {
+	if sel.ID != "" {
+		return []target{{ID: cfg.ResolveAlias(sel.ID)}}, nil
+	}
+	if err := checkSelector(cfg, sel); err != nil {
+		return nil, err
+	}
+	devices, err := client.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	var out []target
+	for _, dev := range selectDevices(cfg, devices, sel) {
+		out = append(out, target{ID: dev.ID, Name: dev.Name})
+	}
+	if len(out) == 0 {
+		return nil, noTargets(sel)
+	}
+	return out, nil
+}
+
+// selectDevices applies the fan-out parts of a selector to devices.
+func selectDevices(cfg *config.Config, devices []cloud.Device, sel plan.Selector) []cloud.Device {
+	var out []cloud.Device
+	for _, dev := range filterCloudDevices(devices, sel.Filter) {
+		if sel.Category != "" && !strings.EqualFold(dev.Category, sel.Category) {
+			continue
+		}
+		if inSelection(cfg, dev.ID, sel) {
+			out = append(out, dev)
+		}
+	}
+	return out
+}
+
+// switchableDomains are the entity domains that take turn_on/turn_off, so
+// an on/off fan-out skips sensors that happen to match the selector.
+var switchableDomains = map[string]bool{
+	"switch": true, "light": true, "fan": true, "input_boolean": true, "humidifier": true,
+	"siren": true, "climate": true, "media_player": true, "remote": true, "automation": true,
+}
+
+// haTargets resolves a selector against the Home Assistant states. An
+// empty selector matches every entity.
+func haTargets(cfg *config.Config, client *ha.Client, sel plan.Selector, switchable bool) ([]target, error) {
+	if sel.ID != "" {
+		return []target{{ID: cfg.ResolveAlias(sel.ID)}}, nil
+	}
+	if err := checkSelector(cfg, sel); err != nil {
+		return nil, err
+	}
+	states, err := client.States()
+	if err != nil {
+		return nil, err
+	}
+	var out []target
+	for _, st := range selectStates(cfg, states, sel) {
+		if switchable && !switchableDomains[ha.DomainFromEntity(st.EntityID)] {
+			continue
+		}
+		name, _ := st.Attributes["friendly_name"].(string)
+		out = append(out, target{ID: st.EntityID, Name: name})
+	}
+	if len(out) == 0 {
+		return nil, noTargets(sel)
+	}
+	return out, nil
+}
+
+// selectStates applies the fan-out parts of a selector to entities; the
+// category is the entity domain.
+func selectStates(cfg *config.Config, states []ha.State, sel plan.Selector) []ha.State {
+	var out []ha.State
+	for _, st := range filterStates(states, sel.Filter) {
+		if sel.Category != "" && !strings.EqualFold(ha.DomainFromEntity(st.EntityID), sel.Category) {
+			continue
+		}
+		if inSelection(cfg, st.EntityID, sel) {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// checkSelector rejects unknown rooms and groups before any lookups.
+func checkSelector(cfg *config.Config, sel plan.Selector) error {
+	if err := checkRoom(cfg, sel.Room); err != nil {
+		return err
+	}
+	if sel.Group == "" {
+		return nil
+	}
+	if _, ok := cfg.GroupMembers(sel.Group); ok {
+		return nil
+	}
+	if len(cfg.Groups) == 0 {
+		return fault.New(fault.Config, "no groups configured").WithHint("list device ids or aliases under groups: in config")
+	}
+	names := make([]string, 0, len(cfg.Groups))
+	for name := range cfg.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fault.New(fault.NotFound, "unknown group %q (known: %s)", sel.Group, strings.Join(names, ", "))
+}
+
+// inSelection applies the room and group parts of a selector.
+func inSelection(cfg *config.Config, id string, sel plan.Selector) bool {
+	if !inRoom(cfg, id, sel.Room) {
+		return false
+	}
+	if sel.Group == "" {
+		return true
+	}
+	members, _ := cfg.GroupMembers(sel.Group)
+	for _, m := range members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+func noTargets(sel plan.Selector) error {
+	var parts []string
+	for _, kv := range [][2]string{{"filter", sel.Filter}, {"room", sel.Room}, {"category", sel.Category}, {"group", sel.Group}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	if len(parts) == 0 {
+		return fault.New(fault.NotFound, "no devices found")
+	}
+	return fault.New(fault.NotFound, "no devices match %s", strings.Join(parts, " "))
+}
+
+// cloudSet sends commands to one device in a single call, then confirms them
+// when --wait or --verify asked for it.
+func cloudSet(client *cloud.Client, id string, commands []plan.Command, w waitFlag, verifyOnly bool) (actionResult, error) {
+	batch := make([]map[string]any, 0, len(commands))
+	codes := make([]string, 0, len(commands))
+	for _, c := range commands {
+		batch = append(batch, map[string]any{"code": c.Code, "value": c.Value})
+		codes = append(codes, c.Code)
+	}
+	var want any = commands[0].Value
+	if len(commands) > 1 {
+		all := make(map[string]any, len(commands))
+		for _, c := range commands {
+			all[c.Code] = c.Value
+		}
+		want = all
+	}
+	result := actionResult{Target: id, Action: strings.Join(codes, ","), Value: want}
+	res, err := client.SendCommands(id, batch)
+	if err != nil {
+		return result, err
+	}
+	result.Result = res
+	return result, awaitState(&result, cloudFetch(client, id, codes), want, w, verifyOnly)
+}
+
+// cloudFetch reads the status DPs for codes: the value itself for one code,
+// a code→value map for several. It reports nothing until every code is
+// present.
+func cloudFetch(client *cloud.Client, id string, codes []string) verify.Fetch {
+	return func() (any, bool, error) {
+		statuses, err := client.GetDeviceStatus(id)
+		if err != nil {
+			return nil, false, err
+		}
+		values := map[string]any{}
+		for _, st := range statuses {
+			values[st.Code] = st.Value
+		}
+		if len(codes) == 1 {
+			v, ok := values[codes[0]]
+			return v, ok, nil
+		}
+		out := make(map[string]any, len(codes))
+		for _, code := range codes {
+			v, ok := values[code]
+			if !ok {
+				return nil, false, nil
+			}
+			out[code] = v
+		}
+		return out, true, nil
+	}
+}
+
+// haSet calls domain.service for an entity. want is the state to confirm,
+// or "" for services with no simple on/off outcome.
+func haSet(client *ha.Client, entity, service string, data map[string]any, want string, w waitFlag, verifyOnly bool) (actionResult, error) {
+	domain, name, _ := strings.Cut(service, ".")
+	payload := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["entity_id"] = entity
+	result := actionResult{Target: entity, Action: service}
+	if len(data) > 0 {
+		result.Value = data
+	}
+	res, err := client.CallService(domain, name, payload)
+	if err != nil {
+		return result, err
+	}
+	result.Result = res
+	if want == "" {
+		return result, nil
+	}
+	return result, awaitState(&result, func() (any, bool, error) {
+		st, err := client.State(entity)
+		if err != nil {
+			return nil, false, err
+		}
+		return st.State, true, nil
+	}, want, w, verifyOnly)
+}
+
+// confirmFanOut asks before writing to selected targets: every apply, and
+// any set that used a selector. --yes skips the question; without a
+// terminal the refusal is returned like a safety rule needing confirmation.
+func confirmFanOut(steps [][]job, kind string, yes, jsonOut bool) {
+	var ids []string
+	for _, jobs := range steps {
+		for _, j := range jobs {
+			ids = append(ids, j.target.ID)
+		}
+	}
+	summary := strings.Join(ids, ", ")
+	if len(ids) > 3 {
+		summary = fmt.Sprintf("%s and %d more", strings.Join(ids[:3], ", "), len(ids)-3)
+	}
+	refusal := &safety.Refusal{
+		Action:       safety.Action{Kind: kind, Entity: summary},
+		Rule:         "fan-out",
+		Reason:       fmt.Sprintf("writes to %d targets", len(ids)),
+		Hint:         "review the targets, then pass --yes",
+		NeedsConfirm: true,
+	}
+	confirmRefusal(refusal, yes, jsonOut)
+}
+
+// runJobs runs the steps in order and the jobs of each step concurrently,
+// and returns one result per job in order.
+func runJobs(steps [][]job, concurrency int) []targetResult {
+	var results []targetResult
+	for _, jobs := range steps {
+		batch := make([]targetResult, len(jobs))
+		plan.Run(len(jobs), concurrency, func(i int) {
+			j := jobs[i]
+			res, err := j.run()
+			r := targetResult{Step: j.step, Target: j.target.ID, Name: j.target.Name, Action: res.Action, Value: res.Value, Observed: res.Observed}
+			if r.Action == "" {
+				r.Action = j.action.Service
+			}
+			if err != nil && !errors.Is(err, trace.ErrDryRun) {
+				r.Error = classify(err)
+			}
+			r.OK = r.Error == nil
+			batch[i] = r
+		})
+		results = append(results, batch...)
+	}
+	return results
+}
+
+// plannedResults lists the jobs runJobs would run, without running them.
+func plannedResults(steps [][]job) []targetResult {
+	var results []targetResult
+	for _, jobs := range steps {
+		for _, j := range jobs {
+			action := j.action.Service
+			if action == "" {
+				action = strings.Join(j.action.Codes, ",")
+			}
+			results = append(results, targetResult{Step: j.step, Target: j.target.ID, Name: j.target.Name, Action: action, Value: j.value, OK: true})
+		}
+	}
+	return results
+}
+
+// reportJobs prints the per-target summary. When targets failed it exits
+// with their error kind's code if they share one, and 1 otherwise.
+func reportJobs(p *output.Printer, results []targetResult, cols []output.Column[targetResult], total int) {
+	failed := 0
+	var kind fault.Kind
+	for _, r := range results {
+		if r.Error == nil {
+			continue
+		}
+		if failed == 0 {
+			kind = r.Error.Kind
+		} else if kind != r.Error.Kind {
+			kind = fault.Internal
+		}
+		failed++
+	}
+	p.Meta = map[string]any{"targets": total, "failed": failed}
+	render(p, results, cols)
+	if p.IsTable() {
+		fmt.Printf("%d of %d targets succeeded\n", total-failed, total)
+	}
+	if failed > 0 {
+		os.Exit(kind.ExitCode())
+	}
+}
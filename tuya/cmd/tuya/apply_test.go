@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/plan"
+	"tuya-hub/internal/snapshot"
+)
+
+// fakeCloud serves a device list, echoes commands into the device status
+// and records which devices were written.
+func fakeCloud(t *testing.T) (*cloud.Client, map[string]int) {
+	var mu sync.Mutex
+	status := map[string]map[string]any{}
+	sent := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result any
+		parts := strings.Split(r.URL.Path, "/")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1.0/token":
+			result = map[string]any{"access_token": "tok", "expire_time": 7200, "uid": "u"}
+		case strings.HasSuffix(r.URL.Path, "/devices") && strings.Contains(r.URL.Path, "/users/"):
+			result = []map[string]any{
+				{"id": "lamp1", "name": "Desk lamp", "category": "dj"},
+				{"id": "lamp2", "name": "Hall lamp", "category": "dj"},
+				{"id": "plug1", "name": "Kettle plug", "category": "cz"},
+			}
+		case strings.HasSuffix(r.URL.Path, "/commands"):
+			id := parts[len(parts)-2]
+			var body struct {
+				Commands []struct {
+					Code  string `json:"code"`
+					Value any    `json:"value"`
+				} `json:"commands"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if status[id] == nil {
+				status[id] = map[string]any{}
+			}
+			for _, c := range body.Commands {
+				status[id][c.Code] = c.Value
+			}
+			sent[id]++
+			result = map[string]any{}
+		case strings.HasSuffix(r.URL.Path, "/status"):
+			id := parts[len(parts)-2]
+			list := []map[string]any{}
+			for code, v := range status[id] {
+				list = append(list, map[string]any{"code": code, "value": v})
+			}
+			result = list
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	client := cloud.New(srv.URL, "id", "key", "u")
+	client.SetTokenCachePath(filepath.Join(t.TempDir(), "token.json"))
+	return client, sent
+}
+
+func TestCloudTargets(t *testing.T) {
+	client, _ := fakeCloud(t)
+	cfg := &config.Config{
+		Aliases: map[string]string{"kettle": "plug1"},
+		Rooms:   map[string][]string{"hall": {"lamp2", "kettle"}},
+		Groups:  map[string][]string{"evening": {"lamp1", "kettle"}},
+	}
+	cases := []struct {
+		sel  plan.Selector
+		want string
+	}{
+		{plan.Selector{Category: "dj"}, "lamp1,lamp2"},
+		{plan.Selector{Room: "hall"}, "lamp2,plug1"},
+		{plan.Selector{Group: "evening"}, "lamp1,plug1"},
+		{plan.Selector{Filter: "lamp", Room: "hall"}, "lamp2"},
+		{plan.Selector{ID: "kettle"}, "plug1"},
+	}
+	for _, c := range cases {
+		targets, err := cloudTargets(cfg, client, c.sel)
+		if err != nil {
+			t.Fatalf("%+v: %v", c.sel, err)
+		}
+		var ids []string
+		for _, tg := range targets {
+			ids = append(ids, tg.ID)
+		}
+		if got := strings.Join(ids, ","); got != c.want {
+			t.Fatalf("%+v: expected %s, got %s", c.sel, c.want, got)
+		}
+	}
+	if _, err := cloudTargets(cfg, client, plan.Selector{Group: "night"}); err == nil || classify(err).Kind != "not-found" {
+		t.Fatalf("expected not-found for unknown group, got %v", err)
+	}
+	if _, err := cloudTargets(cfg, client, plan.Selector{Category: "wk"}); err == nil {
+		t.Fatalf("expected error when nothing matches")
+	}
+}
+
+func TestRunJobsMultipleCodes(t *testing.T) {
+	client, sent := fakeCloud(t)
+	commands := []plan.Command{{Code: "switch_led", Value: true}, {Code: "bright_value_v2", Value: float64(500)}}
+	var jobs []job
+	for _, id := range []string{"lamp1", "lamp2"} {
+		id := id
+		jobs = append(jobs, job{step: "dim", target: target{ID: id}, run: func() (actionResult, error) {
+			return cloudSet(client, id, commands, waitFlag{}, true)
+		}})
+	}
+	results := runJobs([][]job{jobs}, 2)
+	if len(results) != 2 || sent["lamp1"] != 1 || sent["lamp2"] != 1 {
+		t.Fatalf("expected one batch per lamp, got %v (%v)", results, sent)
+	}
+	for _, r := range results {
+		if !r.OK || r.Action != "switch_led,bright_value_v2" || r.status() != "confirmed" {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestRestoreCloud(t *testing.T) {
+	client, sent := fakeCloud(t)
+	snap := &snapshot.Snapshot{Devices: []snapshot.Device{
+		{ID: "lamp1", DPs: map[string]any{"switch_led": true, "bright_value_v2": float64(500)}},
+		{ID: "lamp2", DPs: map[string]any{"switch_led": true}},
+	}}
+	jobs := restoreCloud(client, snap)
+	if len(jobs) != 2 || jobs[0].action.Codes[0] != "switch_led" {
+		t.Fatalf("unexpected restore plan %+v", jobs)
+	}
+	for _, r := range runJobs([][]job{jobs}, 2) {
+		if !r.OK {
+			t.Fatalf("restore failed: %+v", r)
+		}
+	}
+	if again := restoreCloud(client, snap); len(again) != 0 || sent["lamp1"] != 1 {
+		t.Fatalf("expected nothing left to restore, got %d jobs (%v)", len(again), sent)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tuya-hub/internal/climate"
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/safety"
+)
+
+func runClimate(args []string) {
+	if len(args) == 0 {
+		fatal(fault.New(fault.Usage, "climate subcommand required (status|set)"))
+	}
+	switch args[0] {
+	case "status":
+		runClimateStatus(args[1:])
+	case "set":
+		runClimateSet(args[1:])
+	default:
+		fatal(fault.New(fault.Usage, "unknown climate subcommand: %s", args[0]))
+	}
+}
+
+// climateRow is one thermostat in climate status.
+type climateRow struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	climate.State
+	Summary string `json:"summary"`
+}
+
+var climateColumns = []output.Column[climateRow]{
+	{Name: "id", Value: func(r climateRow) any { return r.ID }},
+	{Name: "name", Value: func(r climateRow) any { return r.Name }},
+	{Name: "status", Value: func(r climateRow) any { return r.Summary }},
+}
+
+func runClimateStatus(args []string) {
+	fs := flag.NewFlagSet("climate status", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	entity := fs.String("entity", "", "climate entity id (ha; default all)")
+	deviceID := fs.String("id", "", "device id (cloud; default all climate devices)")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("climate")
+
+	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	var rows []climateRow
+	switch be {
+	case "ha":
+		client := haClient(cfg)
+		var states []ha.State
+		if id := strings.TrimSpace(*entity); id != "" {
+			st, err := client.State(id)
+			if err != nil {
+				fatal(err)
+			}
+			states = []ha.State{*st}
+		} else {
+			all, err := client.States()
+			if err != nil {
+				fatal(err)
+			}
+			for _, st := range sortStates(all) {
+				if ha.DomainFromEntity(st.EntityID) == "climate" {
+					states = append(states, st)
+				}
+			}
+		}
+		for _, st := range states {
+			name, _ := st.Attributes["friendly_name"].(string)
+			rows = append(rows, newClimateRow(st.EntityID, name, climate.FromHA(st)))
+		}
+	case "cloud":
+		client := cloudClient(cfg)
+		devices, err := climateDevices(client, *deviceID)
+		if err != nil {
+			fatal(err)
+		}
+		for _, dev := range devices {
+			statuses, err := client.GetDeviceStatus(dev.ID)
+			if err != nil {
+				fatal(err)
+			}
+			// Without a spec, temperatures fall back to the tenths heuristic.
+			spec, _ := client.GetDeviceSpec(dev.ID)
+			rows = append(rows, newClimateRow(dev.ID, dev.Name, climate.FromTuya(statuses, spec)))
+		}
+	default:
+		fatal(fault.New(fault.Usage, "climate not implemented for backend %s", be))
+	}
+	if p.IsTable() && len(rows) == 0 {
+		fmt.Println("(no climate devices)")
+		return
+	}
+	render(p, rows, climateColumns)
+}
+
+func newClimateRow(id, name string, st climate.State) climateRow {
+	return climateRow{ID: id, Name: name, State: st, Summary: st.Summary()}
+}
+
+// climateDevices returns the device with id, or every climate device.
+func climateDevices(client *cloud.Client, id string) ([]cloud.Device, error) {
+	devices, err := client.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	var out []cloud.Device
+	for _, dev := range devices {
+		if (id != "" && dev.ID == id) || (id == "" && climate.IsClimate(dev.Category)) {
+			out = append(out, dev)
+		}
+	}
+	if id != "" && len(out) == 0 {
+		out = append(out, cloud.Device{ID: id})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func runClimateSet(args []string) {
+	fs := flag.NewFlagSet("climate set", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	entity := fs.String("entity", "", "climate entity id (ha)")
+	deviceID := fs.String("id", "", "device id (cloud)")
+	target := fs.String("target", "", "target temperature, e.g. 21.5 or 70F")
+	mode := fs.String("mode", "", "mode: "+strings.Join(climate.Modes(), "|")+" or a device mode")
+	preset := fs.String("preset", "", "preset, e.g. eco or none")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("climate")
+
+	req := climate.Request{Mode: *mode, Preset: *preset}
+	if strings.TrimSpace(*target) != "" {
+		v, unit, err := climate.ParseTarget(*target)
+		if err != nil {
+			fatal(fault.Wrap(fault.Usage, err))
+		}
+		req.Target, req.TargetUnit = &v, unit
+	}
+	if req.Target == nil && strings.TrimSpace(req.Mode) == "" && strings.TrimSpace(req.Preset) == "" {
+		fatal(fault.New(fault.Usage, "nothing to do: pass --target, --mode or --preset"))
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	switch be {
+	case "ha":
+		climateSetHA(cfg, p, *entity, req, *yes)
+	case "cloud":
+		id := strings.TrimSpace(*deviceID)
+		if id == "" {
+			id = strings.TrimSpace(*entity)
+		}
+		if id == "" {
+			fatal(fault.New(fault.Usage, "--id required for cloud backend"))
+		}
+		client := cloudClient(cfg)
+		spec, err := client.GetDeviceSpec(id)
+		if err != nil {
+			fatal(err)
+		}
+		commands, err := climate.Commands(spec, req)
+		if err != nil {
+			fatal(fault.Wrap(fault.Validation, err))
+		}
+		codes := make([]string, 0, len(commands))
+		for _, c := range commands {
+			codes = append(codes, c["code"].(string))
+		}
+		guard(cfg, cloudAction(cfg, client, "set", id, codes...), *yes, machine(p))
+		res, err := client.SendCommands(id, commands)
+		if err != nil {
+			fatal(err)
+		}
+		result := actionResult{Target: id, Action: strings.Join(codes, ","), Value: commands, Result: res}
+		renderObject(p, result, func() {
+			fmt.Printf("sent %s %s\n", id, describeCommands(commands))
+		})
+	default:
+		fatal(fault.New(fault.Usage, "climate not implemented for backend %s", be))
+	}
+}
+
+func climateSetHA(cfg *config.Config, p *output.Printer, entity string, req climate.Request, yes bool) {
+	if strings.TrimSpace(entity) == "" {
+		fatal(fault.New(fault.Usage, "--entity required"))
+	}
+	if ha.DomainFromEntity(entity) != "climate" {
+		fatal(fault.New(fault.Usage, "%s is not a climate entity", entity))
+	}
+	client := haClient(cfg)
+	st, err := client.State(entity)
+	if err != nil {
+		fatal(err)
+	}
+	unit := ""
+	if req.TargetUnit != "" {
+		if unit, err = client.TemperatureUnit(); err != nil {
+			fatal(err)
+		}
+	}
+	calls, err := climate.HACalls(req, unit, stringList(st.Attributes["hvac_modes"]), stringList(st.Attributes["preset_modes"]))
+	if err != nil {
+		fatal(fault.Wrap(fault.Validation, err))
+	}
+	for _, call := range calls {
+		guard(cfg, safety.Action{Kind: "set", Entity: entity, Service: "climate." + call.Service}, yes, machine(p))
+	}
+	var results []any
+	for _, call := range calls {
+		call.Data["entity_id"] = entity
+		res, err := client.CallService("climate", call.Service, call.Data)
+		if err != nil {
+			fatal(err)
+		}
+		delete(call.Data, "entity_id")
+		results = append(results, res)
+	}
+	services := make([]string, 0, len(calls))
+	for _, call := range calls {
+		services = append(services, "climate."+call.Service)
+	}
+	result := actionResult{Target: entity, Action: strings.Join(services, ","), Value: calls, Result: results}
+	renderObject(p, result, func() {
+		fmt.Printf("%s %s\n", entity, strings.Join(services, " "))
+	})
+}
+
+// describeCommands renders a DP batch as code=value pairs.
+func describeCommands(commands []map[string]any) string {
+	parts := make([]string, 0, len(commands))
+	for _, c := range commands {
+		parts = append(parts, fmt.Sprintf("%v=%v", c["code"], c["value"]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// stringList reads an HA attribute holding a list of strings.
+func stringList(v any) []string {
+	items, _ := v.([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/energy"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/schedule"
+	"tuya-hub/internal/secret"
+	"tuya-hub/internal/sensor"
+	"tuya-hub/internal/units"
+)
+
+// runConfigSub handles the non-wizard config subcommands. It reports false
+// when args do not name one, so the wizard runs instead.
+func runConfigSub(args []string) bool {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false
+	}
+	switch args[0] {
+	case "show":
+		runConfigShow(args[1:])
+	case "get":
+		runConfigGet(args[1:])
+	case "set":
+		runConfigSet(args[1:])
+	case "validate":
+		runConfigValidate(args[1:])
+	case "path":
+		runConfigPath(args[1:])
+	case "migrate":
+		runConfigMigrate(args[1:])
+	default:
+		fatal(fault.New(fault.Usage, "unknown config subcommand: %s (show|get|set|validate|path|migrate)", args[0]))
+	}
+	return true
+}
+
+func configFilePath(path string) string {
+	if path != "" {
+		return path
+	}
+	p, err := config.DefaultPath()
+	if err != nil {
+		fatal(err)
+	}
+	return p
+}
+
+func runConfigPath(args []string) {
+	fs := flag.NewFlagSet("config path", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	fs.Parse(args)
+	fmt.Println(configFilePath(*configPath))
+}
+
+func runConfigShow(args []string) {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("config show")
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	masked, err := cfg.Masked()
+	if err != nil {
+		fatal(err)
+	}
+	tree, err := masked.Tree()
+	if err != nil {
+		fatal(err)
+	}
+	renderObject(p, tree, func() {
+		data, err := yaml.Marshal(masked)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Print(string(data))
+	})
+}
+
+func runConfigGet(args []string) {
+	fs := flag.NewFlagSet("config get", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	reveal := fs.Bool("reveal", false, "print plaintext secrets instead of masking them")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("config get")
+	if fs.NArg() != 1 {
+		fatal(fault.New(fault.Usage, "usage: tuya config get <key>"))
+	}
+	key := fs.Arg(0)
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if !*reveal {
+		if cfg, err = cfg.Masked(); err != nil {
+			fatal(err)
+		}
+	}
+	val, err := cfg.Get(key)
+	if err != nil {
+		fatal(err)
+	}
+	renderObject(p, val, func() {
+		switch v := val.(type) {
+		case map[string]any, []any:
+			data, err := yaml.Marshal(v)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Print(string(data))
+		default:
+			fmt.Println(v)
+		}
+	})
+}
+
+func runConfigSet(args []string) {
+	fs := flag.NewFlagSet("config set", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fatal(fault.New(fault.Usage, "usage: tuya config set <key> <value>"))
+	}
+	key, value := fs.Arg(0), fs.Arg(1)
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if err := cfg.Set(key, value); err != nil {
+		fatal(err)
+	}
+	path, err := config.Save(*configPath, cfg)
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	shown := value
+	if config.IsSecretKey(key) && !secret.IsRef(value) {
+		shown = config.MaskedValue
+	}
+	fmt.Printf("Set %s = %s in %s\n", cfg.ProfileKey(key), shown, path)
+}
+
+// runConfigMigrate writes an older config layout back in the current one,
+// keeping the old file as .bak.
+func runConfigMigrate(args []string) {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	path := configFilePath(*configPath)
+	from := cfg.MigratedFrom
+	if from == 0 {
+		fmt.Printf("%s is already at version %d\n", path, config.CurrentVersion)
+		return
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	if isDryRun() {
+		fmt.Printf("would migrate %s from version %d to %d (dry run)\n", path, from, config.CurrentVersion)
+		return
+	}
+	saved, err := config.Save(*configPath, cfg)
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	fmt.Printf("migrated %s from version %d to %d; the previous file is kept as %s\n", saved, from, config.CurrentVersion, config.BackupPath(saved))
+}
+
+func runConfigValidate(args []string) {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("config validate")
+
+	problems := validateConfig(*configPath, *backend)
+	if problems == nil {
+		problems = []string{}
+	}
+	result := map[string]any{"valid": len(problems) == 0, "problems": problems}
+	renderObject(p, result, func() {
+		if len(problems) == 0 {
+			fmt.Println("Config OK.")
+			return
+		}
+		for _, problem := range problems {
+			fmt.Printf("- %s\n", problem)
+		}
+	})
+	if len(problems) > 0 {
+		os.Exit(fault.Config.ExitCode())
+	}
+}
+
+// validateConfig checks everything that can be checked offline and returns
+// one message per problem.
+func validateConfig(path, backendOverride string) []string {
+	problems := []string{}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	problems = append(problems, cfg.Warnings...)
+	if err := cfg.UseProfile(""); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, name := range cfg.ProfileNames() {
+		if p := cfg.Profiles[name]; p != nil && p.Backend != "" && p.Backend != "ha" && p.Backend != "cloud" {
+			problems = append(problems, fmt.Sprintf("profiles.%s.backend: unknown backend %q", name, p.Backend))
+		}
+	}
+	if err := cfg.ResolveSecrets(secretResolver(cfg)); err != nil {
+		problems = append(problems, err.Error())
+	}
+	cfg.ApplyEnv()
+	be := backendOverride
+	if be == "" {
+		be = cfg.BackendOr("ha")
+	}
+	if err := cfg.Validate(be); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if u := strings.TrimSpace(cfg.HomeAssistant.URL); u != "" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("homeAssistant.url: %q is not an absolute URL", u))
+		}
+	}
+	if ttl := strings.TrimSpace(cfg.Server.CacheTTL); ttl != "" {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			problems = append(problems, fmt.Sprintf("server.cacheTTL: %v", err))
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Safety.Default)) {
+	case "", "allow", "confirm", "deny":
+	default:
+		problems = append(problems, fmt.Sprintf("safety.default: %q is not allow, confirm or deny", cfg.Safety.Default))
+	}
+	kindNames := make([]string, 0, len(cfg.SensorKinds))
+	for name := range cfg.SensorKinds {
+		kindNames = append(kindNames, name)
+	}
+	sort.Strings(kindNames)
+	for _, name := range kindNames {
+		if err := sensor.Check(cfg.SensorKinds[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("sensorKinds.%s: %v", name, err))
+		}
+	}
+	if _, err := units.ParseSystem(cfg.Units.System); err != nil {
+		problems = append(problems, fmt.Sprintf("units.system: %v", err))
+	}
+	unitKinds := make([]string, 0, len(cfg.Units.Kinds))
+	for name := range cfg.Units.Kinds {
+		unitKinds = append(unitKinds, name)
+	}
+	sort.Strings(unitKinds)
+	for _, name := range unitKinds {
+		if u := cfg.Units.Kinds[name]; !units.Known(u) {
+			problems = append(problems, fmt.Sprintf("units.kinds.%s: unknown unit %q", name, u))
+		}
+	}
+	groups := make([]string, 0, len(cfg.Groups))
+	for name := range cfg.Groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, name := range groups {
+		if len(cfg.Groups[name]) == 0 {
+			problems = append(problems, fmt.Sprintf("groups.%s: no members", name))
+		}
+	}
+	if _, err := energy.NewTariff(cfg.Tariff); err != nil {
+		problems = append(problems, fmt.Sprintf("tariff: %v", err))
+	}
+	for _, s := range cfg.Schedules {
+		spec, err := schedule.Parse(s.At)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("schedules.%s.at: %v", s.Name, err))
+			continue
+		}
+		if spec.IsSolar() && !cfg.Location.HasCoordinates() {
+			problems = append(problems, fmt.Sprintf("schedules.%s.at: solar schedule needs location.latitude/longitude", s.Name))
+		}
+		if len(s.Command) == 0 {
+			problems = append(problems, fmt.Sprintf("schedules.%s.command: empty", s.Name))
+		}
+	}
+	return problems
+}
+
+// testConnection checks the credentials in cfg against the backend: a token
+// grant for cloud, GET /api/ for Home Assistant.
+func testConnection(cfg *config.Config, backend string) (string, error) {
+	resolved, err := resolvedCopy(cfg)
+	if err != nil {
+		return "", err
+	}
+	switch backend {
+	case "cloud":
+		client := cloudClient(resolved)
+		tok, err := client.GetToken()
+		if err != nil {
+			return "", err
+		}
+		if uid := strings.TrimSpace(tok.UID); uid != "" {
+			return fmt.Sprintf("token OK at %s (UID %s)", client.Endpoint(), uid), nil
+		}
+		return fmt.Sprintf("token OK at %s", client.Endpoint()), nil
+	case "ha":
+		msg, err := haClient(resolved).Ping()
+		if err != nil {
+			return "", err
+		}
+		return "Home Assistant OK: " + msg, nil
+	}
+	return "", fmt.Errorf("unknown backend: %s", backend)
+}
+
+// configFlags are the settings accepted by `tuya config --non-interactive`.
+// Unset flags fall back to the matching TUYA_* environment variable.
+type configFlags struct {
+	accessID, accessKey, endpoint, region, schema, userID *string
+	haURL, haToken                                        *string
+}
+
+func addConfigFlags(fs *flag.FlagSet) configFlags {
+	return configFlags{
+		accessID:  fs.String("access-id", "", "Tuya Access ID (TUYA_CLOUD_ACCESS_ID)"),
+		accessKey: fs.String("access-key", "", "Tuya Access Key or secret reference (TUYA_CLOUD_ACCESS_KEY)"),
+		endpoint:  fs.String("endpoint", "", "Tuya endpoint URL or auto (TUYA_CLOUD_ENDPOINT)"),
+		region:    fs.String("region", "", "region label (TUYA_CLOUD_REGION)"),
+		schema:    fs.String("schema", "", "app schema (TUYA_CLOUD_SCHEMA)"),
+		userID:    fs.String("user-id", "", "linked app account UID (TUYA_CLOUD_USER_ID)"),
+		haURL:     fs.String("ha-url", "", "Home Assistant URL (TUYA_HA_URL)"),
+		haToken:   fs.String("ha-token", "", "Home Assistant token or secret reference (TUYA_HA_TOKEN)"),
+	}
+}
+
+func flagOrEnv(v, env string) string {
+	if v = strings.TrimSpace(v); v != "" {
+		return v
+	}
+	return strings.TrimSpace(os.Getenv(env))
+}
+
+func setIfPresent(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// configureNonInteractive fills cfg from flags and environment, then tests
+// the connection unless skipTest is set. Any problem is fatal, so scripts
+// never save a half-working config.
+func configureNonInteractive(cfg *config.Config, be string, f configFlags, skipTest bool) {
+	switch be {
+	case "cloud":
+		setIfPresent(&cfg.Cloud.AccessID, flagOrEnv(*f.accessID, "TUYA_CLOUD_ACCESS_ID"))
+		setIfPresent(&cfg.Cloud.AccessKey, flagOrEnv(*f.accessKey, "TUYA_CLOUD_ACCESS_KEY"))
+		setIfPresent(&cfg.Cloud.Endpoint, flagOrEnv(*f.endpoint, "TUYA_CLOUD_ENDPOINT"))
+		setIfPresent(&cfg.Cloud.Region, flagOrEnv(*f.region, "TUYA_CLOUD_REGION"))
+		setIfPresent(&cfg.Cloud.Schema, flagOrEnv(*f.schema, "TUYA_CLOUD_SCHEMA"))
+		setIfPresent(&cfg.Cloud.UserID, flagOrEnv(*f.userID, "TUYA_CLOUD_USER_ID"))
+		cfg.Cloud.Region = inferRegion(cfg.Cloud.Endpoint, cfg.Cloud.Region)
+	case "ha":
+		setIfPresent(&cfg.HomeAssistant.URL, flagOrEnv(*f.haURL, "TUYA_HA_URL"))
+		setIfPresent(&cfg.HomeAssistant.Token, flagOrEnv(*f.haToken, "TUYA_HA_TOKEN"))
+	}
+	if err := cfg.Validate(be); err != nil {
+		fatal(err)
+	}
+	if skipTest {
+		return
+	}
+	msg, err := testConnection(cfg, be)
+	if err != nil {
+		fatal(fmt.Errorf("connection test failed (pass --no-test to save anyway): %w", err))
+	}
+	fmt.Println(msg)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/countdown"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/output"
+)
+
+var timerColumns = []output.Column[countdown.Timer]{
+	{Name: "channel", Value: func(t countdown.Timer) any { return t.Channel }},
+	{Name: "code", Value: func(t countdown.Timer) any { return t.Code }},
+	{Name: "remaining", Value: func(t countdown.Timer) any { return countdown.Format(t.Remaining) }},
+}
+
+func runCountdown(args []string) {
+	fs := flag.NewFlagSet("countdown", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (cloud)")
+	deviceID := fs.String("id", "", "device id")
+	channel := fs.Int("channel", 1, "switch channel")
+	minutes := fs.Float64("minutes", 0, "minutes until the channel flips; 0 cancels (omit to show timers)")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("countdown")
+
+	setting := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "minutes" {
+			setting = true
+		}
+	})
+	if *channel < 1 {
+		fatal(fault.New(fault.Usage, "--channel must be 1 or more"))
+	}
+	if *minutes < 0 {
+		fatal(fault.New(fault.Usage, "--minutes must not be negative"))
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	if be != "cloud" {
+		fatal(fault.New(fault.Usage, "countdown not implemented for backend %s", be).
+			WithHint("tuya-local exposes timers as number entities; use tuya call --service number.set_value"))
+	}
+	id := strings.TrimSpace(*deviceID)
+	if id == "" {
+		fatal(fault.New(fault.Usage, "--id required"))
+	}
+	client := cloudClient(cfg)
+	if !setting {
+		statuses, err := client.GetDeviceStatus(id)
+		if err != nil {
+			fatal(err)
+		}
+		render(p, countdown.Timers(statuses, timerSpec(client, id, statuses)), timerColumns)
+		return
+	}
+
+	spec, err := client.GetDeviceSpec(id)
+	if err != nil {
+		fatal(err)
+	}
+	d := time.Duration(*minutes * float64(time.Minute))
+	command, err := countdown.Command(spec, *channel, d)
+	if err != nil {
+		fatal(fault.Wrap(fault.Validation, err))
+	}
+	code := command["code"].(string)
+	guard(cfg, cloudAction(cfg, client, "set", id, code), *yes, machine(p))
+	res, err := client.SendCommands(id, []map[string]any{command})
+	if err != nil {
+		fatal(err)
+	}
+	result := actionResult{Target: id, Action: code, Value: command["value"], Result: res}
+	renderObject(p, result, func() {
+		if d == 0 {
+			fmt.Printf("cancelled %s %s\n", id, code)
+			return
+		}
+		fmt.Printf("sent %s %s=%v (%s)\n", id, code, command["value"], countdown.Format(d))
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"tuya-hub/internal/cover"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/safety"
+)
+
+func runCover(args []string) {
+	fs := flag.NewFlagSet("cover", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	entity := fs.String("entity", "", "cover entity id (ha)")
+	deviceID := fs.String("id", "", "device id (cloud)")
+	channel := fs.Int("channel", 1, "motor channel on multi-curtain devices (cloud)")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	out := addOutputFlags(fs)
+
+	// The action and its value come first ("position 40 --id x"), but flags
+	// may also precede them.
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	fs.Parse(args)
+	positional = append(positional, fs.Args()...)
+	p := out.printer("cover")
+
+	req, err := cover.ParseRequest(positional)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	switch be {
+	case "ha":
+		if strings.TrimSpace(*entity) == "" {
+			fatal(fault.New(fault.Usage, "--entity required"))
+		}
+		if domain := ha.DomainFromEntity(*entity); domain != "cover" {
+			fatal(fault.New(fault.Usage, "%s is not a cover entity", *entity))
+		}
+		service, data := cover.HAService(req)
+		guard(cfg, safety.Action{Kind: "set", Entity: *entity, Service: "cover." + service}, *yes, machine(p))
+		data["entity_id"] = *entity
+		res, err := haClient(cfg).CallService("cover", service, data)
+		if err != nil {
+			fatal(err)
+		}
+		delete(data, "entity_id")
+		result := actionResult{Target: *entity, Action: "cover." + service, Value: data, Result: res}
+		renderObject(p, result, func() {
+			fmt.Printf("%s cover.%s\n", *entity, service)
+		})
+	case "cloud":
+		id := strings.TrimSpace(*deviceID)
+		if id == "" {
+			id = strings.TrimSpace(*entity)
+		}
+		if id == "" {
+			fatal(fault.New(fault.Usage, "--id required for cloud backend"))
+		}
+		client := cloudClient(cfg)
+		spec, err := client.GetDeviceSpec(id)
+		if err != nil {
+			fatal(err)
+		}
+		commands, err := cover.Commands(spec, req, *channel)
+		if err != nil {
+			fatal(fault.Wrap(fault.Validation, err))
+		}
+		code := commands[0]["code"].(string)
+		guard(cfg, cloudAction(cfg, client, "set", id, code), *yes, machine(p))
+		res, err := client.SendCommands(id, commands)
+		if err != nil {
+			fatal(err)
+		}
+		result := actionResult{Target: id, Action: code, Value: commands[0]["value"], Result: res}
+		renderObject(p, result, func() {
+			fmt.Printf("sent %s %s\n", id, describeCommands(commands))
+		})
+	default:
+		fatal(fault.New(fault.Usage, "cover not implemented for backend %s", be))
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+)
+
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+
+	clockSkewWarn = 30 * time.Second
+	clockSkewFail = 5 * time.Minute
+)
+
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+	// Kind classifies a failure; doctor exits with the first one's code.
+	Kind fault.Kind `json:"kind,omitempty"`
+}
+
+type doctorReport struct {
+	Config  string        `json:"config"`
+	Profile string        `json:"profile,omitempty"`
+	Backend string        `json:"backend"`
+	OK      bool          `json:"ok"`
+	Checks  []doctorCheck `json:"checks"`
+	Regions []cloud.Probe `json:"regions,omitempty"`
+}
+
+func (r *doctorReport) add(name, status, message, fix string) {
+	r.Checks = append(r.Checks, doctorCheck{Name: name, Status: status, Message: message, Fix: fix})
+}
+
+// fail records a failed check of the given kind.
+func (r *doctorReport) fail(name string, kind fault.Kind, message, fix string) {
+	r.Checks = append(r.Checks, doctorCheck{Name: name, Status: doctorFail, Message: message, Fix: fix, Kind: kind})
+}
+
+// exitCode is the exit status of the first failed check, or 0.
+func (r *doctorReport) exitCode() int {
+	for _, c := range r.Checks {
+		if c.Status == doctorFail {
+			return c.Kind.ExitCode()
+		}
+	}
+	return 0
+}
+
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	probe := fs.Bool("probe-regions", false, "probe every known data center even when the configured one works")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("doctor")
+
+	report := diagnose(*configPath, *backend, *probe)
+	renderObject(p, report, func() { printDoctorReport(report) })
+	if !report.OK {
+		os.Exit(report.exitCode())
+	}
+}
+
+// diagnose runs every check it can, continuing past failures so one report
+// names all problems at once.
+func diagnose(path, backendOverride string, probe bool) *doctorReport {
+	report := &doctorReport{Backend: backendOverride}
+	defer func() {
+		report.OK = true
+		for _, c := range report.Checks {
+			if c.Status == doctorFail {
+				report.OK = false
+			}
+		}
+	}()
+
+	if path == "" {
+		p, err := config.DefaultPath()
+		if err != nil {
+			report.fail("config", fault.Config, err.Error(), "set HOME or pass --config")
+			return report
+		}
+		path = p
+	}
+	report.Config = path
+	checkConfigFile(report, path)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		report.fail("config parse", fault.Config, err.Error(), "fix the YAML syntax or file permissions of "+path)
+		return report
+	}
+	for _, w := range cfg.Warnings {
+		report.add("config keys", doctorWarn, w, "rename or remove the key; it is ignored")
+	}
+	if cfg.MigratedFrom != 0 {
+		report.add("config version", doctorWarn, fmt.Sprintf("file uses layout version %d", cfg.MigratedFrom),
+			fmt.Sprintf("run tuya config migrate to upgrade it to version %d (the old file is kept as .bak)", config.CurrentVersion))
+	}
+	if err := cfg.UseProfile(""); err != nil {
+		report.fail("profile", fault.Config, err.Error(), "run `tuya profiles list` and pick an existing profile")
+		return report
+	}
+	report.Profile = cfg.Active
+
+	if plain := cfg.PlaintextSecrets(); len(plain) > 0 {
+		report.add("secrets", doctorWarn, "stored in plaintext: "+strings.Join(plain, ", "),
+			"move them to env:/file:/cmd:/vault: references (re-run `tuya config`)")
+	}
+	if err := cfg.ResolveSecrets(secretResolver(cfg)); err != nil {
+		report.fail("secrets", fault.Config, err.Error(), "make the referenced env var, file, command or vault entry available")
+		return report
+	}
+	cfg.ApplyEnv()
+
+	be := backendOverride
+	if be == "" {
+		be = cfg.BackendOr("ha")
+	}
+	report.Backend = be
+	if err := cfg.Validate(be); err != nil {
+		report.fail("credentials", fault.Config, err.Error(), "run `tuya config --backend "+be+"` or set the TUYA_* env vars")
+		return report
+	}
+	report.add("credentials", doctorPass, "required "+be+" settings present", "")
+
+	switch be {
+	case "ha":
+		diagnoseHA(report, cfg)
+	case "cloud":
+		diagnoseCloud(report, cfg, probe)
+	}
+	return report
+}
+
+func checkConfigFile(report *doctorReport, path string) {
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.add("config file", doctorWarn, path+" not found; relying on environment variables", "run `tuya config` to create it")
+		return
+	case err != nil:
+		report.fail("config file", fault.Config, err.Error(), "check permissions on "+path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		report.fail("config file", fault.Config, err.Error(), "make "+path+" readable by the current user")
+		return
+	}
+	f.Close()
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		report.add("config file", doctorWarn, fmt.Sprintf("%s is readable by other users (%04o)", path, mode), "chmod 600 "+path)
+		return
+	}
+	report.add("config file", doctorPass, fmt.Sprintf("%s (%04o)", path, info.Mode().Perm()), "")
+}
+
+func diagnoseHA(report *doctorReport, cfg *config.Config) {
+	client := haClient(cfg)
+	msg, err := client.Ping()
+	if err != nil {
+		var statusErr *ha.StatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.Code == 401:
+			report.fail("ha token", fault.Auth, "Home Assistant rejected the token", "create a new long-lived access token in your HA profile and update homeAssistant.token")
+		case errors.As(err, &statusErr) && statusErr.Code == 404:
+			report.fail("ha reachable", fault.Config, "no Home Assistant API at "+cfg.HomeAssistant.URL+"/api/", "point homeAssistant.url at the HA base URL (e.g. http://homeassistant.local:8123)")
+		default:
+			report.fail("ha reachable", classify(err).Kind, err.Error(), "check homeAssistant.url and that HA is reachable from this host")
+		}
+		return
+	}
+	report.add("ha reachable", doctorPass, cfg.HomeAssistant.URL+": "+msg, "")
+	report.add("ha token", doctorPass, "token accepted", "")
+
+	states, err := client.States()
+	if err != nil {
+		report.fail("ha states", classify(err).Kind, err.Error(), "grant the token's user access to entities")
+		return
+	}
+	if len(states) == 0 {
+		report.add("ha states", doctorWarn, "no entities returned", "check that the Tuya integration is set up in Home Assistant")
+		return
+	}
+	report.add("ha states", doctorPass, fmt.Sprintf("%d entities", len(states)), "")
+}
+
+func diagnoseCloud(report *doctorReport, cfg *config.Config, probe bool) {
+	client := cloudClient(cfg)
+	started := time.Now()
+	tok, err := client.RequestToken()
+	checkClockSkew(report, client, started)
+
+	regionSuspect := false
+	if err != nil {
+		name, fix := cloudFix(err)
+		if name == "region" {
+			regionSuspect = true
+		}
+		report.fail("token grant", classify(err).Kind, fmt.Sprintf("%s: %v", client.Endpoint(), err), fix)
+	} else {
+		report.add("token grant", doctorPass, fmt.Sprintf("%s (uid %s)", client.Endpoint(), tok.UID), "")
+		devices, err := client.GetDevices()
+		switch {
+		case err != nil:
+			_, fix := cloudFix(err)
+			report.fail("devices", classify(err).Kind, err.Error(), fix)
+			regionSuspect = true
+		case len(devices) == 0:
+			report.add("devices", doctorWarn, "token works but the user has no devices",
+				"link the Smart Life / Tuya app account to the project (Devices > Link App Account) or set cloud.userId")
+			regionSuspect = true
+		default:
+			report.add("devices", doctorPass, fmt.Sprintf("%d devices linked", len(devices)), "")
+		}
+	}
+
+	if !regionSuspect && !probe {
+		return
+	}
+	report.Regions = cloud.ProbeRegions(cfg.Cloud.AccessID, cfg.Cloud.AccessKey, cfg.Cloud.UserID)
+	checkRegion(report, client.Endpoint())
+}
+
+func checkClockSkew(report *doctorReport, client *cloud.Client, started time.Time) {
+	server := client.ServerTime()
+	if server.IsZero() {
+		report.add("clock skew", doctorSkip, "no server timestamp received", "")
+		return
+	}
+	// Compare against the midpoint of the request to absorb latency.
+	local := started.Add(time.Since(started) / 2)
+	skew := local.Sub(server)
+	if skew < 0 {
+		skew = -skew
+	}
+	msg := fmt.Sprintf("local clock differs from Tuya by %s", skew.Round(time.Millisecond))
+	switch {
+	case skew > clockSkewFail:
+		report.fail("clock skew", fault.Auth, msg, "sync the system clock (enable NTP); Tuya rejects signatures with stale timestamps")
+	case skew > clockSkewWarn:
+		report.add("clock skew", doctorWarn, msg, "sync the system clock (enable NTP)")
+	default:
+		report.add("clock skew", doctorPass, msg, "")
+	}
+}
+
+// cloudFix maps common Tuya error codes to the setting that is usually wrong.
+func cloudFix(err error) (string, string) {
+	var apiErr *cloud.APIError
+	if !errors.As(err, &apiErr) {
+		return "network", "check cloud.endpoint and network connectivity"
+	}
+	switch apiErr.Code {
+	case 1004:
+		return "sign", "cloud.accessKey is wrong (copy the Access Secret from the project overview)"
+	case 1005, 2009:
+		return "region", "cloud.accessId is unknown at this endpoint; check the Access ID or the data center"
+	case 1010, 1011:
+		return "token", "remove the token cache and retry"
+	case 1013:
+		return "clock", "sync the system clock (enable NTP)"
+	case 1106:
+		return "region", "link the app account to the project and make sure cloud.userId belongs to it"
+	case 28841105, 28841002:
+		return "subscription", "authorize the IoT Core API service for the project (or renew the trial)"
+	}
+	return "api", "see the Tuya error code documentation"
+}
+
+func checkRegion(report *doctorReport, current string) {
+	current = strings.TrimRight(current, "/")
+	best, ok := cloud.BestProbe(report.Regions)
+	switch {
+	case !ok:
+		report.add("data center", doctorWarn, "no known data center returned devices for these credentials",
+			"link the app account in the Tuya project and check the Access ID/Secret")
+	case best.URL == current:
+		report.add("data center", doctorPass, fmt.Sprintf("%s (%s) has %d devices", best.Label, best.URL, best.Devices), "")
+	default:
+		report.fail("data center", fault.Config, fmt.Sprintf("%s (%s) has %d devices, not %s", best.Label, best.URL, best.Devices, current),
+			"set cloud.endpoint: "+best.URL+" (or auto)")
+	}
+}
+
+func printDoctorReport(r *doctorReport) {
+	fmt.Printf("Config:  %s\n", r.Config)
+	if r.Profile != "" {
+		fmt.Printf("Profile: %s\n", r.Profile)
+	}
+	fmt.Printf("Backend: %s\n\n", r.Backend)
+	for _, c := range r.Checks {
+		fmt.Printf("[%s] %-14s %s\n", strings.ToUpper(c.Status), c.Name, c.Message)
+		if c.Fix != "" && c.Status != doctorPass {
+			fmt.Printf("       %-14s fix: %s\n", "", c.Fix)
+		}
+	}
+	if len(r.Regions) > 0 {
+		fmt.Println("")
+		fmt.Printf("%-34s %-18s %-6s %-8s %s\n", "ENDPOINT", "REGION", "TOKEN", "DEVICES", "ERROR")
+		for _, p := range r.Regions {
+			token := "no"
+			if p.Token {
+				token = "yes"
+			}
+			fmt.Printf("%-34s %-18s %-6s %-8d %s\n", p.URL, p.Label, token, p.Devices, p.Error)
+		}
+	}
+	fmt.Println("")
+	if r.OK {
+		fmt.Println("All checks passed.")
+	} else {
+		fmt.Println("Some checks failed; see the fixes above.")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/fault"
+)
+
+func TestDiagnoseHARejectedToken(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("401: Unauthorized"))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "backend: ha\nhomeAssistant:\n  url: " + upstream.URL + "\n  token: bad\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	t.Setenv("TUYA_PROFILE", "")
+
+	report := diagnose(path, "", false)
+	if report.OK {
+		t.Fatalf("expected failure, got %+v", report.Checks)
+	}
+	statuses := map[string]string{}
+	for _, c := range report.Checks {
+		statuses[c.Name] = c.Status
+		if c.Status == doctorFail && c.Fix == "" {
+			t.Fatalf("failure without fix: %+v", c)
+		}
+	}
+	if statuses["config file"] != doctorWarn {
+		t.Fatalf("expected permission warning, got %v", statuses)
+	}
+	if statuses["secrets"] != doctorWarn {
+		t.Fatalf("expected plaintext warning, got %v", statuses)
+	}
+	if statuses["ha token"] != doctorFail {
+		t.Fatalf("expected token failure, got %v", statuses)
+	}
+	if code := report.exitCode(); code != fault.Auth.ExitCode() {
+		t.Fatalf("expected the auth exit code, got %d", code)
+	}
+}
+
+func TestDiagnoseCloudUsesConfiguredClient(t *testing.T) {
+	var lang string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result any = []map[string]any{{"id": "plug1", "name": "Kettle plug", "category": "cz"}}
+		if r.URL.Path == "/v1.0/token" {
+			lang = r.Header.Get("lang")
+			result = map[string]any{"access_token": "tok", "expire_time": 7200, "uid": "u"}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "t": time.Now().UnixMilli(), "result": result})
+	}))
+	defer upstream.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("TUYA_PROFILE", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "backend: cloud\ncloud:\n  accessId: id\n  accessKey: key\n  endpoint: " + upstream.URL + "\n  userId: u\n  lang: de\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	report := diagnose(path, "", false)
+	if !report.OK || lang != "de" {
+		t.Fatalf("expected a passing report sent with lang de, got lang %q and %+v", lang, report.Checks)
+	}
+	if report.exitCode() != 0 {
+		t.Fatalf("expected exit code 0 for a passing report")
+	}
+}
+
+func TestCheckRegionSuggestsEndpoint(t *testing.T) {
+	report := &doctorReport{Regions: []cloud.Probe{
+		{Region: cloud.Region{URL: "https://openapi.tuyaus.com"}, Token: true},
+		{Region: cloud.Region{URL: "https://openapi.tuyaeu.com", Label: "Central Europe"}, Token: true, Devices: 3},
+	}}
+	checkRegion(report, "https://openapi.tuyaus.com/")
+	c := report.Checks[0]
+	if c.Status != doctorFail || c.Fix != "set cloud.endpoint: https://openapi.tuyaeu.com (or auto)" {
+		t.Fatalf("unexpected check: %+v", c)
+	}
+
+	report.Checks = nil
+	checkRegion(report, "https://openapi.tuyaeu.com")
+	if report.Checks[0].Status != doctorPass {
+		t.Fatalf("expected pass, got %+v", report.Checks[0])
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/energy"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/sensor"
+	"tuya-hub/internal/units"
+	"tuya-hub/internal/util"
+)
+
+// Energy sources accepted by energy report --source (cloud backend).
+const (
+	sourceAuto  = "auto"
+	sourceStats = "stats"
+	sourceLogs  = "logs"
+)
+
+func runEnergy(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runEnergyReport(args)
+		return
+	}
+	switch args[0] {
+	case "report":
+		runEnergyReport(args[1:])
+	case "live":
+		runEnergyLive(args[1:])
+	default:
+		fatal(fault.New(fault.Usage, "unknown energy subcommand: %s (want report or live)", args[0]))
+	}
+}
+
+// powerReading is the live electrical state of one plug or meter, in W, V
+// and A.
+type powerReading struct {
+	DeviceID string `json:"deviceId"`
+	Name     string `json:"name"`
+	Room     string `json:"room,omitempty"`
+	Power    any    `json:"power_w,omitempty"`
+	Voltage  any    `json:"voltage_v,omitempty"`
+	Current  any    `json:"current_a,omitempty"`
+}
+
+var powerColumns = []output.Column[powerReading]{
+	{Name: "device_id", Value: func(r powerReading) any { return r.DeviceID }},
+	{Name: "name", Value: func(r powerReading) any { return r.Name }},
+	{Name: "room", Value: func(r powerReading) any { return r.Room }},
+	{Name: "power_w", Value: func(r powerReading) any { return r.Power }},
+	{Name: "voltage_v", Value: func(r powerReading) any { return r.Voltage }},
+	{Name: "current_a", Value: func(r powerReading) any { return r.Current }},
+}
+
+var energyDeviceColumns = []output.Column[energy.Row]{
+	{Name: "device_id", Value: func(r energy.Row) any { return r.DeviceID }},
+	{Name: "name", Value: func(r energy.Row) any { return r.Name }},
+	{Name: "room", Value: func(r energy.Row) any { return r.Room }},
+	{Name: "period", Value: func(r energy.Row) any { return r.Period }},
+	{Name: "kwh", Value: func(r energy.Row) any { return r.KWh }},
+	{Name: "cost", Value: func(r energy.Row) any { return r.Cost }},
+}
+
+var energyRoomColumns = []output.Column[energy.Row]{
+	{Name: "room", Value: func(r energy.Row) any { return r.Room }},
+	{Name: "period", Value: func(r energy.Row) any { return r.Period }},
+	{Name: "kwh", Value: func(r energy.Row) any { return r.KWh }},
+	{Name: "cost", Value: func(r energy.Row) any { return r.Cost }},
+}
+
+func runEnergyLive(args []string) {
+	fs := flag.NewFlagSet("energy live", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	filter := fs.String("filter", "", "filter substring")
+	room := fs.String("room", "", "only devices in this room (see rooms in config)")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("energy")
+
+	cfg, be := loadConfig(*configPath, *backend)
+	if err := checkRoom(cfg, *room); err != nil {
+		fatal(err)
+	}
+	kinds := electricKinds(cfg, "power", "voltage", "current")
+	var rows []powerReading
+	switch be {
+	case "ha":
+		states, err := haClient(cfg).States()
+		if err != nil {
+			fatal(err)
+		}
+		for _, r := range filterByKind(filterStates(states, *filter), kinds, units.Prefs{}) {
+			if !inRoom(cfg, r.EntityID, *room) {
+				continue
+			}
+			name, _ := r.Attributes["friendly_name"].(string)
+			row := powerReading{DeviceID: r.EntityID, Name: name, Room: cfg.RoomOf(r.EntityID)}
+			setPower(&row, r.Kind, r.Value)
+			rows = append(rows, row)
+		}
+	case "cloud":
+		client := cloudClient(cfg)
+		devices, err := client.GetDevices()
+		if err != nil {
+			fatal(err)
+		}
+		devices = roomDevices(cfg, filterCloudDevices(devices, *filter), *room)
+		readings, err := pollCloud(client, devices, kinds, units.Prefs{}, client.GetDeviceSpec)
+		if err != nil {
+			fatal(err)
+		}
+		byDevice := map[string]*powerReading{}
+		for _, r := range readings {
+			row, ok := byDevice[r.DeviceID]
+			if !ok {
+				row = &powerReading{DeviceID: r.DeviceID, Name: r.Name, Room: cfg.RoomOf(r.DeviceID)}
+				byDevice[r.DeviceID] = row
+			}
+			setPower(row, r.Kind, r.Value)
+		}
+		for _, row := range byDevice {
+			rows = append(rows, *row)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].DeviceID < rows[j].DeviceID })
+	default:
+		fatal(fault.New(fault.Usage, "energy not implemented for backend %s", be))
+	}
+	if p.IsTable() && len(rows) == 0 {
+		fmt.Println("(no power, voltage or current readings)")
+		return
+	}
+	render(p, rows, powerColumns)
+}
+
+// setPower fills the field of kind unless an earlier DP already did.
+func setPower(r *powerReading, kind string, value any) {
+	var field *any
+	switch kind {
+	case "power":
+		field = &r.Power
+	case "voltage":
+		field = &r.Voltage
+	case "current":
+		field = &r.Current
+	default:
+		return
+	}
+	if *field == nil {
+		*field = value
+	}
+}
+
+func runEnergyReport(args []string) {
+	fs := flag.NewFlagSet("energy report", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	filter := fs.String("filter", "", "filter substring")
+	room := fs.String("room", "", "only devices in this room (see rooms in config)")
+	periodFlag := fs.String("period", "day", "totals per day|week|month")
+	byFlag := fs.String("by", "device", "group totals by device|room|total")
+	fromFlag := fs.String("from", "", "first day, YYYY-MM-DD (default: 7 days, 4 weeks or 3 months back)")
+	toFlag := fs.String("to", "", "last day, YYYY-MM-DD (default today)")
+	source := fs.String("source", sourceAuto, "cloud energy source: auto|stats|logs")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("energy")
+
+	cfg, be := loadConfig(*configPath, *backend)
+	period, err := energy.ParsePeriod(*periodFlag)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	by, err := energy.ParseBy(*byFlag)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	switch *source {
+	case sourceAuto, sourceStats, sourceLogs:
+	default:
+		fatal(fault.New(fault.Usage, "unknown --source %q (want auto, stats or logs)", *source))
+	}
+	if err := checkRoom(cfg, *room); err != nil {
+		fatal(err)
+	}
+	tariff, err := energy.NewTariff(cfg.Tariff)
+	if err != nil {
+		fatal(fault.New(fault.Config, "tariff: %w", err))
+	}
+	loc, _ := scheduleLocation(cfg)
+	from, to, err := reportWindow(period, *fromFlag, *toFlag, time.Now().In(loc))
+	if err != nil {
+		fatal(err)
+	}
+
+	var usage []energy.Usage
+	var skipped []map[string]string
+	warn := func(id string, err error) {
+		skipped = append(skipped, map[string]string{"id": id, "error": err.Error()})
+		if p.IsTable() {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", id, err)
+		}
+	}
+	energyKinds := electricKinds(cfg, "energy")
+	switch be {
+	case "ha":
+		usage, err = haUsage(cfg, haClient(cfg), energyKinds, *filter, *room, from, to)
+	case "cloud":
+		usage, err = cloudUsage(cfg, cloudClient(cfg), energyKinds[0], usageQuery{
+			filter: *filter, room: *room, from: from, to: to, loc: loc,
+			hourly: tariff.TimeOfUse(), source: *source,
+		}, warn)
+	default:
+		err = fault.New(fault.Usage, "energy not implemented for backend %s", be)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	rows := energy.Report(usage, energy.Options{Period: period, By: by, From: from, To: to, Tariff: tariff})
+	totalKWh, totalCost := energy.Totals(rows)
+	p.Meta = map[string]any{
+		"from":      from.Format("2006-01-02"),
+		"to":        to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"period":    period,
+		"by":        by,
+		"total_kwh": totalKWh,
+	}
+	if tariff.Priced() {
+		p.Meta["total_cost"] = totalCost
+		p.Meta["currency"] = tariff.Currency
+	}
+	if len(skipped) > 0 {
+		p.Meta["skipped"] = skipped
+	}
+	if p.IsTable() && len(rows) == 0 {
+		fmt.Println("(no energy data for this range)")
+		return
+	}
+	render(p, rows, energyColumns(by, tariff.Priced()))
+	if p.IsTable() && !p.NoHeader {
+		total := fmt.Sprintf("total: %v kWh", totalKWh)
+		if tariff.Priced() {
+			total += strings.TrimRight(fmt.Sprintf(", %v %s", totalCost, tariff.Currency), " ")
+		}
+		fmt.Printf("%s (%s to %s)\n", total, p.Meta["from"], p.Meta["to"])
+	}
+}
+
+// energyColumns picks the report columns for a grouping; cost is left out
+// when no tariff is configured.
+func energyColumns(by string, priced bool) []output.Column[energy.Row] {
+	cols := energyDeviceColumns
+	switch by {
+	case energy.ByRoom:
+		cols = energyRoomColumns
+	case energy.ByTotal:
+		cols = energyRoomColumns[1:]
+	}
+	if !priced {
+		cols = cols[:len(cols)-1]
+	}
+	return cols
+}
+
+// reportWindow resolves --from/--to (inclusive days) to [from, to), falling
+// back to the default window of period.
+func reportWindow(period, fromFlag, toFlag string, now time.Time) (time.Time, time.Time, error) {
+	from, to := energy.Window(period, now)
+	if s := strings.TrimSpace(fromFlag); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, now.Location())
+		if err != nil {
+			return from, to, fault.New(fault.Usage, "--from: want YYYY-MM-DD, got %q", s)
+		}
+		from = t
+	}
+	if s := strings.TrimSpace(toFlag); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, now.Location())
+		if err != nil {
+			return from, to, fault.New(fault.Usage, "--to: want YYYY-MM-DD, got %q", s)
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fault.New(fault.Usage, "--from must be before --to")
+	}
+	return from, to, nil
+}
+
+// electricKinds returns the named sensor kinds, honouring overrides in
+// config.
+func electricKinds(cfg *config.Config, names ...string) []sensor.Kind {
+	reg := sensor.NewRegistry(cfg.SensorKinds)
+	out := make([]sensor.Kind, 0, len(names))
+	for _, name := range names {
+		if k, ok := reg.Lookup(name); ok {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// checkRoom rejects a --room that config does not define.
+func checkRoom(cfg *config.Config, room string) error {
+	if room == "" {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Rooms))
+	for name := range cfg.Rooms {
+		if strings.EqualFold(name, room) {
+			return nil
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return fault.New(fault.Config, "no rooms configured").WithHint("list device ids or aliases under rooms: in config")
+	}
+	sort.Strings(names)
+	return fault.New(fault.NotFound, "unknown room %q (known: %s)", room, strings.Join(names, ", "))
+}
+
+func inRoom(cfg *config.Config, id, room string) bool {
+	return room == "" || strings.EqualFold(cfg.RoomOf(id), room)
+}
+
+func roomDevices(cfg *config.Config, devices []cloud.Device, room string) []cloud.Device {
+	if room == "" {
+		return devices
+	}
+	out := make([]cloud.Device, 0, len(devices))
+	for _, dev := range devices {
+		if inRoom(cfg, dev.ID, room) {
+			out = append(out, dev)
+		}
+	}
+	return out
+}
+
+// usageQuery selects the devices and range of a cloud energy report.
+type usageQuery struct {
+	filter, room string
+	from, to     time.Time
+	loc          *time.Location
+	// hourly asks for hourly statistics, which a time-of-use tariff needs.
+	hourly bool
+	source string
+}
+
+// cloudUsage reads the energy DP of every metering device. Devices that
+// fail are reported through warn and left out.
+func cloudUsage(cfg *config.Config, client *cloud.Client, kind sensor.Kind, q usageQuery, warn func(string, error)) ([]energy.Usage, error) {
+	devices, err := client.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	devices = roomDevices(cfg, filterCloudDevices(devices, q.filter), q.room)
+	var out []energy.Usage
+	for _, dev := range devices {
+		statuses, err := client.GetDeviceStatus(dev.ID)
+		if err != nil {
+			warn(dev.ID, err)
+			continue
+		}
+		code := ""
+		for _, st := range statuses {
+			if kind.MatchStatus(dev.Category, st.Code, st.Value) {
+				code = st.Code
+				break
+			}
+		}
+		if code == "" {
+			continue
+		}
+		spec, _ := client.GetDeviceSpec(dev.ID)
+		samples, err := deviceSamples(client, dev.ID, kind, code, spec, q)
+		if err != nil {
+			warn(dev.ID, err)
+			continue
+		}
+		out = append(out, energy.Usage{DeviceID: dev.ID, Name: dev.Name, Room: cfg.RoomOf(dev.ID), Samples: samples})
+	}
+	return out, nil
+}
+
+// deviceSamples reads one device's energy from the statistics service, or
+// from its report log, where each add_ele report is the energy used since
+// the previous one.
+func deviceSamples(client *cloud.Client, id string, kind sensor.Kind, code string, spec *cloud.Spec, q usageQuery) ([]energy.Sample, error) {
+	unit := kind.Unit
+	if spec != nil {
+		if item, ok := spec.StatusItem(code); ok {
+			if values, err := item.Parsed(); err == nil && values.Unit != "" {
+				unit = values.Unit
+			}
+		}
+	}
+	var statsErr error
+	if q.source != sourceLogs {
+		samples, err := statsSamples(client, id, code, unit, q)
+		if err == nil || q.source == sourceStats {
+			return samples, err
+		}
+		statsErr = err
+	}
+	logs, err := client.ReportLogs(id, []string{code}, q.from, q.to)
+	if err != nil {
+		if statsErr != nil {
+			return nil, fmt.Errorf("statistics: %v; report logs: %w", statsErr, err)
+		}
+		return nil, err
+	}
+	points := make([]energy.Point, 0, len(logs))
+	for _, l := range logs {
+		value := l.Value
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				value = f
+			}
+		}
+		scaled, _, from := cloudValue(kind, code, value, spec)
+		f, ok := util.Number(scaled)
+		if !ok {
+			continue
+		}
+		kwh, err := units.Convert(f, from, "kWh")
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, energy.Point{Time: time.UnixMilli(l.EventTime).In(q.loc), Value: kwh})
+	}
+	return energy.FromIncrements(points), nil
+}
+
+func statsSamples(client *cloud.Client, id, code, unit string, q usageQuery) ([]energy.Sample, error) {
+	var values map[string]float64
+	var err error
+	layout := "20060102"
+	if q.hourly {
+		layout = "2006010215"
+		values, err = client.StatisticsHours(id, code, q.from, q.to.Add(-time.Hour))
+	} else {
+		values, err = client.StatisticsDays(id, code, q.from, q.to.AddDate(0, 0, -1))
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]energy.Sample, 0, len(values))
+	for key, v := range values {
+		start, err := time.ParseInLocation(layout, key, q.loc)
+		if err != nil {
+			return nil, fmt.Errorf("statistics key %q: %w", key, err)
+		}
+		kwh, err := units.Convert(v, unit, "kWh")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, energy.Sample{Start: start, KWh: kwh})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, nil
+}
+
+// haUsage derives hourly energy from the recorded history of HA energy
+// sensors, which count up and reset now and then.
+func haUsage(cfg *config.Config, client *ha.Client, kinds []sensor.Kind, filter, room string, from, to time.Time) ([]energy.Usage, error) {
+	states, err := client.States()
+	if err != nil {
+		return nil, err
+	}
+	meters := map[string]haReading{}
+	var ids []string
+	for _, r := range filterByKind(filterStates(states, filter), kinds, units.Prefs{}) {
+		if !inRoom(cfg, r.EntityID, room) || !units.Convertible(r.OriginalUnit, "kWh") {
+			continue
+		}
+		meters[r.EntityID] = r
+		ids = append(ids, r.EntityID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	history, err := client.History(ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]energy.Usage, 0, len(ids))
+	for _, id := range ids {
+		meter := meters[id]
+		var points []energy.Point
+		for _, st := range history[id] {
+			f, err := strconv.ParseFloat(st.State, 64)
+			if err != nil {
+				continue
+			}
+			kwh, err := units.Convert(f, meter.OriginalUnit, "kWh")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			points = append(points, energy.Point{Time: st.LastChanged.In(from.Location()), Value: kwh})
+		}
+		name, _ := meter.Attributes["friendly_name"].(string)
+		out = append(out, energy.Usage{DeviceID: id, Name: name, Room: cfg.RoomOf(id), Samples: energy.FromCumulative(points)})
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/safety"
+)
+
+// cloudErrorKinds maps Tuya OpenAPI error codes to fault kinds. Codes not
+// listed are Internal.
+var cloudErrorKinds = map[int]fault.Kind{
+	1001:     fault.Auth,       // secret invalid
+	1002:     fault.Auth,       // access_token is null
+	1004:     fault.Auth,       // sign invalid
+	1005:     fault.Auth,       // clientId invalid
+	1010:     fault.Auth,       // token invalid
+	1011:     fault.Auth,       // token expired
+	1013:     fault.Auth,       // request time invalid (clock skew)
+	2009:     fault.Auth,       // client not found in this data center
+	1106:     fault.Permission, // permission deny
+	28841105: fault.Permission, // API not authorized for the project
+	28841002: fault.Permission, // cloud plan expired
+	1108:     fault.NotFound,   // uri path invalid
+	2017:     fault.NotFound,   // app schema does not exist
+	2001:     fault.Offline,    // device is offline
+	1100:     fault.Validation, // param is empty
+	1101:     fault.Validation, // param range invalid
+	1102:     fault.Validation, // param is null
+	1104:     fault.Validation, // type is incorrect
+	1109:     fault.Validation, // param is illegal
+	2003:     fault.Validation, // function not supported
+	2008:     fault.Validation, // command or value not supported
+	1110:     fault.RateLimit,  // concurrent requests over limit
+}
+
+// classify sorts err into the fault taxonomy, looking through wrapping for
+// backend errors and safety refusals. Errors already classified with
+// fault.New or fault.Wrap keep their kind.
+func classify(err error) *fault.Error {
+	var classified *fault.Error
+	var refusal *safety.Refusal
+	var apiErr *cloud.APIError
+	var statusErr *ha.StatusError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &classified):
+	case errors.As(err, &refusal):
+		fe := fault.Wrap(fault.Permission, err)
+		fe.Hint = refusal.Hint
+		if fe.Hint == "" && refusal.NeedsConfirm {
+			fe.Hint = "pass --yes to confirm"
+		}
+		fe.Details = refusal
+		return fe
+	case errors.As(err, &apiErr):
+		kind, ok := cloudErrorKinds[apiErr.Code]
+		if !ok {
+			kind = fault.Internal
+		}
+		fe := fault.Wrap(kind, err)
+		switch label, fix := cloudFix(err); {
+		case apiErr.Code == 2001:
+			fe.Hint = "check the device's power and Wi-Fi connection"
+		case label != "api":
+			fe.Hint = fix
+		}
+		fe.Details = map[string]any{"code": apiErr.Code, "msg": apiErr.Msg}
+		return fe
+	case errors.As(err, &statusErr):
+		kind, hint := haErrorKind(statusErr.Code)
+		fe := fault.Wrap(kind, err).WithHint(hint)
+		fe.Details = map[string]any{"status": statusErr.Code}
+		return fe
+	}
+	return fault.As(err)
+}
+
+func haErrorKind(status int) (fault.Kind, string) {
+	switch {
+	case status == http.StatusUnauthorized:
+		return fault.Auth, "homeAssistant.token is wrong or expired; create a new long-lived access token"
+	case status == http.StatusForbidden:
+		return fault.Permission, "the Home Assistant user lacks access (admin rights are needed for some services)"
+	case status == http.StatusNotFound:
+		return fault.NotFound, "check the entity id (tuya discover lists them)"
+	case status == http.StatusBadRequest:
+		return fault.Validation, ""
+	case status == http.StatusTooManyRequests:
+		return fault.RateLimit, "slow down and retry"
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		return fault.Network, "Home Assistant or a proxy in front of it is unavailable"
+	}
+	return fault.Internal, ""
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/safety"
+)
+
+func TestClassify(t *testing.T) {
+	refusal := &safety.Refusal{Action: safety.Action{Kind: "set", Entity: "switch.heater"}, Rule: "safety.confirm", Reason: "needs confirmation", NeedsConfirm: true}
+	cases := []struct {
+		err  error
+		kind fault.Kind
+		hint bool
+	}{
+		{&cloud.APIError{Code: 2001, Msg: "device is offline"}, fault.Offline, true},
+		{fmt.Errorf("status: %w", &cloud.APIError{Code: 1010, Msg: "token invalid"}), fault.Auth, true},
+		{&cloud.APIError{Code: 2008, Msg: "command or value not support"}, fault.Validation, false},
+		{&cloud.APIError{Code: 9999, Msg: "?"}, fault.Internal, false},
+		{&ha.StatusError{Code: http.StatusNotFound, Body: "Entity not found."}, fault.NotFound, true},
+		{&ha.StatusError{Code: http.StatusUnauthorized}, fault.Auth, true},
+		{refusal, fault.Permission, true},
+		{fault.New(fault.Usage, "--entity required"), fault.Usage, false},
+		{fmt.Errorf("device x: %w", errNotFound), fault.NotFound, false},
+	}
+	for _, c := range cases {
+		fe := classify(c.err)
+		if fe.Kind != c.kind {
+			t.Fatalf("%v: expected %s, got %s", c.err, c.kind, fe.Kind)
+		}
+		if fe.Message != c.err.Error() {
+			t.Fatalf("expected message %q, got %q", c.err.Error(), fe.Message)
+		}
+		if (fe.Hint != "") != c.hint {
+			t.Fatalf("%v: unexpected hint %q", c.err, fe.Hint)
+		}
+	}
+	if fe := classify(refusal); fe.Details != refusal {
+		t.Fatalf("expected refusal details, got %v", fe.Details)
+	}
+}
+
+func TestHTTPStatusFor(t *testing.T) {
+	if got := httpStatusFor(fmt.Errorf("device x: %w", errNotFound)); got != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", got)
+	}
+	if got := httpStatusFor(fault.New(fault.Usage, "commands required")); got != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", got)
+	}
+	if got := httpStatusFor(&safety.Refusal{Rule: "safety.readOnly"}); got != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", got)
+	}
+	if got := httpStatusFor(&cloud.APIError{Code: 2001}); got != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", got)
+	}
+	if got := httpStatusFor(fault.New(fault.Config, "units.system: bad")); got != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", got)
+	}
+}
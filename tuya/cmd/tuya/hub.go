@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/safety"
+)
+
+// hub wraps one backend for long-running modes (serve, mcp) so that clients,
+// tokens and the device inventory stay warm between requests.
+type hub struct {
+	cfg     *config.Config
+	backend string
+	ttl     time.Duration
+
+	ha     *ha.Client
+	cloud  *cloud.Client
+	policy *safety.Policy
+
+	mu          sync.Mutex
+	devices     []cloud.Device
+	states      []ha.State
+	inventoryAt time.Time
+	specs       map[string]*cloud.Spec
+}
+
+type cloudDeviceStatus struct {
+	Device cloud.Device   `json:"device"`
+	Status []cloud.Status `json:"status"`
+}
+
+var errNotFound = &fault.Error{Kind: fault.NotFound, Message: "not found"}
+
+func newHub(cfg *config.Config, backend string, ttl time.Duration) *hub {
+	h := &hub{cfg: cfg, backend: backend, ttl: ttl, policy: safety.New(cfg.Safety)}
+	switch backend {
+	case "ha":
+		h.ha = haClient(cfg)
+	case "cloud":
+		h.cloud = cloudClient(cfg)
+	}
+	return h
+}
+
+// refresh reloads the inventory when it is older than the TTL.
+func (h *hub) refresh(force bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !force && !h.inventoryAt.IsZero() && time.Since(h.inventoryAt) < h.ttl {
+		return nil
+	}
+	switch h.backend {
+	case "ha":
+		states, err := h.ha.States()
+		if err != nil {
+			return err
+		}
+		h.states = states
+	case "cloud":
+		devices, err := h.cloud.GetDevices()
+		if err != nil {
+			return err
+		}
+		h.devices = devices
+	default:
+		return fmt.Errorf("backend %s not supported", h.backend)
+	}
+	h.inventoryAt = time.Now()
+	return nil
+}
+
+func (h *hub) Devices(filter string) (any, error) {
+	if err := h.refresh(false); err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.backend == "ha" {
+		return filterStates(h.states, filter), nil
+	}
+	return filterCloudDevices(h.devices, filter), nil
+}
+
+func (h *hub) Device(id string) (any, error) {
+	id = h.cfg.ResolveAlias(id)
+	if strings.TrimSpace(id) == "" {
+		return nil, fault.New(fault.Usage, "device id required")
+	}
+	if h.backend == "ha" {
+		return h.ha.State(id)
+	}
+	if err := h.refresh(false); err != nil {
+		return nil, err
+	}
+	dev, ok := h.cloudDevice(id)
+	if !ok {
+		return nil, fmt.Errorf("device %s: %w", id, errNotFound)
+	}
+	statuses, err := h.cloud.GetDeviceStatus(id)
+	if err != nil {
+		return nil, err
+	}
+	return cloudDeviceStatus{Device: dev, Status: statuses}, nil
+}
+
+func (h *hub) cloudDevice(id string) (cloud.Device, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, dev := range h.devices {
+		if dev.ID == id {
+			return dev, true
+		}
+	}
+	return cloud.Device{}, false
+}
+
+// SendCommands sends Tuya DP commands on the cloud backend. On HA, a single
+// {"code":"state","value":"on|off"} command maps to turn_on/turn_off.
+func (h *hub) SendCommands(id string, commands []map[string]any) (map[string]any, error) {
+	id = h.cfg.ResolveAlias(id)
+	if strings.TrimSpace(id) == "" {
+		return nil, fault.New(fault.Usage, "device id required")
+	}
+	if len(commands) == 0 {
+		return nil, fault.New(fault.Usage, "commands required")
+	}
+	if h.backend == "cloud" {
+		codes := make([]string, 0, len(commands))
+		for _, cmd := range commands {
+			codes = append(codes, fmt.Sprint(cmd["code"]))
+		}
+		if err := h.check(safety.Action{Kind: "command", DeviceID: id, Codes: codes}); err != nil {
+			return nil, err
+		}
+		return h.cloud.SendCommands(id, commands)
+	}
+	if len(commands) != 1 || commands[0]["code"] != "state" {
+		return nil, fault.New(fault.Usage, `ha backend only accepts [{"code":"state","value":"on|off"}]`)
+	}
+	domain := ha.DomainFromEntity(id)
+	if domain == "" {
+		return nil, fault.New(fault.Usage, "could not infer domain from entity id")
+	}
+	service := "turn_off"
+	if strings.EqualFold(fmt.Sprint(commands[0]["value"]), "on") || commands[0]["value"] == true {
+		service = "turn_on"
+	}
+	if err := h.check(safety.Action{Kind: "set", Entity: id, Service: domain + "." + service}); err != nil {
+		return nil, err
+	}
+	return h.ha.CallService(domain, service, map[string]any{"entity_id": id})
+}
+
+// check applies the safety policy. Long-running modes cannot prompt, so
+// actions that need confirmation are refused.
+func (h *hub) check(a safety.Action) error {
+	if a.DeviceID != "" && a.DeviceName == "" {
+		if dev, ok := h.cloudDevice(a.DeviceID); ok {
+			a.DeviceName = dev.Name
+		}
+	}
+	return h.policy.Check(a)
+}
+
+// Poll reads sensors of the comma-separated kinds (default temperature) in
+// the given unit system (default from config).
+func (h *hub) Poll(kind, system string) (any, error) {
+	kinds, err := pollKinds(h.cfg, []string{kind})
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := pollUnits(h.cfg, system)
+	if err != nil {
+		return nil, err
+	}
+	if h.backend == "ha" {
+		if err := h.refresh(true); err != nil {
+			return nil, err
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return filterByKind(h.states, kinds, prefs), nil
+	}
+	if err := h.refresh(false); err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	devices := append([]cloud.Device(nil), h.devices...)
+	h.mu.Unlock()
+	return pollCloud(h.cloud, devices, kinds, prefs, h.Spec)
+}
+
+// SetState switches a device on or off. On the cloud backend the first
+// switch-like DP reported by the device is used.
+func (h *hub) SetState(id string, on bool) (map[string]any, error) {
+	id = h.cfg.ResolveAlias(id)
+	if h.backend == "ha" {
+		state := "off"
+		if on {
+			state = "on"
+		}
+		return h.SendCommands(id, []map[string]any{{"code": "state", "value": state}})
+	}
+	statuses, err := h.cloud.GetDeviceStatus(id)
+	if err != nil {
+		return nil, err
+	}
+	code := switchCode(statuses)
+	if code == "" {
+		return nil, fault.New(fault.Validation, "device %s has no switch code", id)
+	}
+	return h.SendCommands(id, []map[string]any{{"code": code, "value": on}})
+}
+
+func switchCode(statuses []cloud.Status) string {
+	for _, preferred := range []string{"switch", "switch_1", "switch_led", "switch_on"} {
+		for _, st := range statuses {
+			if st.Code == preferred {
+				return st.Code
+			}
+		}
+	}
+	for _, st := range statuses {
+		if _, ok := st.Value.(bool); ok && strings.HasPrefix(st.Code, "switch") {
+			return st.Code
+		}
+	}
+	return ""
+}
+
+// Spec returns the cached device specification (cloud only).
+func (h *hub) Spec(id string) (*cloud.Spec, error) {
+	if h.backend != "cloud" {
+		return nil, fault.New(fault.Usage, "device specs not available for backend %s", h.backend)
+	}
+	h.mu.Lock()
+	if spec, ok := h.specs[id]; ok {
+		h.mu.Unlock()
+		return spec, nil
+	}
+	h.mu.Unlock()
+	spec, err := h.cloud.GetDeviceSpec(id)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	if h.specs == nil {
+		h.specs = map[string]*cloud.Spec{}
+	}
+	h.specs[id] = spec
+	h.mu.Unlock()
+	return spec, nil
+}
+
+// RunScene activates a HA scene entity, or triggers a Tuya tap-to-run scene
+// in the given home.
+func (h *hub) RunScene(homeID, sceneID string) (map[string]any, error) {
+	if h.backend == "ha" {
+		if !strings.Contains(sceneID, ".") {
+			sceneID = "scene." + sceneID
+		}
+		return h.CallService("scene", "turn_on", map[string]any{"entity_id": sceneID})
+	}
+	if err := h.check(safety.Action{Kind: "scene", DeviceID: sceneID}); err != nil {
+		return nil, err
+	}
+	if err := h.cloud.TriggerScene(homeID, sceneID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"triggered": sceneID}, nil
+}
+
+func (h *hub) CallService(domain, service string, payload map[string]any) (map[string]any, error) {
+	if h.backend != "ha" {
+		return nil, fault.New(fault.Usage, "call not implemented for backend %s", h.backend)
+	}
+	if err := h.check(callAction(domain+"."+service, payload)); err != nil {
+		return nil, err
+	}
+	return h.ha.CallService(domain, service, payload)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/light"
+	"tuya-hub/internal/safety"
+)
+
+func runLight(args []string) {
+	fs := flag.NewFlagSet("light", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	entity := fs.String("entity", "", "light entity id (ha)")
+	deviceID := fs.String("id", "", "device id (cloud)")
+	on := fs.Bool("on", false, "switch on (implied by any other setting)")
+	off := fs.Bool("off", false, "switch off")
+	color := fs.String("color", "", "colour: #ff8800, 255,136,0 or a name such as orange")
+	brightness := fs.Int("brightness", 0, "brightness percent, 1-100")
+	ct := fs.String("ct", "", "white colour temperature: 2700K-6500K, or warm|neutral|cool|daylight")
+	scene := fs.String("scene", "", "scene: "+strings.Join(light.SceneNames(), "|")+" or scene_data_v2 JSON (cloud); effect name (ha)")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("light")
+
+	if *on && *off {
+		fatal(fault.New(fault.Usage, "--on and --off are exclusive"))
+	}
+	req, err := lightRequest(fs, *off, *color, *brightness, *ct, *scene)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	if !*on && !*off && req.Color == nil && req.Brightness == nil && req.Kelvin == 0 && req.Scene == "" {
+		fatal(fault.New(fault.Usage, "nothing to do: pass --on, --off, --color, --brightness, --ct or --scene"))
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	switch be {
+	case "ha":
+		if strings.TrimSpace(*entity) == "" {
+			fatal(fault.New(fault.Usage, "--entity required"))
+		}
+		if domain := ha.DomainFromEntity(*entity); domain != "light" {
+			fatal(fault.New(fault.Usage, "%s is not a light entity", *entity))
+		}
+		service, data := req.HAService()
+		guard(cfg, safety.Action{Kind: "set", Entity: *entity, Service: "light." + service}, *yes, machine(p))
+		data["entity_id"] = *entity
+		res, err := haClient(cfg).CallService("light", service, data)
+		if err != nil {
+			fatal(err)
+		}
+		delete(data, "entity_id")
+		result := actionResult{Target: *entity, Action: "light." + service, Value: data, Result: res}
+		renderObject(p, result, func() {
+			fmt.Printf("%s light.%s\n", *entity, service)
+		})
+	case "cloud":
+		id := strings.TrimSpace(*deviceID)
+		if id == "" {
+			id = strings.TrimSpace(*entity)
+		}
+		if id == "" {
+			fatal(fault.New(fault.Usage, "--id required for cloud backend"))
+		}
+		client := cloudClient(cfg)
+		spec, err := client.GetDeviceSpec(id)
+		if err != nil {
+			fatal(err)
+		}
+		commands, err := light.Commands(spec, req)
+		if err != nil {
+			fatal(fault.Wrap(fault.Validation, err))
+		}
+		codes := make([]string, 0, len(commands))
+		for _, c := range commands {
+			codes = append(codes, c["code"].(string))
+		}
+		guard(cfg, cloudAction(cfg, client, "set", id, codes...), *yes, machine(p))
+		res, err := client.SendCommands(id, commands)
+		if err != nil {
+			fatal(err)
+		}
+		result := actionResult{Target: id, Action: strings.Join(codes, ","), Value: commands, Result: res}
+		renderObject(p, result, func() {
+			fmt.Printf("sent %s %s\n", id, strings.Join(codes, " "))
+		})
+	default:
+		fatal(fault.New(fault.Usage, "light not implemented for backend %s", be))
+	}
+}
+
+// lightRequest parses the light flags. Brightness is only set when the flag
+// was given, so 0 is reported as out of range rather than ignored.
+func lightRequest(fs *flag.FlagSet, off bool, color string, brightness int, ct, scene string) (light.Request, error) {
+	req := light.Request{Off: off, Scene: strings.TrimSpace(scene)}
+	if strings.TrimSpace(color) != "" {
+		c, err := light.ParseColor(color)
+		if err != nil {
+			return req, err
+		}
+		req.Color = &c
+	}
+	if strings.TrimSpace(ct) != "" {
+		k, err := light.ParseKelvin(ct)
+		if err != nil {
+			return req, err
+		}
+		req.Kelvin = k
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "brightness" {
+			req.Brightness = &brightness
+		}
+	})
+	return req, req.Validate()
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"math"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,36 +18,78 @@ import (
 
 	"tuya-hub/internal/cloud"
 	"tuya-hub/internal/config"
+	"tuya-hub/internal/countdown"
+	"tuya-hub/internal/fault"
 	"tuya-hub/internal/ha"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/plan"
+	"tuya-hub/internal/safety"
+	"tuya-hub/internal/sensor"
+	"tuya-hub/internal/trace"
+	"tuya-hub/internal/units"
 	"tuya-hub/internal/util"
 )
 
 const version = "0.3.0"
 
 func main() {
-	if len(os.Args) < 2 {
+	args, err := extractGlobalFlags(os.Args[1:])
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	if len(args) < 1 {
 		usage()
-		os.Exit(1)
+		os.Exit(fault.Usage.ExitCode())
 	}
+	setupTransport()
 
-	cmd := os.Args[1]
+	cmd := args[0]
+	if isDryRun() && (cmd == "serve" || cmd == "mcp") {
+		fatal(fault.New(fault.Usage, "--dry-run is not supported for %s", cmd))
+	}
 	switch cmd {
 	case "discover":
-		runDiscover(os.Args[2:])
+		runDiscover(args[1:])
 	case "devices":
-		runDiscover(os.Args[2:])
+		runDiscover(args[1:])
 	case "poll":
-		runPoll(os.Args[2:])
+		runPoll(args[1:])
+	case "energy":
+		runEnergy(args[1:])
 	case "get":
-		runGet(os.Args[2:])
+		runGet(args[1:])
 	case "set":
-		runSet(os.Args[2:])
+		runSet(args[1:])
+	case "apply":
+		runApply(args[1:])
+	case "snapshot":
+		runSnapshot(args[1:])
 	case "call":
-		runCall(os.Args[2:])
+		runCall(args[1:])
+	case "light":
+		runLight(args[1:])
+	case "cover":
+		runCover(args[1:])
+	case "countdown":
+		runCountdown(args[1:])
+	case "climate":
+		runClimate(args[1:])
 	case "users":
-		runUsers(os.Args[2:])
+		runUsers(args[1:])
 	case "config":
-		runConfig(os.Args[2:])
+		runConfig(args[1:])
+	case "profiles":
+		runProfiles(args[1:])
+	case "schedule":
+		runSchedule(args[1:])
+	case "api":
+		runAPI(args[1:])
+	case "doctor":
+		runDoctor(args[1:])
+	case "serve":
+		runServe(args[1:])
+	case "mcp":
+		runMCP(args[1:])
 	case "version", "--version", "-v":
 		fmt.Println(version)
 	case "help", "-h", "--help":
@@ -51,45 +97,132 @@ func main() {
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
 		usage()
-		os.Exit(1)
+		os.Exit(fault.Usage.ExitCode())
+	}
+}
+
+// extractGlobalFlags removes flags that apply to every command (--profile,
+// --dry-run, --trace) from anywhere before a bare "--". They are exported as
+// TUYA_PROFILE, TUYA_DRY_RUN and TUYA_DEBUG so that child processes
+// (schedules) inherit them.
+func extractGlobalFlags(args []string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			out = append(out, args[i:]...)
+			break
+		}
+		switch {
+		case a == "--profile" || a == "-profile":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--profile requires a value")
+			}
+			os.Setenv("TUYA_PROFILE", args[i+1])
+			i++
+		case strings.HasPrefix(a, "--profile=") || strings.HasPrefix(a, "-profile="):
+			os.Setenv("TUYA_PROFILE", a[strings.Index(a, "=")+1:])
+		case a == "--dry-run" || a == "-dry-run":
+			os.Setenv("TUYA_DRY_RUN", "1")
+		case a == "--trace" || a == "-trace":
+			os.Setenv("TUYA_DEBUG", "1")
+		default:
+			out = append(out, a)
+		}
 	}
+	return out, nil
 }
 
 func usage() {
 	fmt.Println("tuya-hub CLI (Go)")
 	fmt.Println("")
 	fmt.Println("Usage:")
-	fmt.Println("  tuya config [--backend cloud|ha] [--config <path>]")
+	fmt.Println("  tuya config [--backend cloud|ha] [--detect-region] [--config <path>] [--profile <name>]")
+	fmt.Println("  tuya config --non-interactive --backend cloud --access-id <id> --access-key <key> --endpoint <url|auto> [--user-id <uid>] [--no-test]")
+	fmt.Println("  tuya config --non-interactive --backend ha --ha-url <url> --ha-token <token> [--no-test]")
+	fmt.Println("  tuya config show|path|validate [--json]")
+	fmt.Println("  tuya config migrate")
+	fmt.Println("  tuya config get <key> [--reveal]")
+	fmt.Println("  tuya config set <key> <value>")
+	fmt.Println("  tuya profiles list [--json]")
+	fmt.Println("  tuya doctor [--backend ha|cloud] [--probe-regions] [--json]")
 	fmt.Println("  tuya users --schema <schema> [--try-common] [--json]")
 	fmt.Println("  tuya discover [--backend ha|cloud] [--filter <text>] [--json]")
 	fmt.Println("  tuya devices [--backend ha|cloud] [--filter <text>] [--json]")
-	fmt.Println("  tuya poll --kind temperature|humidity [--backend ha|cloud] [--json]")
+	fmt.Println("  tuya poll --kind temperature|humidity|all [--units metric|imperial] [--backend ha|cloud] [--json]")
+	fmt.Println("  tuya energy [report] [--period day|week|month] [--by device|room|total] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--room <name>] [--json]")
+	fmt.Println("  tuya energy live [--filter <text>] [--room <name>] [--json]")
 	fmt.Println("  tuya get --entity <entity_id> [--json]")
 	fmt.Println("  tuya get --backend cloud --id <device_id> [--code <status_code>] [--json]")
-	fmt.Println("  tuya set --entity <entity_id> --state on|off")
-	fmt.Println("  tuya set --backend cloud --id <device_id> --code <command_code> --value <json>")
-	fmt.Println("  tuya call --service <domain.service> [--data <json>] [--json]")
+	fmt.Println("  tuya set --entity <entity_id> --state on|off [--wait [timeout]] [--verify] [--yes]")
+	fmt.Println("  tuya set --backend cloud --id <device_id> --code <command_code> --value <json> [--code ... --value ...] [--wait [timeout]] [--verify] [--yes]")
+	fmt.Println("  tuya set [--filter <text>] [--room <room>] [--category <category|domain>] [--group <group>] --code ... --value ...|--state on|off [--concurrency <n>] [--yes]")
+	fmt.Println("  tuya apply -f <plan.yaml> [--concurrency <n>] [--wait [timeout]] [--yes]")
+	fmt.Println("  tuya snapshot save <name> [--filter <text>] [--room <room>] [--category <category|domain>] [--group <group>]")
+	fmt.Println("  tuya snapshot diff <a> <b> | list")
+	fmt.Println("  tuya snapshot restore <name> [--dry-run] [--concurrency <n>] [--yes]")
+	fmt.Println("  tuya light --id <device_id>|--entity <light.x> [--on|--off] [--color <#rrggbb|r,g,b|name>] [--brightness <1-100>] [--ct <2700K>] [--scene <name>] [--yes]")
+	fmt.Println("  tuya climate status [--id <device_id>|--entity <climate.x>]")
+	fmt.Println("  tuya climate set --id <device_id>|--entity <climate.x> [--target <21.5|70F>] [--mode <heat|auto|off>] [--preset <eco>] [--yes]")
+	fmt.Println("  tuya cover open|close|stop|position <0-100> --id <device_id>|--entity <cover.x> [--channel <n>] [--yes]")
+	fmt.Println("  tuya countdown --id <device_id> [--channel <n>] [--minutes <m>] [--yes]")
+	fmt.Println("  tuya call --service <domain.service> [--data <json>] [--yes] [--json]")
+	fmt.Println("  tuya api <METHOD> <path> [--query k=v]... [--body <json>|@file|@-] [--header k=v]... [--lang <code>] [--paginate] [--backend ha|cloud] [--yes]")
+	fmt.Println("  tuya schedule add --name <name> --at <cron|sunset-30m> -- <command args>")
+	fmt.Println("  tuya schedule list [--json]")
+	fmt.Println("  tuya schedule rm --name <name>")
+	fmt.Println("  tuya schedule run [--catch-up skip|once|all] [--once]")
+	fmt.Println("  tuya serve [--listen 127.0.0.1:8765] [--backend ha|cloud] [--cache-ttl 60s]")
+	fmt.Println("  tuya mcp [--backend ha|cloud]")
 	fmt.Println("  tuya version")
 	fmt.Println("")
+	fmt.Println("Global flags:")
+	fmt.Println("  --profile <name>   use a named profile from the config (or TUYA_PROFILE)")
+	fmt.Println("  --dry-run          print write requests instead of sending them (or TUYA_DRY_RUN=1)")
+	fmt.Println("  --trace            log every HTTP request/response to stderr (or TUYA_DEBUG=1)")
+	fmt.Println("")
 	fmt.Println("Config:")
-	fmt.Println("  - default: ~/.config/tuya-hub/config.yaml")
+	fmt.Println("  - default: ~/.config/tuya-hub/config.yaml (or TUYA_CONFIG)")
 	fmt.Println("  - env: TUYA_BACKEND, TUYA_HA_URL, TUYA_HA_TOKEN,")
 	fmt.Println("         TUYA_CLOUD_ACCESS_ID, TUYA_CLOUD_ACCESS_KEY,")
-	fmt.Println("         TUYA_CLOUD_ENDPOINT, TUYA_CLOUD_SCHEMA, TUYA_CLOUD_USER_ID")
+	fmt.Println("         TUYA_CLOUD_ENDPOINT, TUYA_CLOUD_SCHEMA, TUYA_CLOUD_USER_ID, TUYA_CLOUD_LANG,")
+	fmt.Println("         TUYA_SERVER_TOKEN, TUYA_PROFILE, TUYA_VAULT_PASSPHRASE")
+	fmt.Println("  - secrets: plain values or env:VAR, file:/path, cmd:<command>, vault:<key>")
 }
 
-func loadConfig(path, backendOverride string) (*config.Config, string) {
+// readConfig loads the config file and prints unknown-key warnings to
+// stderr. An older layout is migrated in memory and written back by the
+// first command that saves the config (or tuya config migrate); tuya doctor
+// reports it until then.
+func readConfig(path string) (*config.Config, error) {
 	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fault.Wrap(fault.Config, err)
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	return cfg, nil
+}
+
+func loadConfig(path, backendOverride string) (*config.Config, string) {
+	cfg, err := readConfig(path)
 	if err != nil {
 		fatal(err)
 	}
+	if err := cfg.UseProfile(""); err != nil {
+		fatal(fault.Wrap(fault.Config, err).WithHint("tuya profiles lists the configured profiles"))
+	}
+	if err := cfg.ResolveSecrets(secretResolver(cfg)); err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
 	cfg.ApplyEnv()
 	backend := backendOverride
 	if backend == "" {
 		backend = cfg.BackendOr("ha")
 	}
 	if err := cfg.Validate(backend); err != nil {
-		fatal(err)
+		fatal(fault.Wrap(fault.Config, err).WithHint("run tuya config (or tuya doctor to diagnose)"))
 	}
 	return cfg, backend
 }
@@ -99,7 +232,19 @@ func haClient(cfg *config.Config) *ha.Client {
 }
 
 func cloudClient(cfg *config.Config) *cloud.Client {
-	return cloud.New(cfg.Cloud.Endpoint, cfg.Cloud.AccessID, cfg.Cloud.AccessKey, cfg.Cloud.UserID)
+	client := cloud.New(cfg.Cloud.Endpoint, cfg.Cloud.AccessID, cfg.Cloud.AccessKey, cfg.Cloud.UserID)
+	client.SetOptions(cloud.Options{
+		Lang:    cfg.Cloud.Lang,
+		AreaID:  cfg.Cloud.AreaID,
+		Mode:    cfg.Cloud.Mode,
+		Headers: cfg.Cloud.Headers,
+	})
+	if cfg.Active != "" {
+		if dir, err := config.DefaultDir(); err == nil {
+			client.SetTokenCachePath(filepath.Join(dir, "token-"+cfg.Active+".json"))
+		}
+	}
+	return client
 }
 
 func runDiscover(args []string) {
@@ -107,8 +252,9 @@ func runDiscover(args []string) {
 	configPath := fs.String("config", "", "config path")
 	backend := fs.String("backend", "", "backend (ha|cloud)")
 	filter := fs.String("filter", "", "filter substring")
-	jsonOut := fs.Bool("json", false, "json output")
+	out := addOutputFlags(fs)
 	fs.Parse(args)
+	p := out.printer("discover")
 
 	cfg, be := loadConfig(*configPath, *backend)
 	switch be {
@@ -118,55 +264,155 @@ func runDiscover(args []string) {
 		if err != nil {
 			fatal(err)
 		}
-
-		filtered := filterStates(states, *filter)
-		if *jsonOut {
-			writeJSON(filtered)
-			return
-		}
-
-		fmt.Printf("%-40s %-12s %s\n", "ENTITY", "STATE", "FRIENDLY_NAME")
-		for _, st := range filtered {
-			name, _ := st.Attributes["friendly_name"].(string)
-			fmt.Printf("%-40s %-12s %s\n", st.EntityID, st.State, name)
-		}
+		render(p, filterStates(states, *filter), stateColumns)
 	case "cloud":
 		client := cloudClient(cfg)
 		devices, err := client.GetDevices()
 		if err != nil {
 			fatal(err)
 		}
-		filtered := filterCloudDevices(devices, *filter)
-		if *jsonOut {
-			writeJSON(filtered)
-			return
+		render(p, filterCloudDevices(devices, *filter), deviceColumns)
+	default:
+		fatal(fault.New(fault.Usage, "discover not implemented for backend %s", be))
+	}
+}
+
+var stateColumns = []output.Column[ha.State]{
+	{Name: "entity", Value: func(st ha.State) any { return st.EntityID }},
+	{Name: "state", Value: func(st ha.State) any { return st.State }},
+	{Name: "friendly_name", Value: func(st ha.State) any { return st.Attributes["friendly_name"] }},
+}
+
+var deviceColumns = []output.Column[cloud.Device]{
+	{Name: "device_id", Value: func(d cloud.Device) any { return d.ID }},
+	{Name: "name", Value: func(d cloud.Device) any { return d.Name }},
+	{Name: "category", Value: func(d cloud.Device) any { return d.Category }},
+	{Name: "online", Value: func(d cloud.Device) any { return d.Online }},
+}
+
+var sensorColumns = []output.Column[haReading]{
+	{Name: "entity", Value: func(r haReading) any { return r.EntityID }},
+	{Name: "kind", Value: func(r haReading) any { return r.Kind }},
+	{Name: "state", Value: func(r haReading) any { return r.State }},
+	{Name: "value", Value: func(r haReading) any { return r.Value }},
+	{Name: "unit", Value: func(r haReading) any { return r.Unit }},
+	{Name: "original", Value: func(r haReading) any { return originalCell(r.OriginalValue, r.OriginalUnit, r.Unit) }},
+}
+
+var readingColumns = []output.Column[cloudReading]{
+	{Name: "device_id", Value: func(r cloudReading) any { return r.DeviceID }},
+	{Name: "name", Value: func(r cloudReading) any { return r.Name }},
+	{Name: "kind", Value: func(r cloudReading) any { return r.Kind }},
+	{Name: "code", Value: func(r cloudReading) any { return r.Code }},
+	{Name: "value", Value: func(r cloudReading) any { return r.Value }},
+	{Name: "unit", Value: func(r cloudReading) any { return r.Unit }},
+	{Name: "original", Value: func(r cloudReading) any { return originalCell(r.OriginalValue, r.OriginalUnit, r.Unit) }},
+	{Name: "raw", Value: func(r cloudReading) any { return r.Raw }},
+}
+
+// statusRow is a DP in get output. Remaining is set on countdown DPs that
+// are running.
+type statusRow struct {
+	cloud.Status
+	Remaining string `json:"remaining,omitempty"`
+}
+
+var statusColumns = []output.Column[statusRow]{
+	{Name: "code", Value: func(st statusRow) any { return st.Code }},
+	{Name: "value", Value: func(st statusRow) any { return st.Value }},
+}
+
+var remainingColumn = output.Column[statusRow]{Name: "remaining", Value: func(st statusRow) any { return st.Remaining }}
+
+// statusRows pairs each DP with its remaining countdown time, and reports
+// whether any timer is running. spec may be nil.
+func statusRows(statuses []cloud.Status, spec *cloud.Spec) ([]statusRow, bool) {
+	remaining := map[string]string{}
+	for _, t := range countdown.Timers(statuses, spec) {
+		if t.Remaining > 0 {
+			remaining[t.Code] = countdown.Format(t.Remaining)
 		}
-		fmt.Printf("%-30s %-30s %-12s %s\n", "DEVICE_ID", "NAME", "CATEGORY", "ONLINE")
-		for _, dev := range filtered {
-			fmt.Printf("%-30s %-30s %-12s %v\n", dev.ID, dev.Name, dev.Category, dev.Online)
+	}
+	rows := make([]statusRow, 0, len(statuses))
+	for _, st := range statuses {
+		rows = append(rows, statusRow{Status: st, Remaining: remaining[st.Code]})
+	}
+	return rows, len(remaining) > 0
+}
+
+// timerSpec fetches the spec of a device that reports countdown DPs, so
+// their unit is known. Without one the timers are read as seconds.
+func timerSpec(client *cloud.Client, id string, statuses []cloud.Status) *cloud.Spec {
+	for _, st := range statuses {
+		if _, ok := countdown.Channel(st.Code); ok {
+			spec, _ := client.GetDeviceSpec(id)
+			return spec
 		}
-	default:
-		fatal(fmt.Errorf("discover not implemented for backend %s", be))
 	}
+	return nil
 }
 
+var kindColumns = []output.Column[sensor.Kind]{
+	{Name: "kind", Value: func(k sensor.Kind) any { return k.Name }},
+	{Name: "unit", Value: func(k sensor.Kind) any { return k.Unit }},
+	{Name: "device_classes", Value: func(k sensor.Kind) any { return strings.Join(k.DeviceClasses, ",") }},
+	{Name: "codes", Value: func(k sensor.Kind) any { return strings.Join(k.Codes, ",") }},
+}
+
+// haReading is an HA entity matched by poll, tagged with its kind. Value
+// and Unit are converted to the preferred units; State and OriginalValue
+// are what HA reported.
+type haReading struct {
+	EntityID      string         `json:"entity_id"`
+	Kind          string         `json:"kind"`
+	State         string         `json:"state"`
+	Value         any            `json:"value"`
+	Unit          string         `json:"unit,omitempty"`
+	OriginalValue any            `json:"original_value"`
+	OriginalUnit  string         `json:"original_unit,omitempty"`
+	Attributes    map[string]any `json:"attributes"`
+}
+
+// cloudReading is a Tuya DP matched by poll. Raw is the integer the device
+// sent when it had to be scaled; OriginalValue is the scaled value in the
+// device's own unit.
 type cloudReading struct {
-	DeviceID string      `json:"deviceId"`
-	Name     string      `json:"name"`
-	Code     string      `json:"code"`
-	Value    interface{} `json:"value"`
-	Raw      interface{} `json:"value_raw,omitempty"`
+	DeviceID      string      `json:"deviceId"`
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	Code          string      `json:"code"`
+	Value         interface{} `json:"value"`
+	Unit          string      `json:"unit,omitempty"`
+	OriginalValue interface{} `json:"original_value"`
+	OriginalUnit  string      `json:"original_unit,omitempty"`
+	Raw           interface{} `json:"value_raw,omitempty"`
 }
 
 func runPoll(args []string) {
 	fs := flag.NewFlagSet("poll", flag.ExitOnError)
 	configPath := fs.String("config", "", "config path")
 	backend := fs.String("backend", "", "backend (ha|cloud)")
-	kind := fs.String("kind", "temperature", "temperature|humidity")
-	jsonOut := fs.Bool("json", false, "json output")
+	var kindFlags multiFlag
+	fs.Var(&kindFlags, "kind", "sensor kind, repeatable or comma-separated, or all (default temperature; see --list-kinds)")
+	listKinds := fs.Bool("list-kinds", false, "list the known sensor kinds and exit")
+	system := fs.String("units", "", "unit system: metric|imperial (default units.system, else metric)")
+	out := addOutputFlags(fs)
 	fs.Parse(args)
+	p := out.printer("poll")
 
 	cfg, be := loadConfig(*configPath, *backend)
+	if *listKinds {
+		render(p, sensor.NewRegistry(cfg.SensorKinds).Kinds(), kindColumns)
+		return
+	}
+	kinds, err := pollKinds(cfg, kindFlags)
+	if err != nil {
+		fatal(err)
+	}
+	prefs, err := pollUnits(cfg, *system)
+	if err != nil {
+		fatal(err)
+	}
 	switch be {
 	case "ha":
 		client := haClient(cfg)
@@ -175,61 +421,83 @@ func runPoll(args []string) {
 			fatal(err)
 		}
 
-		filtered := filterByKind(states, *kind)
-		if *jsonOut {
-			writeJSON(filtered)
-			return
-		}
-
-		fmt.Printf("%-40s %-12s %s\n", "ENTITY", "STATE", "UNIT")
-		for _, st := range filtered {
-			unit, _ := st.Attributes["unit_of_measurement"].(string)
-			fmt.Printf("%-40s %-12s %s\n", st.EntityID, st.State, unit)
-		}
+		render(p, filterByKind(states, kinds, prefs), sensorColumns)
 	case "cloud":
 		client := cloudClient(cfg)
 		devices, err := client.GetDevices()
 		if err != nil {
 			fatal(err)
 		}
-		readings := make([]cloudReading, 0)
-		for _, dev := range devices {
-			statuses, err := client.GetDeviceStatus(dev.ID)
-			if err != nil {
-				fatal(err)
-			}
-			for _, st := range filterCloudStatuses(statuses, *kind) {
-				val, raw := scaleCloudValue(st.Code, st.Value)
-				readings = append(readings, cloudReading{
-					DeviceID: dev.ID,
-					Name:     dev.Name,
-					Code:     st.Code,
-					Value:    val,
-					Raw:      raw,
-				})
-			}
+		readings, err := pollCloud(client, devices, kinds, prefs, client.GetDeviceSpec)
+		if err != nil {
+			fatal(err)
 		}
-		sort.Slice(readings, func(i, j int) bool {
-			if readings[i].DeviceID == readings[j].DeviceID {
-				return readings[i].Code < readings[j].Code
-			}
-			return readings[i].DeviceID < readings[j].DeviceID
-		})
-		if *jsonOut {
-			writeJSON(readings)
-			return
+		render(p, readings, readingColumns)
+	default:
+		fatal(fault.New(fault.Usage, "poll not implemented for backend %s", be))
+	}
+}
+
+// pollKinds resolves --kind values against the built-in and configured
+// sensor kinds. No value means temperature.
+func pollKinds(cfg *config.Config, values []string) ([]sensor.Kind, error) {
+	if strings.TrimSpace(strings.Join(values, "")) == "" {
+		values = []string{"temperature"}
+	}
+	kinds, err := sensor.NewRegistry(cfg.SensorKinds).Select(values)
+	if err != nil {
+		return nil, fault.Wrap(fault.Usage, err)
+	}
+	return kinds, nil
+}
+
+// pollCloud reads the DPs of kinds from every device. Values are scaled by
+// the device spec (fetched through spec only for devices with a match) and
+// converted to prefs; a °F twin such as temp_current_f is folded into its
+// °C DP.
+func pollCloud(client *cloud.Client, devices []cloud.Device, kinds []sensor.Kind, prefs units.Prefs, spec func(string) (*cloud.Spec, error)) ([]cloudReading, error) {
+	readings := make([]cloudReading, 0)
+	for _, dev := range devices {
+		statuses, err := client.GetDeviceStatus(dev.ID)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("%-30s %-30s %-20s %s\n", "DEVICE_ID", "NAME", "CODE", "VALUE")
-		for _, r := range readings {
-			val := fmt.Sprintf("%v", r.Value)
-			if r.Raw != nil {
-				val = fmt.Sprintf("%v (raw %v)", r.Value, r.Raw)
+		var devSpec *cloud.Spec
+		fetched := false
+		for _, st := range statuses {
+			kind, ok := sensor.CodeKind(kinds, dev.Category, st.Code, st.Value)
+			if !ok {
+				continue
+			}
+			if !fetched {
+				// A missing spec is not fatal: values fall back to the
+				// code-based heuristics.
+				devSpec, _ = spec(dev.ID)
+				fetched = true
 			}
-			fmt.Printf("%-30s %-30s %-20s %s\n", r.DeviceID, r.Name, r.Code, val)
+			orig, raw, unit := cloudValue(kind, st.Code, st.Value, devSpec)
+			val, valUnit := convertReading(prefs, kind, orig, unit)
+			readings = append(readings, cloudReading{
+				DeviceID:      dev.ID,
+				Name:          dev.Name,
+				Kind:          kind.Name,
+				Code:          st.Code,
+				Value:         val,
+				Unit:          valUnit,
+				OriginalValue: orig,
+				OriginalUnit:  unit,
+				Raw:           raw,
+			})
 		}
-	default:
-		fatal(fmt.Errorf("poll not implemented for backend %s", be))
 	}
+	readings = collapseTwins(readings)
+	sort.Slice(readings, func(i, j int) bool {
+		if readings[i].DeviceID == readings[j].DeviceID {
+			return readings[i].Code < readings[j].Code
+		}
+		return readings[i].DeviceID < readings[j].DeviceID
+	})
+	return readings, nil
 }
 
 func runGet(args []string) {
@@ -239,60 +507,62 @@ func runGet(args []string) {
 	entity := fs.String("entity", "", "entity id")
 	deviceID := fs.String("id", "", "device id (cloud)")
 	code := fs.String("code", "", "status code (cloud)")
-	jsonOut := fs.Bool("json", false, "json output")
+	out := addOutputFlags(fs)
 	fs.Parse(args)
+	p := out.printer("get")
 
 	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
 	switch be {
 	case "ha":
 		if strings.TrimSpace(*entity) == "" {
-			fatal(fmt.Errorf("--entity required"))
+			fatal(fault.New(fault.Usage, "--entity required"))
 		}
 		client := haClient(cfg)
 		st, err := client.State(*entity)
 		if err != nil {
 			fatal(err)
 		}
-		if *jsonOut {
-			writeJSON(st)
-			return
-		}
-		fmt.Printf("%s = %s\n", st.EntityID, st.State)
+		renderObject(p, st, func() {
+			fmt.Printf("%s = %s\n", st.EntityID, st.State)
+		})
 	case "cloud":
 		id := strings.TrimSpace(*deviceID)
 		if id == "" {
 			id = strings.TrimSpace(*entity)
 		}
 		if id == "" {
-			fatal(fmt.Errorf("--id required for cloud backend"))
+			fatal(fault.New(fault.Usage, "--id required for cloud backend"))
 		}
 		client := cloudClient(cfg)
 		statuses, err := client.GetDeviceStatus(id)
 		if err != nil {
 			fatal(err)
 		}
+		rows, timers := statusRows(statuses, timerSpec(client, id, statuses))
 		if strings.TrimSpace(*code) != "" {
-			for _, st := range statuses {
+			for _, st := range rows {
 				if st.Code == *code {
-					if *jsonOut {
-						writeJSON(st)
-						return
-					}
-					fmt.Printf("%s %s = %v\n", id, st.Code, st.Value)
+					renderObject(p, st, func() {
+						if st.Remaining != "" {
+							fmt.Printf("%s %s = %v (%s remaining)\n", id, st.Code, st.Value, st.Remaining)
+							return
+						}
+						fmt.Printf("%s %s = %v\n", id, st.Code, st.Value)
+					})
 					return
 				}
 			}
-			fatal(fmt.Errorf("status code not found: %s", *code))
+			fatal(fault.New(fault.NotFound, "status code not found: %s", *code))
 		}
-		if *jsonOut {
-			writeJSON(statuses)
-			return
-		}
-		for _, st := range statuses {
-			fmt.Printf("%s %s = %v\n", id, st.Code, st.Value)
+		cols := statusColumns
+		if timers {
+			cols = append(cols[:len(cols):len(cols)], remainingColumn)
 		}
+		render(p, rows, cols)
 	default:
-		fatal(fmt.Errorf("get not implemented for backend %s", be))
+		fatal(fault.New(fault.Usage, "get not implemented for backend %s", be))
 	}
 }
 
@@ -303,73 +573,108 @@ func runSet(args []string) {
 	entity := fs.String("entity", "", "entity id")
 	deviceID := fs.String("id", "", "device id (cloud)")
 	state := fs.String("state", "", "on|off")
-	code := fs.String("code", "", "command code (cloud)")
-	value := fs.String("value", "", "command value (cloud; json)")
-	jsonOut := fs.Bool("json", false, "json output")
-	fs.Parse(args)
+	var codes, values multiFlag
+	fs.Var(&codes, "code", "command code (cloud; repeatable, paired with --value)")
+	fs.Var(&values, "value", "command value (cloud; json; repeatable)")
+	var sel plan.Selector
+	fs.StringVar(&sel.Filter, "filter", "", "fan out to devices whose id or name contains this")
+	fs.StringVar(&sel.Room, "room", "", "fan out to devices in this room (see rooms in config)")
+	fs.StringVar(&sel.Category, "category", "", "fan out to devices of this Tuya category (cloud) or domain (ha)")
+	fs.StringVar(&sel.Group, "group", "", "fan out to the devices of this group (see groups in config)")
+	concurrency := fs.Int("concurrency", plan.DefaultConcurrency, "targets written at once when fanning out")
+	yes := fs.Bool("yes", false, "confirm fan-out and actions that need confirmation")
+	var wait waitFlag
+	fs.Var(&wait, "wait", "poll until the device reports the new value; optional timeout (default 10s)")
+	verifyFlag := fs.Bool("verify", false, "read back and report the value the device reports")
+	out := addOutputFlags(fs)
+	parseWithWait(fs, args, &wait)
+	p := out.printer("set")
 
 	cfg, be := loadConfig(*configPath, *backend)
+	*entity = cfg.ResolveAlias(*entity)
+	*deviceID = cfg.ResolveAlias(*deviceID)
+	step := plan.Step{Selector: sel}
 	switch be {
 	case "ha":
-		if strings.TrimSpace(*entity) == "" {
-			fatal(fmt.Errorf("--entity required"))
-		}
 		if *state == "" {
-			fatal(fmt.Errorf("--state required (on|off)"))
+			fatal(fault.New(fault.Usage, "--state required (on|off)"))
 		}
-
-		domain := ha.DomainFromEntity(*entity)
-		if domain == "" {
-			fatal(fmt.Errorf("could not infer domain from entity id"))
+		step.State = strings.ToLower(*state)
+		if !sel.FanOut() {
+			if strings.TrimSpace(*entity) == "" {
+				fatal(fault.New(fault.Usage, "--entity required"))
+			}
+			if ha.DomainFromEntity(*entity) == "" {
+				fatal(fault.New(fault.Usage, "could not infer domain from entity id"))
+			}
 		}
-
-		service := "turn_off"
-		if strings.ToLower(*state) == "on" {
-			service = "turn_on"
+		step.ID = *entity
+	case "cloud":
+		if len(codes) == 0 {
+			fatal(fault.New(fault.Usage, "--code required for cloud backend"))
 		}
-
-		payload := map[string]any{"entity_id": *entity}
-		client := haClient(cfg)
-		res, err := client.CallService(domain, service, payload)
-		if err != nil {
-			fatal(err)
+		if len(values) != len(codes) {
+			fatal(fault.New(fault.Usage, "--value required for each --code (got %d codes, %d values)", len(codes), len(values)))
 		}
-		if *jsonOut {
-			writeJSON(res)
-			return
+		for i, code := range codes {
+			if strings.TrimSpace(code) == "" {
+				fatal(fault.New(fault.Usage, "--code must not be empty"))
+			}
+			v, err := util.ParseJSONValue(values[i])
+			if err != nil {
+				fatal(fault.Wrap(fault.Usage, fmt.Errorf("--value for %s: %w", code, err)))
+			}
+			step.Commands = append(step.Commands, plan.Command{Code: code, Value: v})
 		}
-		fmt.Printf("%s %s\n", *entity, service)
-	case "cloud":
 		id := strings.TrimSpace(*deviceID)
 		if id == "" {
 			id = strings.TrimSpace(*entity)
 		}
-		if id == "" {
-			fatal(fmt.Errorf("--id required for cloud backend"))
-		}
-		if strings.TrimSpace(*code) == "" {
-			fatal(fmt.Errorf("--code required for cloud backend"))
+		if id == "" && !sel.FanOut() {
+			fatal(fault.New(fault.Usage, "--id required for cloud backend").WithHint("or select devices with --filter, --room, --category or --group"))
 		}
-		if strings.TrimSpace(*value) == "" {
-			fatal(fmt.Errorf("--value required for cloud backend"))
+		step.ID = id
+	default:
+		fatal(fault.New(fault.Usage, "set not implemented for backend %s", be))
+	}
+	if step.ID != "" && sel.FanOut() {
+		fatal(fault.New(fault.Usage, "--id/--entity cannot be combined with --filter, --room, --category or --group"))
+	}
+
+	w := writer{cfg: cfg, backend: be, wait: wait, verify: *verifyFlag}
+	jobs, err := w.jobs(step, "")
+	if err != nil {
+		fatal(err)
+	}
+	if sel.FanOut() {
+		confirmFanOut([][]job{jobs}, "set", *yes, machine(p))
+		for _, j := range jobs {
+			guard(cfg, j.action, *yes, machine(p))
 		}
-		v, err := util.ParseJSONValue(*value)
-		if err != nil {
-			fatal(err)
+		reportJobs(p, runJobs([][]job{jobs}, *concurrency), targetColumns[1:], len(jobs))
+		return
+	}
+
+	j := jobs[0]
+	guard(cfg, j.action, *yes, machine(p))
+	result, err := j.run()
+	if err != nil {
+		fatal(err)
+	}
+	renderObject(p, result, func() {
+		if be == "cloud" {
+			fmt.Printf("sent %s %s\n", result.Target, strings.Join(codes, " "))
+		} else {
+			fmt.Printf("%s %s\n", result.Target, strings.TrimPrefix(result.Action, ha.DomainFromEntity(result.Target)+"."))
 		}
-		client := cloudClient(cfg)
-		res, err := client.SendCommands(id, []map[string]any{{"code": *code, "value": v}})
-		if err != nil {
-			fatal(err)
+		want := result.Value
+		if be == "ha" {
+			want = step.State
 		}
-		if *jsonOut {
-			writeJSON(res)
-			return
+		if line := describeObserved(result, want); line != "" {
+			fmt.Println(line)
 		}
-		fmt.Printf("sent %s %s\n", id, *code)
-	default:
-		fatal(fmt.Errorf("set not implemented for backend %s", be))
-	}
+	})
 }
 
 func runCall(args []string) {
@@ -378,37 +683,44 @@ func runCall(args []string) {
 	backend := fs.String("backend", "", "backend (ha|cloud)")
 	service := fs.String("service", "", "domain.service")
 	data := fs.String("data", "", "json data payload")
-	jsonOut := fs.Bool("json", false, "json output")
+	yes := fs.Bool("yes", false, "confirm actions that need confirmation")
+	out := addOutputFlags(fs)
 	fs.Parse(args)
+	p := out.printer("call")
 
 	if strings.TrimSpace(*service) == "" {
-		fatal(fmt.Errorf("--service required"))
+		fatal(fault.New(fault.Usage, "--service required"))
 	}
 	parts := strings.SplitN(*service, ".", 2)
 	if len(parts) != 2 {
-		fatal(fmt.Errorf("--service must be domain.service"))
+		fatal(fault.New(fault.Usage, "--service must be domain.service"))
 	}
 
 	cfg, be := loadConfig(*configPath, *backend)
 	if be != "ha" {
-		fatal(fmt.Errorf("call not implemented for backend %s", be))
+		fatal(fault.New(fault.Usage, "call not implemented for backend %s", be))
 	}
 
 	payload, err := util.ParseJSONMap(*data)
 	if err != nil {
-		fatal(err)
+		fatal(fault.Wrap(fault.Usage, err))
 	}
+	action := callAction(*service, payload)
+	guard(cfg, action, *yes, machine(p))
 
 	client := haClient(cfg)
 	res, err := client.CallService(parts[0], parts[1], payload)
 	if err != nil {
 		fatal(err)
 	}
-	if *jsonOut {
-		writeJSON(res)
-		return
+	target := action.Entity
+	if target == "" {
+		target = strings.Join(action.Entities, ",")
 	}
-	fmt.Printf("called %s\n", *service)
+	result := actionResult{Target: target, Action: *service, Value: payload, Result: res}
+	renderObject(p, result, func() {
+		fmt.Printf("called %s\n", *service)
+	})
 }
 
 func runUsers(args []string) {
@@ -419,8 +731,9 @@ func runUsers(args []string) {
 	sinceDays := fs.Int("since-days", 30, "days back for user lookup")
 	pageSize := fs.Int("page-size", 100, "page size")
 	pageNo := fs.Int("page", 1, "page number")
-	jsonOut := fs.Bool("json", false, "json output")
+	out := addOutputFlags(fs)
 	fs.Parse(args)
+	p := out.printer("users")
 
 	cfg, _ := loadConfig(*configPath, "cloud")
 	client := cloudClient(cfg)
@@ -433,7 +746,7 @@ func runUsers(args []string) {
 	} else if *tryCommon {
 		schemas = []string{"smartlife", "tuyaSmart", "smart_life", "tuya", "SmartLife"}
 	} else {
-		fatal(fmt.Errorf("schema required (set cloud.schema or --schema, or use --try-common)"))
+		fatal(fault.New(fault.Usage, "schema required (set cloud.schema or --schema, or use --try-common)"))
 	}
 
 	if *sinceDays <= 0 {
@@ -449,19 +762,15 @@ func runUsers(args []string) {
 			lastErr = err
 			continue
 		}
-		if *jsonOut {
-			writeJSON(res)
-			return
+		p.Meta = map[string]any{"schema": sc, "total": res.Total, "page_no": res.PageNo, "page_size": res.PageSize}
+		if p.IsTable() && !p.NoHeader {
+			fmt.Printf("schema: %s (total: %d)\n", sc, res.Total)
 		}
-		fmt.Printf("schema: %s (total: %d)\n", sc, res.Total)
-		if len(res.List) == 0 {
+		if p.IsTable() && len(res.List) == 0 {
 			fmt.Println("(no users returned)")
 			return
 		}
-		fmt.Printf("%-4s %-24s %-14s %s\n", "#", "USERNAME", "COUNTRY", "UID")
-		for i, u := range res.List {
-			fmt.Printf("%-4d %-24s %-14s %s\n", i+1, u.Username, u.CountryCode, u.UID)
-		}
+		render(p, res.List, userColumns)
 		return
 	}
 
@@ -471,23 +780,65 @@ func runUsers(args []string) {
 	fatal(fmt.Errorf("no schemas succeeded"))
 }
 
+var userColumns = []output.Column[cloud.User]{
+	{Name: "username", Value: func(u cloud.User) any { return u.Username }},
+	{Name: "country", Value: func(u cloud.User) any { return u.CountryCode }},
+	{Name: "uid", Value: func(u cloud.User) any { return u.UID }},
+}
+
 func runConfig(args []string) {
+	if runConfigSub(args) {
+		return
+	}
 	fs := flag.NewFlagSet("config", flag.ExitOnError)
 	configPath := fs.String("config", "", "config path")
 	backend := fs.String("backend", "", "backend (ha|cloud)")
+	detectRegion := fs.Bool("detect-region", false, "probe all data centers to find the project's devices")
+	nonInteractive := fs.Bool("non-interactive", false, "take settings from flags and env instead of prompting")
+	noTest := fs.Bool("no-test", false, "skip the connection test (non-interactive)")
+	values := addConfigFlags(fs)
 	fs.Parse(args)
 
-	existing, err := config.Load(*configPath)
+	existing, err := readConfig(*configPath)
 	if err != nil {
 		fatal(err)
 	}
-	if existing == nil {
-		existing = &config.Config{}
-	}
 	cfg := *existing
 
+	// With --profile (or TUYA_PROFILE) the wizard edits that profile only;
+	// so does a config whose default profile holds the credentials.
+	profile := strings.TrimSpace(os.Getenv("TUYA_PROFILE"))
+	if profile == "" && existing.Profiles[existing.Profile] != nil {
+		profile = existing.Profile
+	}
+	if profile != "" {
+		cfg = config.Config{Active: profile}
+		if p := existing.Profiles[profile]; p != nil {
+			cfg.Backend = p.Backend
+			cfg.HomeAssistant = p.HomeAssistant
+			cfg.Cloud = p.Cloud
+		}
+	}
+
+	if *nonInteractive {
+		be := strings.ToLower(strings.TrimSpace(*backend))
+		if be == "" {
+			be = cfg.BackendOr("cloud")
+		}
+		if be != "cloud" && be != "ha" {
+			fatal(fault.New(fault.Usage, "unknown backend: %s", be))
+		}
+		cfg.Backend = be
+		configureNonInteractive(&cfg, be, values, *noTest)
+		saveConfigEdit(*configPath, existing, &cfg, profile)
+		return
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Tuya config wizard")
+	if profile != "" {
+		fmt.Printf("Profile: %s\n", profile)
+	}
 	fmt.Println("")
 
 	be := strings.ToLower(strings.TrimSpace(*backend))
@@ -495,7 +846,7 @@ func runConfig(args []string) {
 		be = strings.ToLower(promptDefault(reader, "Backend (cloud/ha)", cfg.BackendOr("cloud")))
 	}
 	if be != "cloud" && be != "ha" {
-		fatal(fmt.Errorf("unknown backend: %s", be))
+		fatal(fault.New(fault.Usage, "unknown backend: %s", be))
 	}
 	cfg.Backend = be
 
@@ -503,13 +854,23 @@ func runConfig(args []string) {
 		printCloudSteps()
 		cfg.Cloud.AccessID = promptRequired(reader, "Tuya Access ID", cfg.Cloud.AccessID)
 		cfg.Cloud.AccessKey = promptRequired(reader, "Tuya Access Key", cfg.Cloud.AccessKey)
-		cfg.Cloud.Endpoint = promptEndpoint(reader, cfg.Cloud.Endpoint)
+		endpoint, detected := "", false
+		if *detectRegion {
+			endpoint, detected = detectEndpoint(reader, &cfg)
+		}
+		if !detected {
+			endpoint = promptEndpoint(reader, cfg.Cloud.Endpoint)
+		}
+		cfg.Cloud.Endpoint = endpoint
 		cfg.Cloud.Region = promptDefault(reader, "Region label (optional)", inferRegion(cfg.Cloud.Endpoint, cfg.Cloud.Region))
 		cfg.Cloud.Schema = promptDefault(reader, "App schema (optional; for user lookup)", cfg.Cloud.Schema)
 
 		if promptYesNo(reader, "Test Tuya Cloud token now", true) {
-			client := cloudClient(&cfg)
-			tok, err := client.GetToken()
+			var tok *cloud.Token
+			resolved, err := resolvedCopy(&cfg)
+			if err == nil {
+				tok, err = cloudClient(resolved).GetToken()
+			}
 			if err != nil {
 				fmt.Printf("Token test failed: %v\n", err)
 			} else {
@@ -526,8 +887,11 @@ func runConfig(args []string) {
 		}
 
 		if strings.TrimSpace(cfg.Cloud.Schema) != "" && promptYesNo(reader, "Lookup linked app users now", true) {
-			client := cloudClient(&cfg)
-			res, err := client.GetUsers(cfg.Cloud.Schema, 1, 100, 0, 0)
+			var res *cloud.UserList
+			resolved, err := resolvedCopy(&cfg)
+			if err == nil {
+				res, err = cloudClient(resolved).GetUsers(cfg.Cloud.Schema, 1, 100, 0, 0)
+			}
 			if err != nil {
 				fmt.Printf("User lookup failed: %v\n", err)
 			} else if len(res.List) == 0 {
@@ -562,17 +926,142 @@ func runConfig(args []string) {
 	if be == "ha" {
 		cfg.HomeAssistant.URL = promptRequired(reader, "Home Assistant URL", cfg.HomeAssistant.URL)
 		cfg.HomeAssistant.Token = promptRequired(reader, "Home Assistant token", cfg.HomeAssistant.Token)
+		if promptYesNo(reader, "Test Home Assistant connection now", true) {
+			msg, err := testConnection(&cfg, "ha")
+			if err != nil {
+				fmt.Printf("Connection test failed: %v\n", err)
+				if !promptYesNo(reader, "Save anyway", false) {
+					fatal(errors.New("aborted; config not saved"))
+				}
+			} else {
+				fmt.Println(msg)
+			}
+		}
 	}
 
 	if err := cfg.Validate(be); err != nil {
 		fmt.Printf("Warning: %v\n", err)
 	}
 
-	path, err := config.Save(*configPath, &cfg)
+	keyPrefix := ""
+	if profile != "" {
+		keyPrefix = "profiles." + profile + "."
+	}
+	if be == "cloud" {
+		cfg.Cloud.AccessKey = promptSecretStorage(reader, existing, keyPrefix+"cloud.accessKey", "Tuya Access Key", cfg.Cloud.AccessKey)
+	}
+	if be == "ha" {
+		cfg.HomeAssistant.Token = promptSecretStorage(reader, existing, keyPrefix+"homeAssistant.token", "Home Assistant token", cfg.HomeAssistant.Token)
+	}
+
+	saveConfigEdit(*configPath, existing, &cfg, profile)
+}
+
+// saveConfigEdit writes cfg, or stores it as the named profile inside
+// existing when one is being edited.
+func saveConfigEdit(configPath string, existing, cfg *config.Config, profile string) {
+	out := cfg
+	if profile != "" {
+		if existing.Profiles == nil {
+			existing.Profiles = map[string]*config.Profile{}
+		}
+		p := existing.Profiles[profile]
+		if p == nil {
+			p = &config.Profile{}
+			existing.Profiles[profile] = p
+		}
+		p.Backend = cfg.Backend
+		p.HomeAssistant = cfg.HomeAssistant
+		p.Cloud = cfg.Cloud
+		out = existing
+	}
+
+	path, err := config.Save(configPath, out)
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	if profile != "" {
+		fmt.Printf("Wrote profile %s to %s\n", profile, path)
+	} else {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if plain := out.PlaintextSecrets(); len(plain) > 0 {
+		fmt.Printf("Note: stored in plaintext: %s\n", strings.Join(plain, ", "))
+	}
+}
+
+func runProfiles(args []string) {
+	if len(args) > 0 && args[0] == "list" {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("profiles list", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("profiles")
+
+	cfg, err := readConfig(*configPath)
 	if err != nil {
 		fatal(err)
 	}
-	fmt.Printf("Wrote %s\n", path)
+	active := strings.TrimSpace(os.Getenv("TUYA_PROFILE"))
+	if active == "" {
+		active = cfg.Profile
+	}
+
+	type row struct {
+		Name     string `json:"name"`
+		Backend  string `json:"backend"`
+		Target   string `json:"target"`
+		Aliases  int    `json:"aliases"`
+		ReadOnly bool   `json:"readOnly,omitempty"`
+		Active   bool   `json:"active"`
+	}
+	rows := make([]row, 0, len(cfg.Profiles))
+	for _, name := range cfg.ProfileNames() {
+		p := cfg.Profiles[name]
+		if p == nil {
+			continue
+		}
+		backend := p.Backend
+		if backend == "" {
+			backend = cfg.BackendOr("ha")
+		}
+		target := p.Cloud.Endpoint
+		if backend == "ha" {
+			target = p.HomeAssistant.URL
+		}
+		rows = append(rows, row{
+			Name:     name,
+			Backend:  backend,
+			Target:   target,
+			Aliases:  len(p.Aliases),
+			ReadOnly: p.ReadOnly || (p.Safety != nil && p.Safety.ReadOnly),
+			Active:   name == active,
+		})
+	}
+
+	if p.IsTable() && len(rows) == 0 {
+		fmt.Println("(no profiles; add one with: tuya config --profile <name>)")
+		return
+	}
+	render(p, rows, []output.Column[row]{
+		{Name: "active", Value: func(r row) any {
+			if r.Active {
+				return "*"
+			}
+			return ""
+		}},
+		{Name: "name", Value: func(r row) any {
+			if r.ReadOnly {
+				return r.Name + " (ro)"
+			}
+			return r.Name
+		}},
+		{Name: "backend", Value: func(r row) any { return r.Backend }},
+		{Name: "target", Value: func(r row) any { return r.Target }},
+		{Name: "aliases", Value: func(r row) any { return r.Aliases }},
+	})
 }
 
 func filterStates(states []ha.State, filter string) []ha.State {
@@ -590,26 +1079,24 @@ func filterStates(states []ha.State, filter string) []ha.State {
 	return sortStates(out)
 }
 
-func filterByKind(states []ha.State, kind string) []ha.State {
-	kind = strings.ToLower(kind)
-	out := make([]ha.State, 0, len(states))
-	for _, st := range states {
+func filterByKind(states []ha.State, kinds []sensor.Kind, prefs units.Prefs) []haReading {
+	out := make([]haReading, 0, len(states))
+	for _, st := range sortStates(states) {
 		dc, _ := st.Attributes["device_class"].(string)
 		unit, _ := st.Attributes["unit_of_measurement"].(string)
-		if dc == kind {
-			out = append(out, st)
+		kind, ok := sensor.EntityKind(kinds, dc, unit)
+		if !ok {
 			continue
 		}
-		if kind == "temperature" && strings.Contains(unit, "°") {
-			out = append(out, st)
-			continue
-		}
-		if kind == "humidity" && strings.Contains(strings.ToLower(unit), "%") {
-			out = append(out, st)
-			continue
+		r := haReading{EntityID: st.EntityID, Kind: kind.Name, State: st.State, Attributes: st.Attributes}
+		r.OriginalValue, r.OriginalUnit = any(st.State), units.Normalize(unit)
+		if f, err := strconv.ParseFloat(st.State, 64); err == nil {
+			r.OriginalValue = f
 		}
+		r.Value, r.Unit = convertReading(prefs, kind, r.OriginalValue, r.OriginalUnit)
+		out = append(out, r)
 	}
-	return sortStates(out)
+	return out
 }
 
 func filterCloudDevices(devices []cloud.Device, filter string) []cloud.Device {
@@ -626,32 +1113,6 @@ func filterCloudDevices(devices []cloud.Device, filter string) []cloud.Device {
 	return sortCloudDevices(out)
 }
 
-func filterCloudStatuses(statuses []cloud.Status, kind string) []cloud.Status {
-	if strings.TrimSpace(kind) == "" {
-		return statuses
-	}
-	kind = strings.ToLower(kind)
-	out := make([]cloud.Status, 0, len(statuses))
-	for _, st := range statuses {
-		code := strings.ToLower(st.Code)
-		switch kind {
-		case "temperature":
-			if strings.Contains(code, "temp") || strings.Contains(code, "temperature") {
-				out = append(out, st)
-			}
-		case "humidity":
-			if strings.Contains(code, "hum") {
-				out = append(out, st)
-			}
-		default:
-			if strings.Contains(code, kind) {
-				out = append(out, st)
-			}
-		}
-	}
-	return out
-}
-
 func sortStates(states []ha.State) []ha.State {
 	out := append([]ha.State(nil), states...)
 	sort.Slice(out, func(i, j int) bool {
@@ -668,7 +1129,7 @@ func scaleCloudValue(code string, value interface{}) (interface{}, interface{})
 	if !strings.Contains(codeLower, "temp") && !strings.Contains(codeLower, "temperature") {
 		return value, nil
 	}
-	f, ok := toFloat(value)
+	f, ok := util.Number(value)
 	if !ok {
 		return value, nil
 	}
@@ -679,26 +1140,6 @@ func scaleCloudValue(code string, value interface{}) (interface{}, interface{})
 	return value, nil
 }
 
-func toFloat(v interface{}) (float64, bool) {
-	switch t := v.(type) {
-	case float64:
-		return t, true
-	case float32:
-		return float64(t), true
-	case int:
-		return float64(t), true
-	case int64:
-		return float64(t), true
-	case int32:
-		return float64(t), true
-	case json.Number:
-		if f, err := t.Float64(); err == nil {
-			return f, true
-		}
-	}
-	return 0, false
-}
-
 func round1(v float64) float64 {
 	return math.Round(v*10) / 10
 }
@@ -769,7 +1210,7 @@ func printCloudSteps() {
 	fmt.Println("2) Note the Access ID and Access Key on the project Overview.")
 	fmt.Println("3) Link your Tuya app account under Devices -> Link Tuya App Account.")
 	fmt.Println("4) Use the UID from that link screen as userId (not the token uid).")
-	fmt.Println("5) Pick the correct data center endpoint for your region.")
+	fmt.Println("5) Pick the data center endpoint for your region (or pass --detect-region).")
 	fmt.Println("")
 	fmt.Println("If you see permission deny, the app account/UID is not linked to this project.")
 	fmt.Println("")
@@ -777,31 +1218,15 @@ func printCloudSteps() {
 
 func promptEndpoint(reader *bufio.Reader, current string) string {
 	fmt.Println("Choose a Tuya Cloud data center endpoint:")
-	fmt.Println("  1) https://openapi.tuyaus.com   (Western America)")
-	fmt.Println("  2) https://openapi-ueaz.tuyaus.com (Eastern America)")
-	fmt.Println("  3) https://openapi.tuyaeu.com   (Central Europe)")
-	fmt.Println("  4) https://openapi-weaz.tuyaeu.com (Western Europe)")
-	fmt.Println("  5) https://openapi.tuyacn.com   (China)")
-	fmt.Println("  6) https://openapi.tuyain.com   (India)")
-	fmt.Println("  7) https://openapi-sg.iotbing.com (Singapore)")
+	for i, r := range cloud.Regions {
+		fmt.Printf("  %d) %-34s (%s)\n", i+1, r.URL, r.Label)
+	}
+	fmt.Println("  or type auto to detect it on first use")
 	fmt.Println("")
-	choice := promptDefault(reader, "Pick 1-7 or paste endpoint", current)
+	choice := promptDefault(reader, fmt.Sprintf("Pick 1-%d or paste endpoint", len(cloud.Regions)), current)
 	choice = strings.TrimSpace(choice)
-	switch choice {
-	case "1":
-		return "https://openapi.tuyaus.com"
-	case "2":
-		return "https://openapi-ueaz.tuyaus.com"
-	case "3":
-		return "https://openapi.tuyaeu.com"
-	case "4":
-		return "https://openapi-weaz.tuyaeu.com"
-	case "5":
-		return "https://openapi.tuyacn.com"
-	case "6":
-		return "https://openapi.tuyain.com"
-	case "7":
-		return "https://openapi-sg.iotbing.com"
+	if idx, err := strconv.Atoi(choice); err == nil && idx >= 1 && idx <= len(cloud.Regions) {
+		return cloud.Regions[idx-1].URL
 	}
 	if strings.TrimSpace(choice) == "" && current != "" {
 		return current
@@ -809,35 +1234,155 @@ func promptEndpoint(reader *bufio.Reader, current string) string {
 	return choice
 }
 
+// detectEndpoint probes every data center with the entered credentials and
+// offers the one holding the linked devices.
+func detectEndpoint(reader *bufio.Reader, cfg *config.Config) (string, bool) {
+	resolved, err := resolvedCopy(cfg)
+	if err != nil {
+		fmt.Printf("Region detection skipped: %v\n", err)
+		return "", false
+	}
+	fmt.Println("Detecting data center...")
+	region, probes, err := cloud.DetectRegion(resolved.Cloud.AccessID, resolved.Cloud.AccessKey, resolved.Cloud.UserID)
+	fmt.Printf("%-18s %-6s %-8s %s\n", "REGION", "TOKEN", "DEVICES", "ERROR")
+	for _, p := range probes {
+		token := "no"
+		if p.Token {
+			token = "yes"
+		}
+		fmt.Printf("%-18s %-6s %-8d %s\n", p.Label, token, p.Devices, p.Error)
+	}
+	if err != nil {
+		fmt.Printf("Region detection failed: %v\n", err)
+		return "", false
+	}
+	if !promptYesNo(reader, fmt.Sprintf("Use %s (%s)", region.Label, region.URL), true) {
+		return "", false
+	}
+	return region.URL, true
+}
+
 func inferRegion(endpoint, fallback string) string {
 	if fallback != "" {
 		return fallback
 	}
-	if strings.Contains(endpoint, "tuyaus") {
-		if strings.Contains(endpoint, "ueaz") {
-			return "us-east"
-		}
-		return "us"
+	if r, ok := cloud.RegionForEndpoint(endpoint); ok {
+		return r.Code
 	}
-	if strings.Contains(endpoint, "tuyaeu") {
-		if strings.Contains(endpoint, "weaz") {
-			return "eu-west"
+	return ""
+}
+
+// guard applies the safety policy to a write. Actions that need confirmation
+// prompt on a terminal and otherwise require --yes.
+func guard(cfg *config.Config, action safety.Action, yes, jsonOut bool) {
+	err := safety.New(cfg.Safety).Check(action)
+	if err == nil {
+		return
+	}
+	confirmRefusal(err, yes, jsonOut)
+}
+
+// confirmRefusal lets a refusal that only needs confirmation through with
+// --yes, a dry run or a yes at the prompt, and exits otherwise.
+func confirmRefusal(err error, yes, jsonOut bool) {
+	var refusal *safety.Refusal
+	if errors.As(err, &refusal) && refusal.NeedsConfirm {
+		target := refusal.Action.Target()
+		if yes {
+			return
+		}
+		if isDryRun() {
+			fmt.Fprintf(os.Stderr, "note: %s would need confirmation (--yes): %s\n", target, refusal.Reason)
+			return
+		}
+		if isInteractive() && !jsonOut {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", target, refusal.Reason)
+			if promptYesNo(bufio.NewReader(os.Stdin), "Proceed", false) {
+				return
+			}
 		}
-		return "eu"
 	}
-	if strings.Contains(endpoint, "tuyain") {
-		return "in"
+	fatal(err)
+}
+
+// callAction builds the safety action for a Home Assistant service call
+// from every entity its data targets.
+func callAction(service string, data map[string]any) safety.Action {
+	entities, scopes := ha.ServiceTargets(data)
+	action := safety.Action{Kind: "call", Service: service, Scopes: scopes}
+	if len(entities) == 1 {
+		action.Entity = entities[0]
+	} else {
+		action.Entities = entities
 	}
-	if strings.Contains(endpoint, "tuyacn") {
-		return "cn"
+	return action
+}
+
+// cloudAction builds a safety action for a cloud device, resolving the device
+// name only when device rules could match on it.
+func cloudAction(cfg *config.Config, client *cloud.Client, kind, id string, codes ...string) safety.Action {
+	action := safety.Action{Kind: kind, DeviceID: id, Codes: codes}
+	if len(cfg.Safety.Allow.Devices) == 0 && len(cfg.Safety.Deny.Devices) == 0 {
+		return action
 	}
-	if strings.Contains(endpoint, "iotbing") {
-		return "sg"
+	if devices, err := client.GetDevices(); err == nil {
+		for _, dev := range devices {
+			if dev.ID == id {
+				action.DeviceName = dev.Name
+				break
+			}
+		}
 	}
-	return ""
+	return action
+}
+
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 func fatal(err error) {
-	fmt.Fprintln(os.Stderr, "error:", err)
-	os.Exit(1)
+	if errors.Is(err, trace.ErrDryRun) {
+		fmt.Fprintln(os.Stderr, trace.ErrDryRun)
+		os.Exit(0)
+	}
+	fe := classify(err)
+	if errOutput != nil && errOutput.Structured() {
+		errOutput.Fail(fe)
+	} else {
+		fmt.Fprintln(os.Stderr, "error:", fe.Message)
+		if fe.Hint != "" && !strings.Contains(fe.Message, fe.Hint) {
+			fmt.Fprintln(os.Stderr, "hint:", fe.Hint)
+		}
+	}
+	os.Exit(fe.Kind.ExitCode())
+}
+
+func envTrue(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+func isDryRun() bool {
+	return envTrue("TUYA_DRY_RUN")
+}
+
+// setupTransport routes every HTTP client through the tracing transport when
+// --trace/TUYA_DEBUG or --dry-run is active.
+func setupTransport() {
+	t := &trace.Transport{Base: http.DefaultTransport, DryRun: isDryRun(), Out: os.Stdout}
+	if envTrue("TUYA_DEBUG") {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		slog.SetDefault(logger)
+		t.Logger = logger
+	}
+	if t.DryRun || t.Logger != nil {
+		http.DefaultTransport = t
+	}
 }
@@ -1,6 +1,13 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/util"
+)
 
 func TestScaleCloudValueTemps(t *testing.T) {
 	val, raw := scaleCloudValue("va_temperature", 59)
@@ -37,3 +44,64 @@ func TestScaleCloudValueNoScale(t *testing.T) {
 		t.Fatalf("expected true, got %#v", val)
 	}
 }
+
+func TestExtractGlobalFlags(t *testing.T) {
+	t.Setenv("TUYA_PROFILE", "")
+	args, err := extractGlobalFlags([]string{"--profile", "cabin", "schedule", "add", "--name", "x", "--", "set", "--profile=home"})
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	want := []string{"schedule", "add", "--name", "x", "--", "set", "--profile=home"}
+	if len(args) != len(want) {
+		t.Fatalf("expected %v, got %v", want, args)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, args)
+		}
+	}
+	if got := os.Getenv("TUYA_PROFILE"); got != "cabin" {
+		t.Fatalf("expected TUYA_PROFILE=cabin, got %q", got)
+	}
+}
+
+func TestStatusRowsRemaining(t *testing.T) {
+	rows, timers := statusRows([]cloud.Status{
+		{Code: "switch_1", Value: true},
+		{Code: "countdown_1", Value: float64(90)},
+	}, nil)
+	if !timers || rows[1].Remaining != "1m30s" || rows[0].Remaining != "" {
+		t.Fatalf("expected countdown_1 with 1m30s remaining, got %+v", rows)
+	}
+	if _, timers := statusRows([]cloud.Status{{Code: "countdown_1", Value: float64(0)}}, nil); timers {
+		t.Fatalf("expected idle timer not to add a remaining column")
+	}
+}
+
+func TestCallActionTargets(t *testing.T) {
+	cases := []struct {
+		data     string
+		entities []string
+		scopes   []string
+	}{
+		{`{"entity_id":"switch.fridge"}`, []string{"switch.fridge"}, nil},
+		{`{"entity_id":["switch.patio","switch.fridge"]}`, []string{"switch.patio", "switch.fridge"}, nil},
+		{`{"entity_id":"switch.patio, switch.fridge"}`, []string{"switch.patio", "switch.fridge"}, nil},
+		{`{"entity_id":"all"}`, nil, []string{"entity_id=all"}},
+		{`{"area_id":["kitchen"],"device_id":"abc"}`, nil, []string{"area_id=kitchen", "device_id=abc"}},
+	}
+	for _, c := range cases {
+		data, err := util.ParseJSONMap(c.data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.data, err)
+		}
+		a := callAction("switch.turn_off", data)
+		entities := a.Entities
+		if a.Entity != "" {
+			entities = []string{a.Entity}
+		}
+		if !reflect.DeepEqual(entities, c.entities) || !reflect.DeepEqual(a.Scopes, c.scopes) {
+			t.Fatalf("%s: unexpected action %+v", c.data, a)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/safety"
+)
+
+const mcpProtocolVersion = "2024-11-05"
+
+func runMCP(args []string) {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	cacheTTL := fs.Duration("cache-ttl", defaultCacheTTL, "device inventory cache ttl")
+	fs.Parse(args)
+
+	cfg, be := loadConfig(*configPath, *backend)
+	srv := &mcpServer{hub: newHub(cfg, be, *cacheTTL)}
+	if err := srv.serve(os.Stdin, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+type mcpServer struct {
+	hub *hub
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// serve reads newline-delimited JSON-RPC messages until EOF.
+func (s *mcpServer) serve(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRequestBody)
+	enc := json.NewEncoder(out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: -32700, Message: "parse error"}})
+			continue
+		}
+		result, rerr := s.dispatch(req)
+		if len(req.ID) == 0 {
+			// Notifications never get a response.
+			continue
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr}
+		if rerr == nil && result == nil {
+			resp.Result = map[string]any{}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *mcpServer) dispatch(req rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities": map[string]any{
+				"tools":     map[string]any{},
+				"resources": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "tuya-hub", "version": version},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": s.tools()}, nil
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		return s.callTool(params.Name, params.Arguments), nil
+	case "resources/list":
+		return map[string]any{"resources": s.resources()}, nil
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		res, err := s.readResource(params.URI)
+		if err != nil {
+			return nil, &rpcError{Code: -32002, Message: err.Error()}
+		}
+		return res, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found: " + req.Method}
+}
+
+func (s *mcpServer) tools() []mcpTool {
+	deviceProp := map[string]any{"type": "string", "description": "device id (cloud) or entity id (ha)"}
+	valueProp := map[string]any{"description": "command value; type depends on the code"}
+	codeProp := map[string]any{"type": "string", "description": "Tuya DP code, e.g. switch_1"}
+	if s.hub.backend == "cloud" {
+		codes, desc := s.specSummary()
+		if len(codes) > 0 {
+			codeProp["enum"] = codes
+		}
+		if desc != "" {
+			valueProp["description"] = "command value; accepted values per writable device:\n" + desc
+		}
+	}
+
+	tools := []mcpTool{
+		{
+			Name:        "list_devices",
+			Description: "List devices (cloud) or entities (Home Assistant), optionally filtered by a substring.",
+			InputSchema: objectSchema(map[string]any{"filter": map[string]any{"type": "string"}}),
+		},
+		{
+			Name:        "get_status",
+			Description: "Get the current status of one device or entity.",
+			InputSchema: objectSchema(map[string]any{"device_id": deviceProp}, "device_id"),
+		},
+		{
+			Name:        "set_state",
+			Description: "Turn a device or entity on or off. Only allowlisted devices can be changed.",
+			InputSchema: objectSchema(map[string]any{
+				"device_id": deviceProp,
+				"on":        map[string]any{"type": "boolean"},
+			}, "device_id", "on"),
+		},
+		{
+			Name:        "send_command",
+			Description: "Send a raw Tuya DP command (cloud backend). Only allowlisted devices can be changed.",
+			InputSchema: objectSchema(map[string]any{
+				"device_id": deviceProp,
+				"code":      codeProp,
+				"value":     valueProp,
+			}, "device_id", "code", "value"),
+		},
+		{
+			Name:        "call_service",
+			Description: "Call a Home Assistant service. Only allowlisted services can be called.",
+			InputSchema: objectSchema(map[string]any{
+				"service": map[string]any{"type": "string", "description": "domain.service, e.g. light.turn_on"},
+				"data":    map[string]any{"type": "object"},
+			}, "service"),
+		},
+		{
+			Name:        "poll_sensors",
+			Description: "Read sensor values of the given kinds across all devices, with units converted to the chosen system.",
+			InputSchema: objectSchema(map[string]any{
+				"kind":  map[string]any{"type": "string", "description": "sensor kinds, comma-separated (temperature, humidity, battery, power, energy, voltage, current, co2, pm2.5, voc, illuminance, motion, contact, leak, smoke) or all", "default": "temperature"},
+				"units": map[string]any{"type": "string", "enum": []string{"metric", "imperial"}, "description": "unit system for the values (default from config, else metric)"},
+			}),
+		},
+		{
+			Name:        "run_scene",
+			Description: "Run a scene (HA scene entity, or Tuya tap-to-run scene id). Only allowlisted scenes can be run.",
+			InputSchema: objectSchema(map[string]any{
+				"scene_id": map[string]any{"type": "string"},
+				"home_id":  map[string]any{"type": "string", "description": "Tuya home id (cloud; defaults to mcp.homeId)"},
+			}, "scene_id"),
+		},
+	}
+	return tools
+}
+
+// specSummary collects writable DP codes and their value schemas from the
+// specs of allowlisted cloud devices.
+func (s *mcpServer) specSummary() ([]string, string) {
+	if len(s.hub.cfg.MCP.AllowWrite) == 0 {
+		return nil, ""
+	}
+	if err := s.hub.refresh(false); err != nil {
+		return nil, ""
+	}
+	s.hub.mu.Lock()
+	devices := append([]cloud.Device(nil), s.hub.devices...)
+	s.hub.mu.Unlock()
+
+	codeSet := map[string]bool{}
+	var b strings.Builder
+	for _, dev := range devices {
+		if ok, _ := s.writeAllowed(dev.ID); !ok {
+			continue
+		}
+		spec, err := s.hub.Spec(dev.ID)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s (%s):", dev.Name, dev.ID)
+		for _, fn := range spec.Functions {
+			codeSet[fn.Code] = true
+			schema, _ := json.Marshal(fn.JSONSchema())
+			fmt.Fprintf(&b, " %s=%s;", fn.Code, schema)
+		}
+		b.WriteString("\n")
+	}
+	codes := make([]string, 0, len(codeSet))
+	for code := range codeSet {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes, strings.TrimSpace(b.String())
+}
+
+func objectSchema(props map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *mcpServer) callTool(name string, args map[string]any) map[string]any {
+	res, err := s.runTool(name, args)
+	var refusal *safety.Refusal
+	if errors.As(err, &refusal) {
+		data, _ := json.MarshalIndent(map[string]any{"error": err.Error(), "refusal": refusal}, "", "  ")
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": string(data)}},
+			"isError": true,
+		}
+	}
+	if err != nil {
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	return map[string]any{"content": []map[string]any{{"type": "text", "text": string(data)}}}
+}
+
+func (s *mcpServer) runTool(name string, args map[string]any) (any, error) {
+	str := func(key string) string {
+		v, _ := args[key].(string)
+		return strings.TrimSpace(v)
+	}
+	switch name {
+	case "list_devices":
+		return s.hub.Devices(str("filter"))
+	case "get_status":
+		return s.hub.Device(str("device_id"))
+	case "set_state":
+		id := str("device_id")
+		on, ok := args["on"].(bool)
+		if !ok {
+			return nil, errors.New("on (boolean) required")
+		}
+		if err := s.requireWrite(id); err != nil {
+			return nil, err
+		}
+		return s.hub.SetState(id, on)
+	case "send_command":
+		id := str("device_id")
+		code := str("code")
+		if code == "" {
+			return nil, errors.New("code required")
+		}
+		if _, ok := args["value"]; !ok {
+			return nil, errors.New("value required")
+		}
+		if err := s.requireWrite(id); err != nil {
+			return nil, err
+		}
+		return s.hub.SendCommands(id, []map[string]any{{"code": code, "value": args["value"]}})
+	case "call_service":
+		service := str("service")
+		parts := strings.SplitN(service, ".", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("service must be domain.service")
+		}
+		if !matchAny(s.hub.cfg.MCP.AllowServices, service) {
+			return nil, fmt.Errorf("service %s is not allowlisted (mcp.allowServices)", service)
+		}
+		data, _ := args["data"].(map[string]any)
+		if data == nil {
+			data = map[string]any{}
+		}
+		if len(s.hub.cfg.MCP.AllowWrite) > 0 {
+			entities, other := ha.ServiceTargets(data)
+			if len(other) > 0 {
+				return nil, fmt.Errorf("%s cannot be checked against mcp.allowWrite; name the entities in entity_id", strings.Join(other, ","))
+			}
+			for _, entity := range entities {
+				if err := s.requireWrite(entity); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return s.hub.CallService(parts[0], parts[1], data)
+	case "poll_sensors":
+		return s.hub.Poll(str("kind"), str("units"))
+	case "run_scene":
+		sceneID := str("scene_id")
+		if sceneID == "" {
+			return nil, errors.New("scene_id required")
+		}
+		if !matchAny(s.hub.cfg.MCP.AllowScenes, sceneID) {
+			return nil, fmt.Errorf("scene %s is not allowlisted (mcp.allowScenes)", sceneID)
+		}
+		homeID := str("home_id")
+		if homeID == "" {
+			homeID = s.hub.cfg.MCP.HomeID
+		}
+		return s.hub.RunScene(homeID, sceneID)
+	}
+	return nil, fmt.Errorf("unknown tool: %s", name)
+}
+
+func (s *mcpServer) requireWrite(id string) error {
+	if id == "" {
+		return errors.New("device_id required")
+	}
+	ok, err := s.writeAllowed(id)
+	if err != nil {
+		return fmt.Errorf("device %s: cannot check mcp.allowWrite by device name: %w", id, err)
+	}
+	if !ok {
+		return fmt.Errorf("device %s is not allowlisted for writes (mcp.allowWrite)", id)
+	}
+	return nil
+}
+
+// writeAllowed matches the allowlist against the id as given, the device
+// an alias points to and, for cloud devices, the device name. Names come
+// from the inventory, which is loaded first if no tool has listed it yet.
+func (s *mcpServer) writeAllowed(id string) (bool, error) {
+	resolved := s.hub.cfg.ResolveAlias(id)
+	if matchAny(s.hub.cfg.MCP.AllowWrite, id) || matchAny(s.hub.cfg.MCP.AllowWrite, resolved) {
+		return true, nil
+	}
+	if s.hub.backend != "cloud" {
+		return false, nil
+	}
+	if err := s.hub.refresh(false); err != nil {
+		return false, err
+	}
+	dev, ok := s.hub.cloudDevice(resolved)
+	return ok && matchAny(s.hub.cfg.MCP.AllowWrite, dev.Name), nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *mcpServer) resources() []map[string]any {
+	out := []map[string]any{{
+		"uri":         "tuya://devices",
+		"name":        "Device inventory",
+		"description": "All devices (cloud) or entities (Home Assistant) with their state",
+		"mimeType":    "application/json",
+	}}
+	if err := s.hub.refresh(false); err != nil {
+		return out
+	}
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	switch s.hub.backend {
+	case "cloud":
+		for _, dev := range sortCloudDevices(s.hub.devices) {
+			out = append(out, map[string]any{"uri": "tuya://devices/" + dev.ID, "name": dev.Name, "mimeType": "application/json"})
+		}
+	case "ha":
+		for _, st := range sortStates(s.hub.states) {
+			name, _ := st.Attributes["friendly_name"].(string)
+			if name == "" {
+				name = st.EntityID
+			}
+			out = append(out, map[string]any{"uri": "tuya://devices/" + st.EntityID, "name": name, "mimeType": "application/json"})
+		}
+	}
+	return out
+}
+
+func (s *mcpServer) readResource(uri string) (map[string]any, error) {
+	var res any
+	var err error
+	switch {
+	case uri == "tuya://devices":
+		res, err = s.hub.Devices("")
+	case strings.HasPrefix(uri, "tuya://devices/"):
+		res, err = s.hub.Device(strings.TrimPrefix(uri, "tuya://devices/"))
+	default:
+		return nil, fmt.Errorf("unknown resource: %s", uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"contents": []map[string]any{{"uri": uri, "mimeType": "application/json", "text": string(data)}},
+	}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tuya-hub/internal/config"
+)
+
+func TestMCPToolsAndAllowlist(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/states":
+			w.Write([]byte(`[{"entity_id":"switch.patio","state":"off","attributes":{}}]`))
+		case strings.HasPrefix(r.URL.Path, "/api/services/"):
+			calls++
+			w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		HomeAssistant: config.HomeAssistant{URL: upstream.URL, Token: "ha"},
+		Aliases:       map[string]string{"terrace": "switch.patio"},
+		MCP:           config.MCP{AllowWrite: []string{"switch.patio"}, AllowServices: []string{"switch.*"}},
+	}
+	srv := &mcpServer{hub: newHub(cfg, "ha", defaultCacheTTL)}
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"set_state","arguments":{"device_id":"switch.fridge","on":false}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"set_state","arguments":{"device_id":"switch.patio","on":true}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"set_state","arguments":{"device_id":"terrace","on":false}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"call_service","arguments":{"service":"switch.turn_off","data":{"entity_id":["switch.patio","switch.fridge"]}}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"call_service","arguments":{"service":"switch.turn_off","data":{"area_id":"kitchen"}}}}`,
+	}, "\n")
+	var out strings.Builder
+	if err := srv.serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+
+	var responses []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var resp map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("expected 7 responses (notification has none), got %d", len(responses))
+	}
+
+	tools := responses[1]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 7 {
+		t.Fatalf("expected 7 tools, got %d", len(tools))
+	}
+
+	denied := responses[2]["result"].(map[string]any)
+	if denied["isError"] != true {
+		t.Fatalf("expected fridge write to be refused, got %v", denied)
+	}
+	allowed := responses[3]["result"].(map[string]any)
+	if allowed["isError"] == true {
+		t.Fatalf("expected patio write to succeed, got %v", allowed)
+	}
+	if alias := responses[4]["result"].(map[string]any); alias["isError"] == true {
+		t.Fatalf("expected an alias of an allowlisted device to be writable, got %v", alias)
+	}
+	for _, resp := range responses[5:] {
+		if res := resp["result"].(map[string]any); res["isError"] != true {
+			t.Fatalf("expected service call outside the allowlist to be refused, got %v", res)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected exactly two service calls, got %d", calls)
+	}
+}
+
+func TestMCPAllowWriteByNameBeforeListing(t *testing.T) {
+	client, _ := fakeCloud(t)
+	cfg := &config.Config{MCP: config.MCP{AllowWrite: []string{"Kettle*"}}}
+	h := newHub(cfg, "cloud", defaultCacheTTL)
+	h.cloud = client
+	srv := &mcpServer{hub: h}
+	if err := srv.requireWrite("plug1"); err != nil {
+		t.Fatalf("expected the named device to be allowed before any listing: %v", err)
+	}
+	if err := srv.requireWrite("lamp1"); err == nil {
+		t.Fatalf("expected an unlisted device to be refused")
+	}
+}
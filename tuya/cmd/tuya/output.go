@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/output"
+)
+
+// outputFlags are the rendering flags shared by every command that prints
+// results.
+type outputFlags struct {
+	format   *string
+	json     *bool
+	columns  *string
+	noHeader *bool
+	sort     *string
+}
+
+func addOutputFlags(fs *flag.FlagSet) *outputFlags {
+	return &outputFlags{
+		format:   fs.String("format", "", "output format: table|json|ndjson|csv|tsv|yaml or a Go template like '{{.Name}}: {{.Value}}'"),
+		json:     fs.Bool("json", false, "json output (same as --format json)"),
+		columns:  fs.String("columns", "", "comma-separated columns to show (table, csv, tsv)"),
+		noHeader: fs.Bool("no-header", false, "omit the header row"),
+		sort:     fs.String("sort", "", "sort rows by column; prefix with - to reverse"),
+	}
+}
+
+// errOutput is the printer of the running command, so fatal can report
+// errors in the same format as results.
+var errOutput *output.Printer
+
+// printer validates the flags and returns a printer writing to stdout for
+// command. A bad --format fails before the command does any work.
+func (f *outputFlags) printer(command string) *output.Printer {
+	p := &output.Printer{
+		W:        os.Stdout,
+		Command:  command,
+		Format:   strings.TrimSpace(*f.format),
+		NoHeader: *f.noHeader,
+		Sort:     strings.TrimSpace(*f.sort),
+	}
+	if p.Format == "" && *f.json {
+		p.Format = output.FormatJSON
+	}
+	for _, c := range strings.Split(*f.columns, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			p.Columns = append(p.Columns, c)
+		}
+	}
+	if _, err := p.Kind(); err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	errOutput = p
+	return p
+}
+
+// machine reports whether the output is meant for programs, which turns
+// off prompts and human notes.
+func machine(p *output.Printer) bool {
+	return !p.IsTable()
+}
+
+// render prints a list result or exits on a rendering error.
+func render[T any](p *output.Printer, items []T, cols []output.Column[T]) {
+	if err := output.List(p, items, cols); err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+}
+
+// renderObject prints a single result or exits on a rendering error. text
+// prints the human form to stdout.
+func renderObject(p *output.Printer, v any, text func()) {
+	if err := p.Object(v, func(io.Writer) { text() }); err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+}
+
+// actionResult is what set and call report: the target, the service or DP
+// code, the value sent and the backend's reply.
+type actionResult struct {
+	Target string `json:"target"`
+	Action string `json:"action"`
+	Value  any    `json:"value,omitempty"`
+	Result any    `json:"result"`
+	// Observed and Verified are set by --wait/--verify: the value the
+	// device reported afterwards and whether it matches Value.
+	Observed any   `json:"observed,omitempty"`
+	Verified *bool `json:"verified,omitempty"`
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/schedule"
+)
+
+const (
+	defaultCatchUpWindow = 12 * time.Hour
+	maxCatchUpRuns       = 50
+	scheduleRunTimeout   = 2 * time.Minute
+)
+
+func runSchedule(args []string) {
+	if len(args) == 0 {
+		fatal(fault.New(fault.Usage, "schedule subcommand required (add|list|rm|run)"))
+	}
+	switch args[0] {
+	case "add":
+		runScheduleAdd(args[1:])
+	case "list", "ls":
+		runScheduleList(args[1:])
+	case "rm", "remove":
+		runScheduleRemove(args[1:])
+	case "run":
+		runScheduleDaemon(args[1:])
+	default:
+		fatal(fault.New(fault.Usage, "unknown schedule subcommand: %s", args[0]))
+	}
+}
+
+func runScheduleAdd(args []string) {
+	fs := flag.NewFlagSet("schedule add", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	name := fs.String("name", "", "schedule name")
+	at := fs.String("at", "", "cron expression or sunrise/sunset[+-offset]")
+	replace := fs.Bool("replace", false, "replace an existing schedule with the same name")
+	fs.Parse(args)
+
+	command := fs.Args()
+	if strings.TrimSpace(*name) == "" {
+		fatal(fault.New(fault.Usage, "--name required"))
+	}
+	if strings.TrimSpace(*at) == "" {
+		fatal(fault.New(fault.Usage, "--at required (e.g. \"0 7 * * *\" or \"sunset-30m\")"))
+	}
+	if len(command) == 0 {
+		fatal(fault.New(fault.Usage, "command required after --, e.g. -- set --id <device_id> --code switch_1 --value true"))
+	}
+	if command[0] == "schedule" {
+		fatal(fault.New(fault.Usage, "schedules cannot run the schedule command"))
+	}
+
+	spec, err := schedule.Parse(*at)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	if spec.IsSolar() && !cfg.Location.HasCoordinates() {
+		fatal(fault.New(fault.Config, "solar schedules need location.latitude and location.longitude in config"))
+	}
+
+	entry := config.Schedule{Name: *name, At: *at, Command: command}
+	if idx := cfg.FindSchedule(*name); idx >= 0 {
+		if !*replace {
+			fatal(fault.New(fault.Validation, "schedule %q already exists", *name).WithHint("pass --replace to overwrite it"))
+		}
+		cfg.Schedules[idx] = entry
+	} else {
+		cfg.Schedules = append(cfg.Schedules, entry)
+	}
+
+	path, err := config.Save(*configPath, cfg)
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	fmt.Printf("added %s (%s) to %s\n", *name, *at, path)
+}
+
+func runScheduleList(args []string) {
+	fs := flag.NewFlagSet("schedule list", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("schedule list")
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	tz, loc := scheduleLocation(cfg)
+	now := time.Now().In(tz)
+
+	type row struct {
+		Name     string   `json:"name"`
+		At       string   `json:"at"`
+		Command  []string `json:"command"`
+		Disabled bool     `json:"disabled,omitempty"`
+		Next     string   `json:"next,omitempty"`
+		Error    string   `json:"error,omitempty"`
+	}
+	rows := make([]row, 0, len(cfg.Schedules))
+	for _, s := range cfg.Schedules {
+		r := row{Name: s.Name, At: s.At, Command: s.Command, Disabled: s.Disabled}
+		spec, err := schedule.Parse(s.At)
+		if err == nil {
+			var next time.Time
+			next, err = spec.Next(now, loc)
+			if err == nil {
+				r.Next = next.Format(time.RFC3339)
+			}
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		rows = append(rows, r)
+	}
+
+	if p.IsTable() && len(rows) == 0 {
+		fmt.Println("(no schedules)")
+		return
+	}
+	render(p, rows, []output.Column[row]{
+		{Name: "name", Value: func(r row) any { return r.Name }},
+		{Name: "at", Value: func(r row) any { return r.At }},
+		{Name: "next", Value: func(r row) any {
+			switch {
+			case r.Error != "":
+				return "error: " + r.Error
+			case r.Disabled:
+				return "disabled"
+			}
+			return r.Next
+		}},
+		{Name: "command", Value: func(r row) any { return strings.Join(r.Command, " ") }},
+	})
+}
+
+func runScheduleRemove(args []string) {
+	fs := flag.NewFlagSet("schedule rm", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	name := fs.String("name", "", "schedule name")
+	fs.Parse(args)
+
+	if strings.TrimSpace(*name) == "" && fs.NArg() > 0 {
+		*name = fs.Arg(0)
+	}
+	if strings.TrimSpace(*name) == "" {
+		fatal(fault.New(fault.Usage, "--name required"))
+	}
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+	idx := cfg.FindSchedule(*name)
+	if idx < 0 {
+		fatal(fault.New(fault.NotFound, "schedule not found: %s", *name))
+	}
+	cfg.Schedules = append(cfg.Schedules[:idx], cfg.Schedules[idx+1:]...)
+	if _, err := config.Save(*configPath, cfg); err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	fmt.Printf("removed %s\n", *name)
+}
+
+type scheduleLogEntry struct {
+	Time         time.Time `json:"time"`
+	Schedule     string    `json:"schedule"`
+	At           string    `json:"at"`
+	ScheduledFor time.Time `json:"scheduledFor"`
+	Command      []string  `json:"command"`
+	Status       string    `json:"status"`
+	CatchUp      bool      `json:"catchUp,omitempty"`
+	DurationMS   int64     `json:"durationMs"`
+	Output       string    `json:"output,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type scheduleState struct {
+	LastRun map[string]time.Time `json:"lastRun"`
+}
+
+type scheduler struct {
+	catchUp   string
+	window    time.Duration
+	logPath   string
+	statePath string
+	state     scheduleState
+	// run executes a schedule's command line; nil runs it through this
+	// binary.
+	run func(args []string) ([]byte, error)
+}
+
+func runScheduleDaemon(args []string) {
+	fs := flag.NewFlagSet("schedule run", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	catchUp := fs.String("catch-up", "", "missed run policy (skip|once|all)")
+	once := fs.Bool("once", false, "process due and missed runs, then exit")
+	fs.Parse(args)
+
+	if *configPath != "" {
+		// Schedules run as child processes; hand them the config through the
+		// environment so their own arguments stay untouched.
+		abs, err := filepath.Abs(*configPath)
+		if err != nil {
+			fatal(err)
+		}
+		os.Setenv("TUYA_CONFIG", abs)
+	}
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	s := &scheduler{}
+	if err := s.configure(cfg, *catchUp); err != nil {
+		fatal(err)
+	}
+	if err := s.loadState(); err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tz, _ := scheduleLocation(cfg)
+	fmt.Printf("scheduler started: %d schedules, catch-up %s, log %s\n", len(cfg.Schedules), s.catchUp, s.logPath)
+	s.catchUpMissed(cfg, time.Now().In(tz))
+	if *once {
+		return
+	}
+
+	for {
+		if reloaded, err := config.Load(*configPath); err == nil {
+			cfg = reloaded
+		} else {
+			fmt.Fprintln(os.Stderr, "warning: config reload failed:", err)
+		}
+		tz, loc := scheduleLocation(cfg)
+		now := time.Now().In(tz)
+
+		wake := now.Add(time.Minute)
+		for _, entry := range cfg.Schedules {
+			if entry.Disabled {
+				continue
+			}
+			spec, err := schedule.Parse(entry.At)
+			if err != nil {
+				continue
+			}
+			last, ok := s.state.LastRun[entry.Name]
+			if !ok {
+				last = now
+				s.state.LastRun[entry.Name] = now
+				s.saveState()
+			}
+			next, err := spec.Next(last.In(tz), loc)
+			if err != nil {
+				continue
+			}
+			if !next.After(now) {
+				s.execute(entry, next, false)
+				next, err = spec.Next(next, loc)
+				if err != nil {
+					continue
+				}
+			}
+			if next.Before(wake) {
+				wake = next
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("scheduler stopped")
+			return
+		case <-time.After(time.Until(wake)):
+		}
+	}
+}
+
+func (s *scheduler) configure(cfg *config.Config, catchUpOverride string) error {
+	s.catchUp = strings.ToLower(strings.TrimSpace(catchUpOverride))
+	if s.catchUp == "" {
+		s.catchUp = strings.ToLower(strings.TrimSpace(cfg.Scheduler.CatchUp))
+	}
+	if s.catchUp == "" {
+		s.catchUp = "skip"
+	}
+	switch s.catchUp {
+	case "skip", "once", "all":
+	default:
+		return fmt.Errorf("unknown catch-up policy %q (skip|once|all)", s.catchUp)
+	}
+
+	if !cfg.Location.HasCoordinates() {
+		for _, entry := range cfg.Schedules {
+			if spec, err := schedule.Parse(entry.At); err == nil && spec.IsSolar() && !entry.Disabled {
+				return fault.New(fault.Config, "schedule %s: solar schedules need location.latitude and location.longitude in config", entry.Name)
+			}
+		}
+	}
+
+	s.window = defaultCatchUpWindow
+	if w := strings.TrimSpace(cfg.Scheduler.CatchUpWindow); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil {
+			return fmt.Errorf("scheduler.catchUpWindow: %w", err)
+		}
+		s.window = d
+	}
+
+	dir, err := config.DefaultDir()
+	if err != nil {
+		return err
+	}
+	s.logPath = cfg.Scheduler.LogPath
+	if s.logPath == "" {
+		s.logPath = filepath.Join(dir, "schedule.log")
+	}
+	s.statePath = cfg.Scheduler.StatePath
+	if s.statePath == "" {
+		s.statePath = filepath.Join(dir, "schedule-state.json")
+	}
+	return nil
+}
+
+func (s *scheduler) loadState() error {
+	s.state = scheduleState{LastRun: map[string]time.Time{}}
+	data, err := os.ReadFile(s.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("schedule state %s: %w", s.statePath, err)
+	}
+	if s.state.LastRun == nil {
+		s.state.LastRun = map[string]time.Time{}
+	}
+	return nil
+}
+
+func (s *scheduler) saveState() {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: schedule state:", err)
+		return
+	}
+	if err := os.WriteFile(s.statePath, data, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: schedule state:", err)
+	}
+}
+
+// catchUpMissed replays or skips runs that fell between the last recorded run
+// and now, according to the configured policy. Every schedule's last run is
+// then moved up to now, so runs older than the window are dropped rather
+// than left for the main loop to fire.
+func (s *scheduler) catchUpMissed(cfg *config.Config, now time.Time) {
+	_, loc := scheduleLocation(cfg)
+	for _, entry := range cfg.Schedules {
+		if entry.Disabled {
+			continue
+		}
+		last, ok := s.state.LastRun[entry.Name]
+		if !ok {
+			continue
+		}
+		spec, err := schedule.Parse(entry.At)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: schedule %s: %v\n", entry.Name, err)
+			continue
+		}
+		// Runs older than the catch-up window are dropped without replay.
+		from := last.In(now.Location())
+		if cutoff := now.Add(-s.window); from.Before(cutoff) {
+			from = cutoff
+		}
+		missed, err := spec.Between(from, now, loc, maxCatchUpRuns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: schedule %s: %v\n", entry.Name, err)
+		}
+		for i, at := range missed {
+			run := s.catchUp == "all" || (s.catchUp == "once" && i == len(missed)-1)
+			if run {
+				s.execute(entry, at, true)
+			} else {
+				s.record(scheduleLogEntry{
+					Time:         time.Now(),
+					Schedule:     entry.Name,
+					At:           entry.At,
+					ScheduledFor: at,
+					Command:      entry.Command,
+					Status:       "skipped",
+					CatchUp:      true,
+				})
+			}
+		}
+		s.state.LastRun[entry.Name] = now
+	}
+	s.saveState()
+}
+
+func (s *scheduler) execute(entry config.Schedule, at time.Time, catchUp bool) {
+	args := append([]string(nil), entry.Command...)
+
+	started := time.Now()
+	logEntry := scheduleLogEntry{
+		Time:         started,
+		Schedule:     entry.Name,
+		At:           entry.At,
+		ScheduledFor: at,
+		Command:      entry.Command,
+		CatchUp:      catchUp,
+		Status:       "ok",
+	}
+
+	run := s.run
+	if run == nil {
+		run = runSelf
+	}
+	out, err := run(args)
+	logEntry.Output = strings.TrimSpace(string(out))
+	logEntry.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		logEntry.Status = "failed"
+		logEntry.Error = err.Error()
+	}
+
+	s.record(logEntry)
+	s.state.LastRun[entry.Name] = at
+	s.saveState()
+}
+
+// runSelf runs a tuya command line through this binary.
+func runSelf(args []string) ([]byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scheduleRunTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, exe, args...).CombinedOutput()
+}
+
+func (s *scheduler) record(entry scheduleLogEntry) {
+	line := fmt.Sprintf("%s %-8s %s (%s) %s", entry.Time.Format(time.RFC3339), entry.Status, entry.Schedule, entry.ScheduledFor.Format(time.RFC3339), strings.Join(entry.Command, " "))
+	if entry.Error != "" {
+		line += ": " + entry.Error
+	}
+	fmt.Println(line)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.logPath), 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: schedule log:", err)
+		return
+	}
+	f, err := os.OpenFile(s.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: schedule log:", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+func scheduleLocation(cfg *config.Config) (*time.Location, schedule.Location) {
+	tz := time.Local
+	if cfg.Location == nil {
+		return tz, schedule.Location{}
+	}
+	if name := strings.TrimSpace(cfg.Location.Timezone); name != "" {
+		if l, err := time.LoadLocation(name); err == nil {
+			tz = l
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: location.timezone %q: %v\n", name, err)
+		}
+	}
+	if !cfg.Location.HasCoordinates() {
+		return tz, schedule.Location{}
+	}
+	return tz, schedule.Location{
+		Latitude:  *cfg.Location.Latitude,
+		Longitude: *cfg.Location.Longitude,
+		Set:       true,
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/schedule"
+)
+
+// testScheduler returns a scheduler whose commands are recorded instead of
+// run, with a daily 19:00 schedule last run three days before now.
+func testScheduler(t *testing.T, catchUp string, now time.Time) (*scheduler, *config.Config, *[][]string) {
+	t.Helper()
+	dir := t.TempDir()
+	var ran [][]string
+	s := &scheduler{
+		catchUp:   catchUp,
+		window:    defaultCatchUpWindow,
+		logPath:   filepath.Join(dir, "schedule.log"),
+		statePath: filepath.Join(dir, "schedule-state.json"),
+		state:     scheduleState{LastRun: map[string]time.Time{"lamp": now.Add(-72 * time.Hour)}},
+		run: func(args []string) ([]byte, error) {
+			ran = append(ran, args)
+			return nil, nil
+		},
+	}
+	cfg := &config.Config{
+		Location:  &config.Location{Timezone: "UTC"},
+		Schedules: []config.Schedule{{Name: "lamp", At: "0 19 * * *", Command: []string{"set", "--id", "abc"}}},
+	}
+	return s, cfg, &ran
+}
+
+func TestCatchUpPolicies(t *testing.T) {
+	// 20:00 with a 12h window: only today's 19:00 run is within it.
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	cases := []struct {
+		policy string
+		runs   int
+	}{
+		{"skip", 0},
+		{"once", 1},
+		{"all", 1},
+	}
+	for _, c := range cases {
+		s, cfg, ran := testScheduler(t, c.policy, now)
+		s.catchUpMissed(cfg, now)
+		if len(*ran) != c.runs {
+			t.Fatalf("%s: expected %d runs, got %v", c.policy, c.runs, *ran)
+		}
+		if last := s.state.LastRun["lamp"]; !last.Equal(now) {
+			t.Fatalf("%s: expected last run moved to now, got %v", c.policy, last)
+		}
+	}
+
+	s, cfg, ran := testScheduler(t, "all", now)
+	s.window = 72 * time.Hour
+	s.catchUpMissed(cfg, now)
+	if len(*ran) != 3 {
+		t.Fatalf("expected the three runs inside a 72h window, got %v", *ran)
+	}
+}
+
+func TestCatchUpDropsRunsPastTheWindow(t *testing.T) {
+	// 08:00: yesterday's 19:00 run is 13h old, outside the 12h window.
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	s, cfg, ran := testScheduler(t, "all", now)
+	s.catchUpMissed(cfg, now)
+	if len(*ran) != 0 {
+		t.Fatalf("expected no runs outside the window, got %v", *ran)
+	}
+	_, loc := scheduleLocation(cfg)
+	spec, _ := schedule.Parse(cfg.Schedules[0].At)
+	next, err := spec.Next(s.state.LastRun["lamp"], loc)
+	if err != nil || !next.After(now) {
+		t.Fatalf("expected the next run after now, got %v (%v)", next, err)
+	}
+}
+
+func TestExecuteKeepsCommandArgs(t *testing.T) {
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	s, _, ran := testScheduler(t, "skip", now)
+	entry := config.Schedule{Name: "raw", At: "0 7 * * *", Command: []string{"api", "POST", "/v1.0/devices/abc/commands", "--", "-1"}}
+	s.execute(entry, now, false)
+	if len(*ran) != 1 || len((*ran)[0]) != len(entry.Command) {
+		t.Fatalf("expected the stored command unchanged, got %v", *ran)
+	}
+}
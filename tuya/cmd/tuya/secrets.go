@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/secret"
+)
+
+// secretResolver resolves references in cfg. The vault passphrase comes from
+// TUYA_VAULT_PASSPHRASE, then vault.passphrase (itself a reference), then a
+// terminal prompt.
+func secretResolver(cfg *config.Config) *secret.Resolver {
+	return &secret.Resolver{
+		VaultPath: cfg.VaultPath(),
+		Passphrase: func() (string, error) {
+			return vaultPassphrase(cfg, false)
+		},
+	}
+}
+
+func vaultPassphrase(cfg *config.Config, confirm bool) (string, error) {
+	if v := os.Getenv("TUYA_VAULT_PASSPHRASE"); v != "" {
+		return v, nil
+	}
+	if ref := strings.TrimSpace(cfg.Vault.Passphrase); ref != "" {
+		if strings.HasPrefix(ref, secret.PrefixVault) {
+			return "", errors.New("vault.passphrase cannot reference the vault itself")
+		}
+		return (&secret.Resolver{}).Resolve(ref)
+	}
+	if !isInteractive() {
+		return "", errors.New("vault passphrase required (set TUYA_VAULT_PASSPHRASE or vault.passphrase)")
+	}
+	pass, err := readPassword("Vault passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	if pass == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return pass, nil
+}
+
+func readPassword(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolvedCopy returns a copy of cfg with secret references resolved, for
+// connectivity tests inside the wizard.
+func resolvedCopy(cfg *config.Config) (*config.Config, error) {
+	out := *cfg
+	if err := out.ResolveSecrets(secretResolver(cfg)); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// promptSecretStorage asks where a freshly entered secret should live and
+// returns the value to write into the config: the plaintext itself or a
+// reference to where it was stored.
+func promptSecretStorage(reader *bufio.Reader, cfg *config.Config, key, label, value string) string {
+	if strings.TrimSpace(value) == "" || secret.IsRef(value) {
+		return value
+	}
+	for {
+		choice := strings.ToLower(strings.TrimSpace(promptDefault(reader, "Store "+label+" as (plain/vault/env/file/cmd)", "plain")))
+		switch choice {
+		case "plain":
+			return value
+		case "vault":
+			path := cfg.VaultPath()
+			_, statErr := os.Stat(path)
+			pass, err := vaultPassphrase(cfg, os.IsNotExist(statErr))
+			if err != nil {
+				fmt.Printf("Vault unavailable: %v\n", err)
+				continue
+			}
+			secrets, err := secret.OpenVault(path, pass)
+			if err != nil {
+				fmt.Printf("Vault unavailable: %v\n", err)
+				continue
+			}
+			secrets[key] = value
+			if err := secret.SaveVault(path, pass, secrets); err != nil {
+				fmt.Printf("Vault write failed: %v\n", err)
+				continue
+			}
+			fmt.Printf("Stored %s in %s\n", key, path)
+			return secret.PrefixVault + key
+		case "env":
+			name := promptRequired(reader, "Environment variable name", envNameFor(key))
+			fmt.Printf("Remember to export %s before running tuya.\n", name)
+			return secret.PrefixEnv + name
+		case "file":
+			def := filepath.Join(filepath.Dir(cfg.VaultPath()), "secrets", key)
+			path := promptRequired(reader, "Secret file path", def)
+			if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+				fmt.Printf("Write failed: %v\n", err)
+				continue
+			}
+			if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+				fmt.Printf("Write failed: %v\n", err)
+				continue
+			}
+			return secret.PrefixFile + path
+		case "cmd":
+			command := promptRequired(reader, "Command that prints the secret (e.g. pass show tuya/key)", "")
+			fmt.Println("The value was not stored; make sure the command prints it.")
+			return secret.PrefixCmd + command
+		}
+		fmt.Println("Please enter plain, vault, env, file or cmd.")
+	}
+}
+
+func envNameFor(key string) string {
+	switch {
+	case strings.HasSuffix(key, "cloud.accessKey"):
+		return "TUYA_CLOUD_ACCESS_KEY"
+	case strings.HasSuffix(key, "homeAssistant.token"):
+		return "TUYA_HA_TOKEN"
+	}
+	return "TUYA_SECRET"
+}
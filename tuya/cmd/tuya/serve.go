@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/safety"
+)
+
+const (
+	defaultListen   = "127.0.0.1:8765"
+	defaultCacheTTL = 60 * time.Second
+	maxRequestBody  = 1 << 20
+)
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	listen := fs.String("listen", "", "listen address (default "+defaultListen+")")
+	cacheTTL := fs.Duration("cache-ttl", 0, "device inventory cache ttl (default 60s)")
+	noAuth := fs.Bool("no-auth", false, "disable bearer auth (loopback only)")
+	fs.Parse(args)
+
+	cfg, be := loadConfig(*configPath, *backend)
+
+	addr := strings.TrimSpace(*listen)
+	if addr == "" {
+		addr = strings.TrimSpace(cfg.Server.Listen)
+	}
+	if addr == "" {
+		addr = defaultListen
+	}
+
+	ttl := *cacheTTL
+	if ttl == 0 && strings.TrimSpace(cfg.Server.CacheTTL) != "" {
+		d, err := time.ParseDuration(cfg.Server.CacheTTL)
+		if err != nil {
+			fatal(fault.New(fault.Config, "server.cacheTTL: %w", err))
+		}
+		ttl = d
+	}
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+
+	token := strings.TrimSpace(cfg.Server.Token)
+	if token == "" && !*noAuth {
+		fatal(fault.New(fault.Config, "server token missing (set server.token or TUYA_SERVER_TOKEN, or pass --no-auth)"))
+	}
+	if *noAuth && !isLoopback(addr) {
+		fatal(fault.New(fault.Usage, "--no-auth is only allowed on loopback addresses"))
+	}
+
+	srv := &apiServer{hub: newHub(cfg, be, ttl), token: token}
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           srv.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "tuya serve: listening on http://%s (backend %s)\n", addr, be)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+}
+
+type apiServer struct {
+	hub   *hub
+	token string
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", s.handleDevices)
+	mux.HandleFunc("GET /devices/{id}", s.handleDevice)
+	mux.HandleFunc("POST /devices/{id}/commands", s.handleCommands)
+	mux.HandleFunc("GET /poll", s.handlePoll)
+	mux.HandleFunc("POST /services/{domain}/{service}", s.handleService)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHTTPJSON(w, http.StatusOK, map[string]any{"ok": true, "backend": s.hub.backend, "version": version})
+	})
+	return s.logRequests(s.authenticate(mux))
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(s.token)) != 1 {
+				writeHTTPError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (s *apiServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		fmt.Fprintf(os.Stderr, "%s %s %s %d %s\n", started.Format(time.RFC3339), r.Method, r.URL.RequestURI(), rec.status, time.Since(started).Round(time.Millisecond))
+	})
+}
+
+func (s *apiServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("refresh") == "1" {
+		if err := s.hub.refresh(true); err != nil {
+			writeHTTPError(w, httpStatusFor(err), err)
+			return
+		}
+	}
+	res, err := s.hub.Devices(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeHTTPError(w, httpStatusFor(err), err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, res)
+}
+
+func (s *apiServer) handleDevice(w http.ResponseWriter, r *http.Request) {
+	res, err := s.hub.Device(r.PathValue("id"))
+	if err != nil {
+		writeHTTPError(w, httpStatusFor(err), err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, res)
+}
+
+func (s *apiServer) handleCommands(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Commands []map[string]any `json:"commands"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.hub.SendCommands(r.PathValue("id"), body.Commands)
+	if err != nil {
+		writeHTTPError(w, httpStatusFor(err), err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, res)
+}
+
+func (s *apiServer) handlePoll(w http.ResponseWriter, r *http.Request) {
+	res, err := s.hub.Poll(r.URL.Query().Get("kind"), r.URL.Query().Get("units"))
+	if err != nil {
+		writeHTTPError(w, httpStatusFor(err), err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, res)
+}
+
+func (s *apiServer) handleService(w http.ResponseWriter, r *http.Request) {
+	payload := map[string]any{}
+	if err := decodeBody(r, &payload); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := s.hub.CallService(r.PathValue("domain"), r.PathValue("service"), payload)
+	if err != nil {
+		writeHTTPError(w, httpStatusFor(err), err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, res)
+}
+
+func decodeBody(r *http.Request, out any) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	return nil
+}
+
+func httpStatusFor(err error) int {
+	switch classify(err).Kind {
+	case fault.NotFound:
+		return http.StatusNotFound
+	case fault.Permission:
+		return http.StatusForbidden
+	case fault.Usage, fault.Validation:
+		return http.StatusBadRequest
+	case fault.RateLimit:
+		return http.StatusTooManyRequests
+	case fault.Timeout:
+		return http.StatusGatewayTimeout
+	case fault.Config, fault.Auth:
+		// The server's own config or credentials are at fault, not the
+		// client's request.
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadGateway
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	fe := classify(err)
+	body := map[string]any{"error": err.Error(), "kind": fe.Kind}
+	if fe.Hint != "" {
+		body["hint"] = fe.Hint
+	}
+	var refusal *safety.Refusal
+	if errors.As(err, &refusal) {
+		body["refusal"] = refusal
+	}
+	writeHTTPJSON(w, status, body)
+}
+
+func isLoopback(addr string) bool {
+	host := addr
+	if idx := strings.LastIndex(addr, ":"); idx >= 0 {
+		host = addr[:idx]
+	}
+	host = strings.Trim(host, "[]")
+	return host == "127.0.0.1" || host == "localhost" || host == "::1"
+}
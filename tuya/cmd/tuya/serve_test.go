@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tuya-hub/internal/config"
+)
+
+func TestServeAuthAndDevices(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/states" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"entity_id":"switch.patio","state":"on","attributes":{"friendly_name":"Patio"}},{"entity_id":"sensor.kitchen","state":"21","attributes":{}}]`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{HomeAssistant: config.HomeAssistant{URL: upstream.URL, Token: "ha"}}
+	srv := &apiServer{hub: newHub(cfg, "ha", defaultCacheTTL), token: "secret"}
+	handler := srv.routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/devices", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/devices?filter=patio", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var states []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &states); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(states) != 1 || states[0]["entity_id"] != "switch.patio" {
+		t.Fatalf("unexpected devices: %v", states)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/poll?units=nonsense", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown units, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8765": true,
+		"localhost:80":   true,
+		"[::1]:8765":     true,
+		"0.0.0.0:8765":   false,
+		":8765":          false,
+	} {
+		if got := isLoopback(addr); got != want {
+			t.Fatalf("isLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/plan"
+	"tuya-hub/internal/safety"
+	"tuya-hub/internal/snapshot"
+)
+
+func runSnapshot(args []string) {
+	if len(args) == 0 {
+		fatal(fault.New(fault.Usage, "snapshot subcommand required (save|diff|restore|list)"))
+	}
+	switch args[0] {
+	case "save":
+		runSnapshotSave(args[1:])
+	case "diff":
+		runSnapshotDiff(args[1:])
+	case "restore":
+		runSnapshotRestore(args[1:])
+	case "list", "ls":
+		runSnapshotList(args[1:])
+	default:
+		fatal(fault.New(fault.Usage, "unknown snapshot subcommand: %s", args[0]))
+	}
+}
+
+func runSnapshotSave(args []string) {
+	fs := flag.NewFlagSet("snapshot save", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (ha|cloud)")
+	var sel plan.Selector
+	fs.StringVar(&sel.Filter, "filter", "", "only devices whose id or name contains this")
+	fs.StringVar(&sel.Room, "room", "", "only devices in this room")
+	fs.StringVar(&sel.Category, "category", "", "only this Tuya category (cloud) or domain (ha)")
+	fs.StringVar(&sel.Group, "group", "", "only the devices of this group")
+	out := addOutputFlags(fs)
+	positional := parseInterspersed(fs, args)
+	p := out.printer("snapshot")
+
+	if len(positional) != 1 {
+		fatal(fault.New(fault.Usage, "usage: tuya snapshot save <name> [--filter ...]"))
+	}
+	path, err := snapshot.Path(positional[0])
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+
+	cfg, be := loadConfig(*configPath, *backend)
+	snap := &snapshot.Snapshot{Name: positional[0], Backend: be, Profile: cfg.Active, Taken: time.Now().UTC()}
+	var skipped []string
+	switch be {
+	case "cloud":
+		client := cloudClient(cfg)
+		targets, err := cloudTargets(cfg, client, sel)
+		if err != nil {
+			fatal(err)
+		}
+		var failed map[string]error
+		snap.Devices, failed = captureCloud(client, targets, true)
+		for _, t := range targets {
+			if err, ok := failed[t.ID]; ok {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", t.ID, err))
+			}
+		}
+	case "ha":
+		if err := checkSelector(cfg, sel); err != nil {
+			fatal(err)
+		}
+		states, err := haClient(cfg).States()
+		if err != nil {
+			fatal(err)
+		}
+		snap.Devices = captureHA(selectStates(cfg, states, sel))
+	default:
+		fatal(fault.New(fault.Usage, "snapshot not implemented for backend %s", be))
+	}
+	if len(snap.Devices) == 0 {
+		fatal(fault.New(fault.NotFound, "nothing to save: no writable devices matched"))
+	}
+	if err := snapshot.Save(path, snap); err != nil {
+		fatal(fmt.Errorf("save snapshot: %w", err))
+	}
+	p.Meta = map[string]any{"path": path}
+	if len(skipped) > 0 {
+		p.Meta["skipped"] = skipped
+	}
+	renderObject(p, snap, func() {
+		fmt.Printf("saved %d devices to %s\n", len(snap.Devices), path)
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "warning: skipped %s\n", s)
+		}
+	})
+}
+
+// captureCloud reads the devices' status and, when writable is set, keeps
+// only the DPs their spec lets a command set. Devices that cannot be read
+// are returned in failed by id.
+func captureCloud(client *cloud.Client, targets []target, writable bool) ([]snapshot.Device, map[string]error) {
+	devices := make([]*snapshot.Device, len(targets))
+	errs := make([]error, len(targets))
+	plan.Run(len(targets), plan.DefaultConcurrency, func(i int) {
+		t := targets[i]
+		statuses, err := client.GetDeviceStatus(t.ID)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		d := snapshot.Device{ID: t.ID, Name: t.Name, DPs: map[string]any{}}
+		if writable {
+			spec, err := client.GetDeviceSpec(t.ID)
+			if err != nil {
+				errs[i] = fmt.Errorf("spec: %w", err)
+				return
+			}
+			d.DPs = snapshot.Writable(statuses, spec)
+		} else {
+			for _, st := range statuses {
+				d.DPs[st.Code] = st.Value
+			}
+		}
+		devices[i] = &d
+	})
+	var out []snapshot.Device
+	failed := map[string]error{}
+	for i, d := range devices {
+		switch {
+		case errs[i] != nil:
+			failed[targets[i].ID] = errs[i]
+		case len(d.DPs) > 0:
+			out = append(out, *d)
+		}
+	}
+	return out, failed
+}
+
+// captureHA keeps the entities a restore can drive.
+func captureHA(states []ha.State) []snapshot.Device {
+	var out []snapshot.Device
+	for _, st := range sortStates(states) {
+		if d, ok := snapshot.FromHA(st); ok {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+var changeColumns = []output.Column[snapshot.Change]{
+	{Name: "id", Value: func(c snapshot.Change) any { return c.ID }},
+	{Name: "name", Value: func(c snapshot.Change) any { return c.Name }},
+	{Name: "key", Value: func(c snapshot.Change) any { return c.Key }},
+	{Name: "change", Value: func(c snapshot.Change) any { return c.Change }},
+	{Name: "from", Value: func(c snapshot.Change) any { return c.From }},
+	{Name: "to", Value: func(c snapshot.Change) any { return c.To }},
+}
+
+func runSnapshotDiff(args []string) {
+	fs := flag.NewFlagSet("snapshot diff", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	positional := parseInterspersed(fs, args)
+	p := out.printer("snapshot")
+
+	if len(positional) != 2 {
+		fatal(fault.New(fault.Usage, "usage: tuya snapshot diff <a> <b>"))
+	}
+	a, b := loadSnapshot(positional[0]), loadSnapshot(positional[1])
+	if a.Backend != b.Backend {
+		fatal(fault.New(fault.Usage, "%s is from backend %s and %s from %s", a.Name, a.Backend, b.Name, b.Backend))
+	}
+	changes := snapshot.Diff(a, b)
+	p.Meta = map[string]any{"from": a.Taken, "to": b.Taken, "changes": len(changes)}
+	if p.IsTable() && len(changes) == 0 {
+		fmt.Printf("no changes between %s and %s\n", a.Name, b.Name)
+		return
+	}
+	render(p, changes, changeColumns)
+}
+
+func loadSnapshot(name string) *snapshot.Snapshot {
+	path, err := snapshot.Path(name)
+	if err != nil {
+		fatal(fault.Wrap(fault.Usage, err))
+	}
+	snap, err := snapshot.Load(path)
+	if os.IsNotExist(err) {
+		fatal(fault.New(fault.NotFound, "snapshot not found: %s", name).WithHint("list snapshots with tuya snapshot list"))
+	}
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	return snap
+}
+
+func runSnapshotRestore(args []string) {
+	fs := flag.NewFlagSet("snapshot restore", flag.ExitOnError)
+	configPath := fs.String("config", "", "config path")
+	backend := fs.String("backend", "", "backend (default: the snapshot's)")
+	concurrency := fs.Int("concurrency", plan.DefaultConcurrency, "devices written at once")
+	yes := fs.Bool("yes", false, "confirm the restore and actions that need confirmation")
+	out := addOutputFlags(fs)
+	positional := parseInterspersed(fs, args)
+	p := out.printer("snapshot")
+
+	if len(positional) != 1 {
+		fatal(fault.New(fault.Usage, "usage: tuya snapshot restore <name> [--dry-run]"))
+	}
+	snap := loadSnapshot(positional[0])
+	if *backend == "" {
+		*backend = snap.Backend
+	}
+	cfg, be := loadConfig(*configPath, *backend)
+	if be != snap.Backend {
+		fatal(fault.New(fault.Usage, "snapshot %s was taken on backend %s, not %s", snap.Name, snap.Backend, be))
+	}
+
+	var steps [][]job
+	switch be {
+	case "cloud":
+		steps = [][]job{restoreCloud(cloudClient(cfg), snap)}
+	case "ha":
+		client := haClient(cfg)
+		states, err := client.States()
+		if err != nil {
+			fatal(err)
+		}
+		steps = restoreHA(client, snap, states)
+	default:
+		fatal(fault.New(fault.Usage, "snapshot not implemented for backend %s", be))
+	}
+	total := 0
+	for _, jobs := range steps {
+		total += len(jobs)
+	}
+	if total == 0 {
+		if p.IsTable() {
+			fmt.Printf("nothing to restore: devices already match %s\n", snap.Name)
+			return
+		}
+		p.Meta = map[string]any{"targets": 0, "failed": 0}
+		render(p, []targetResult{}, targetColumns)
+		return
+	}
+	if isDryRun() {
+		p.Meta = map[string]any{"targets": total, "dryRun": true}
+		render(p, plannedResults(steps), targetColumns)
+		return
+	}
+	confirmFanOut(steps, "restore", *yes, machine(p))
+	for _, jobs := range steps {
+		for _, j := range jobs {
+			guard(cfg, j.action, *yes, machine(p))
+		}
+	}
+	reportJobs(p, runJobs(steps, *concurrency), targetColumns, total)
+}
+
+// restoreCloud plans one batch of commands per device whose DPs differ
+// from the snapshot. Devices that cannot be read fail in the summary.
+func restoreCloud(client *cloud.Client, snap *snapshot.Snapshot) []job {
+	targets := make([]target, 0, len(snap.Devices))
+	for _, d := range snap.Devices {
+		targets = append(targets, target{ID: d.ID, Name: d.Name})
+	}
+	current, failed := captureCloud(client, targets, false)
+	now := &snapshot.Snapshot{Devices: current}
+
+	var jobs []job
+	for _, saved := range snap.Devices {
+		t := target{ID: saved.ID, Name: saved.Name}
+		if err, ok := failed[saved.ID]; ok {
+			id := saved.ID
+			jobs = append(jobs, job{
+				step:   "restore",
+				target: t,
+				action: safety.Action{Kind: "set", DeviceID: id, DeviceName: t.Name},
+				run: func() (actionResult, error) {
+					return actionResult{Target: id, Action: "restore"}, fmt.Errorf("read current status: %w", err)
+				},
+			})
+			continue
+		}
+		cur, _ := now.Find(saved.ID)
+		commands := snapshot.Commands(cur, saved)
+		if len(commands) == 0 {
+			continue
+		}
+		codes := make([]string, 0, len(commands))
+		values := make(map[string]any, len(commands))
+		for _, c := range commands {
+			codes = append(codes, c.Code)
+			values[c.Code] = c.Value
+		}
+		id := saved.ID
+		jobs = append(jobs, job{
+			step:   "restore",
+			target: t,
+			action: safety.Action{Kind: "set", DeviceID: id, DeviceName: t.Name, Codes: codes},
+			value:  values,
+			run: func() (actionResult, error) {
+				return cloudSet(client, id, commands, waitFlag{}, false)
+			},
+		})
+	}
+	return jobs
+}
+
+// restoreHA plans the service calls per entity. An entity's calls run in
+// order (hvac mode before temperature), so the n-th call of every entity
+// forms step n.
+func restoreHA(client *ha.Client, snap *snapshot.Snapshot, states []ha.State) [][]job {
+	current := map[string]snapshot.Device{}
+	for _, st := range states {
+		if d, ok := snapshot.FromHA(st); ok {
+			current[st.EntityID] = d
+		}
+	}
+	var steps [][]job
+	for _, saved := range snap.Devices {
+		t := target{ID: saved.ID, Name: saved.Name}
+		for i, call := range snapshot.HACalls(current[saved.ID], saved) {
+			for len(steps) <= i {
+				steps = append(steps, nil)
+			}
+			entity, call := saved.ID, call
+			steps[i] = append(steps[i], job{
+				step:   fmt.Sprintf("restore %d", i+1),
+				target: t,
+				action: safety.Action{Kind: "call", Entity: entity, Service: call.Service},
+				value:  call.Data,
+				run: func() (actionResult, error) {
+					return haSet(client, entity, call.Service, call.Data, "", waitFlag{}, false)
+				},
+			})
+		}
+	}
+	return steps
+}
+
+// snapshotInfo is one line of snapshot list.
+type snapshotInfo struct {
+	Name    string    `json:"name"`
+	Backend string    `json:"backend"`
+	Profile string    `json:"profile,omitempty"`
+	Taken   time.Time `json:"taken"`
+	Devices int       `json:"devices"`
+}
+
+var snapshotColumns = []output.Column[snapshotInfo]{
+	{Name: "name", Value: func(s snapshotInfo) any { return s.Name }},
+	{Name: "backend", Value: func(s snapshotInfo) any { return s.Backend }},
+	{Name: "profile", Value: func(s snapshotInfo) any { return s.Profile }},
+	{Name: "taken", Value: func(s snapshotInfo) any { return s.Taken.Local().Format("2006-01-02 15:04") }},
+	{Name: "devices", Value: func(s snapshotInfo) any { return s.Devices }},
+}
+
+func runSnapshotList(args []string) {
+	fs := flag.NewFlagSet("snapshot list", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	p := out.printer("snapshot")
+
+	dir, err := snapshot.Dir()
+	if err != nil {
+		fatal(fault.Wrap(fault.Config, err))
+	}
+	snaps, err := snapshot.List(dir)
+	if err != nil {
+		fatal(err)
+	}
+	infos := make([]snapshotInfo, 0, len(snaps))
+	for _, s := range snaps {
+		infos = append(infos, snapshotInfo{Name: s.Name, Backend: s.Backend, Profile: s.Profile, Taken: s.Taken, Devices: len(s.Devices)})
+	}
+	if p.IsTable() && len(infos) == 0 {
+		fmt.Printf("(no snapshots in %s)\n", dir)
+		return
+	}
+	render(p, infos, snapshotColumns)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/output"
+	"tuya-hub/internal/sensor"
+	"tuya-hub/internal/units"
+	"tuya-hub/internal/util"
+)
+
+// pollUnits builds the unit preferences for poll: --units wins over
+// units.system, and units.kinds overrides single kinds either way.
+func pollUnits(cfg *config.Config, system string) (units.Prefs, error) {
+	if strings.TrimSpace(system) == "" {
+		sys, err := units.ParseSystem(cfg.Units.System)
+		if err != nil {
+			return units.Prefs{}, fault.New(fault.Config, "units.system: %w", err)
+		}
+		return units.Prefs{System: sys, Kinds: cfg.Units.Kinds}, nil
+	}
+	sys, err := units.ParseSystem(system)
+	if err != nil {
+		return units.Prefs{}, fault.Wrap(fault.Usage, err)
+	}
+	return units.Prefs{System: sys, Kinds: cfg.Units.Kinds}, nil
+}
+
+// cloudValue scales a DP value and finds its unit: from the device spec when
+// it lists the code, otherwise from the code itself (_f means °F) and the
+// kind's unit. Raw is set only when the value was scaled. Non-numeric
+// values carry no unit.
+func cloudValue(kind sensor.Kind, code string, value any, spec *cloud.Spec) (val, raw any, unit string) {
+	val, raw = scaleCloudValue(code, value)
+	if spec != nil {
+		if item, ok := spec.StatusItem(code); ok {
+			if values, err := item.Parsed(); err == nil {
+				val, raw = value, nil
+				if f, ok := util.Number(value); ok && values.Scale > 0 {
+					val, raw = units.Round(values.Scaled(f), values.Scale), value
+				}
+				unit = values.Unit
+			}
+		}
+	}
+	if _, ok := util.Number(val); !ok {
+		return val, raw, ""
+	}
+	if strings.TrimSpace(unit) == "" {
+		unit = kind.Unit
+		if isFahrenheitCode(code) {
+			unit = "°F"
+		}
+	}
+	return val, raw, units.Normalize(unit)
+}
+
+// isFahrenheitCode reports whether code is the °F twin of a temperature DP,
+// e.g. temp_current_f.
+func isFahrenheitCode(code string) bool {
+	return strings.HasSuffix(strings.ToLower(code), "_f")
+}
+
+// convertReading converts a numeric reading to the preferred unit of kind.
+// Anything else is returned as is.
+func convertReading(prefs units.Prefs, kind sensor.Kind, value any, unit string) (any, string) {
+	f, ok := util.Number(value)
+	if !ok {
+		return value, unit
+	}
+	converted, to := prefs.Apply(kind.Name, kind.Unit, f, unit)
+	if to == unit {
+		return value, unit
+	}
+	return converted, to
+}
+
+// collapseTwins keeps one reading per device for DPs that Tuya reports in
+// both °C and °F (temp_current and temp_current_f). The twin already in the
+// preferred unit wins, since it needs no conversion; otherwise the base DP.
+func collapseTwins(readings []cloudReading) []cloudReading {
+	twinKey := func(r cloudReading) string {
+		code := strings.ToLower(r.Code)
+		return r.DeviceID + "\x00" + r.Kind + "\x00" + strings.TrimSuffix(code, "_f")
+	}
+	best := map[string]int{}
+	for i, r := range readings {
+		key := twinKey(r)
+		j, seen := best[key]
+		if !seen {
+			best[key] = i
+			continue
+		}
+		if prefersTwin(r, readings[j]) {
+			best[key] = i
+		}
+	}
+	out := make([]cloudReading, 0, len(best))
+	for i, r := range readings {
+		if best[twinKey(r)] == i {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func prefersTwin(a, b cloudReading) bool {
+	aNative, bNative := a.OriginalUnit == a.Unit, b.OriginalUnit == b.Unit
+	if aNative != bNative {
+		return aNative
+	}
+	return !isFahrenheitCode(a.Code) && isFahrenheitCode(b.Code)
+}
+
+// originalCell shows the reported value in tables when it was converted.
+func originalCell(value any, unit, shown string) string {
+	if unit == shown {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", output.Cell(value), unit))
+}
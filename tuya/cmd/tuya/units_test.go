@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/sensor"
+	"tuya-hub/internal/units"
+)
+
+func TestCloudValueUsesSpec(t *testing.T) {
+	power, _ := sensor.NewRegistry(nil).Lookup("power")
+	spec := &cloud.Spec{Status: []cloud.SpecItem{
+		{Code: "cur_power", Type: "Integer", Values: `{"unit":"W","min":0,"max":50000,"scale":1,"step":1}`},
+	}}
+	val, raw, unit := cloudValue(power, "cur_power", float64(1234), spec)
+	if val != 123.4 || raw != float64(1234) || unit != "W" {
+		t.Fatalf("expected 123.4 W from 1234, got %v %s (raw %v)", val, unit, raw)
+	}
+	val, raw, unit = cloudValue(power, "cur_power", float64(1234), nil)
+	if val != float64(1234) || raw != nil || unit != "W" {
+		t.Fatalf("expected unscaled W without spec, got %v %s (raw %v)", val, unit, raw)
+	}
+}
+
+func TestPollCollapsesFahrenheitTwin(t *testing.T) {
+	temp, _ := sensor.NewRegistry(nil).Lookup("temperature")
+	build := func(prefs units.Prefs) []cloudReading {
+		var out []cloudReading
+		for code, v := range map[string]any{"temp_current": float64(225), "temp_current_f": float64(72)} {
+			orig, raw, unit := cloudValue(temp, code, v, nil)
+			val, valUnit := convertReading(prefs, temp, orig, unit)
+			out = append(out, cloudReading{DeviceID: "d1", Kind: "temperature", Code: code, Value: val, Unit: valUnit, OriginalValue: orig, OriginalUnit: unit, Raw: raw})
+		}
+		return collapseTwins(out)
+	}
+
+	metric := build(units.Prefs{System: units.Metric})
+	if len(metric) != 1 || metric[0].Code != "temp_current" || metric[0].Value != 22.5 || metric[0].Unit != "°C" {
+		t.Fatalf("expected temp_current 22.5 °C, got %+v", metric)
+	}
+	imperial := build(units.Prefs{System: units.Imperial})
+	if len(imperial) != 1 || imperial[0].Code != "temp_current_f" || imperial[0].Value != float64(72) || imperial[0].Unit != "°F" {
+		t.Fatalf("expected temp_current_f 72 °F, got %+v", imperial)
+	}
+}
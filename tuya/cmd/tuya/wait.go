@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"tuya-hub/internal/fault"
+	"tuya-hub/internal/verify"
+)
+
+// waitInterval is how often --wait re-reads the device.
+var waitInterval = time.Second
+
+// waitFlag is --wait with an optional timeout: --wait, --wait=30s or
+// --wait 30s.
+type waitFlag struct {
+	on      bool
+	timeout time.Duration
+}
+
+func (w *waitFlag) IsBoolFlag() bool { return true }
+
+func (w *waitFlag) String() string {
+	if w == nil || !w.on {
+		return ""
+	}
+	return w.timeout.String()
+}
+
+func (w *waitFlag) Set(s string) error {
+	if b, err := strconv.ParseBool(s); err == nil {
+		w.on, w.timeout = b, verify.DefaultTimeout
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q (want e.g. 30s)", s)
+	}
+	w.on, w.timeout = true, d
+	return nil
+}
+
+// parseWithWait parses args, letting a duration follow --wait as a separate
+// argument.
+func parseWithWait(fs *flag.FlagSet, args []string, w *waitFlag) {
+	fs.Parse(args)
+	if !w.on || fs.NArg() == 0 {
+		return
+	}
+	if d, err := time.ParseDuration(fs.Arg(0)); err == nil && d > 0 {
+		w.timeout = d
+		fs.Parse(fs.Args()[1:])
+	}
+}
+
+// confirmState fills in what the device reports after a write. With --wait
+// it polls until the value matches, exiting with a timeout error if it never
+// does; with only --verify it reads the value once.
+func confirmState(result *actionResult, fetch verify.Fetch, want any, w waitFlag, verifyOnly bool) {
+	if err := awaitState(result, fetch, want, w, verifyOnly); err != nil {
+		fatal(err)
+	}
+}
+
+// awaitState is confirmState returning the error, for fan-out writes that
+// report failures per target.
+func awaitState(result *actionResult, fetch verify.Fetch, want any, w waitFlag, verifyOnly bool) error {
+	if !w.on && !verifyOnly {
+		return nil
+	}
+	var observed any
+	var err error
+	if w.on {
+		ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+		defer cancel()
+		observed, err = verify.Wait(ctx, waitInterval, fetch, want)
+	} else {
+		observed, _, err = fetch()
+	}
+	if errors.Is(err, verify.ErrTimeout) {
+		return &fault.Error{
+			Kind:    fault.Timeout,
+			Message: fmt.Sprintf("%s %s: %v", result.Target, result.Action, err),
+			Hint:    "the command was accepted but the device did not apply it; check that it is online and supports the value",
+			Details: map[string]any{"expected": want, "observed": observed, "timeout": w.timeout.String()},
+			Err:     err,
+		}
+	}
+	if err != nil {
+		return err
+	}
+	matched := verify.Match(want, observed)
+	result.Observed, result.Verified = observed, &matched
+	return nil
+}
+
+// describeObserved is the text form of a confirmed write.
+func describeObserved(result actionResult, want any) string {
+	if result.Verified == nil {
+		return ""
+	}
+	if *result.Verified {
+		return fmt.Sprintf("confirmed %s = %s", result.Action, verify.Format(result.Observed))
+	}
+	if result.Observed == nil {
+		return fmt.Sprintf("not confirmed: %s not reported (expected %s)", result.Action, verify.Format(want))
+	}
+	return fmt.Sprintf("not confirmed: %s = %s (expected %s)", result.Action, verify.Format(result.Observed), verify.Format(want))
+}
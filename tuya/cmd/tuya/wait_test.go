@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"tuya-hub/internal/verify"
+)
+
+func TestParseWithWait(t *testing.T) {
+	cases := []struct {
+		args    []string
+		on      bool
+		timeout time.Duration
+		yes     bool
+	}{
+		{[]string{"--yes"}, false, 0, true},
+		{[]string{"--wait", "--yes"}, true, verify.DefaultTimeout, true},
+		{[]string{"--wait=30s"}, true, 30 * time.Second, false},
+		{[]string{"--wait", "45s", "--yes"}, true, 45 * time.Second, true},
+	}
+	for _, c := range cases {
+		fs := flag.NewFlagSet("set", flag.ContinueOnError)
+		var w waitFlag
+		fs.Var(&w, "wait", "")
+		yes := fs.Bool("yes", false, "")
+		parseWithWait(fs, c.args, &w)
+		if w.on != c.on || w.timeout != c.timeout || *yes != c.yes {
+			t.Fatalf("%v: expected wait=%v %s yes=%v, got %v %s %v", c.args, c.on, c.timeout, c.yes, w.on, w.timeout, *yes)
+		}
+	}
+}
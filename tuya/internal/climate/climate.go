@@ -0,0 +1,437 @@
+// Package climate reads and drives thermostats, TRVs and heaters through
+// generic settings (target temperature, heat/auto/off, eco) and maps them
+// to each product's Tuya DPs or to Home Assistant climate services.
+package climate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/units"
+	"tuya-hub/internal/util"
+)
+
+// Categories are the Tuya product categories treated as climate devices:
+// thermostats, radiator valves, air conditioners, heaters and water heaters.
+var Categories = []string{"wk", "wkf", "kt", "qn", "rs"}
+
+// IsClimate reports whether a Tuya category is a climate device.
+func IsClimate(category string) bool {
+	for _, c := range Categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// State is the climate state of one device.
+type State struct {
+	Current *float64 `json:"current,omitempty"`
+	Target  *float64 `json:"target,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+	Mode    string   `json:"mode,omitempty"`
+	Preset  string   `json:"preset,omitempty"`
+	// Valve is the valve opening or heating activity, e.g. 40%, open,
+	// heating or idle.
+	Valve     string `json:"valve,omitempty"`
+	On        *bool  `json:"on,omitempty"`
+	ChildLock *bool  `json:"child_lock,omitempty"`
+}
+
+// Summary is the state in one line: "20.5 °C → 21.5 °C, heat, eco, valve 40%".
+func (s State) Summary() string {
+	parts := []string{fmt.Sprintf("%s → %s", s.temp(s.Current), s.temp(s.Target))}
+	if s.Mode != "" {
+		parts = append(parts, s.Mode)
+	}
+	if s.Preset != "" {
+		parts = append(parts, s.Preset)
+	}
+	if s.Valve != "" {
+		parts = append(parts, "valve "+s.Valve)
+	}
+	if s.ChildLock != nil && *s.ChildLock {
+		parts = append(parts, "locked")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s State) temp(v *float64) string {
+	if v == nil {
+		return "?"
+	}
+	return strings.TrimSpace(strconv.FormatFloat(*v, 'f', -1, 64) + " " + s.Unit)
+}
+
+// Temperature DPs in order of preference; °F twins are used only when the
+// device has no °C DP.
+var (
+	targetCodes  = []string{"temp_set", "temp_set_f"}
+	currentCodes = []string{"temp_current", "temp_indoor", "temp_current_f", "temp_indoor_f"}
+)
+
+// FromTuya reads the state from a device's status, scaling temperatures with
+// the spec. Without a spec entry a temperature of 50 or more is taken to be
+// in tenths, as most thermostats report it.
+func FromTuya(statuses []cloud.Status, spec *cloud.Spec) State {
+	values := map[string]any{}
+	for _, st := range statuses {
+		values[st.Code] = st.Value
+	}
+	var s State
+	if code, ok := first(values, currentCodes); ok {
+		if v, unit, ok := temperature(spec, code, values[code]); ok {
+			s.Current, s.Unit = &v, unit
+		}
+	}
+	if code, ok := first(values, targetCodes); ok {
+		if v, unit, ok := temperature(spec, code, values[code]); ok {
+			if s.Unit != "" && unit != s.Unit {
+				if c, err := units.Convert(v, unit, s.Unit); err == nil {
+					v = c
+				}
+			} else {
+				s.Unit = unit
+			}
+			s.Target = &v
+		}
+	}
+	if on, ok := values["switch"].(bool); ok {
+		s.On = &on
+	}
+	if mode, ok := values["mode"].(string); ok {
+		s.Mode = mode
+	}
+	if s.On != nil && !*s.On {
+		s.Mode = "off"
+	}
+	if eco, ok := values["eco"].(bool); ok && eco {
+		s.Preset = "eco"
+	}
+	if lock, ok := values["child_lock"].(bool); ok {
+		s.ChildLock = &lock
+	}
+	if v, ok := util.Number(values["valve_open_degree"]); ok {
+		s.Valve = strconv.FormatFloat(v, 'f', -1, 64) + "%"
+	} else if v, ok := values["valve_state"].(string); ok {
+		s.Valve = v
+	} else if v, ok := values["work_state"].(string); ok {
+		s.Valve = v
+	}
+	return s
+}
+
+// FromHA reads the state of a climate entity.
+func FromHA(st ha.State) State {
+	s := State{Mode: st.State}
+	if v, ok := util.Number(st.Attributes["current_temperature"]); ok {
+		s.Current = &v
+	}
+	if v, ok := util.Number(st.Attributes["temperature"]); ok {
+		s.Target = &v
+	}
+	s.Preset, _ = st.Attributes["preset_mode"].(string)
+	if s.Preset == "none" {
+		s.Preset = ""
+	}
+	s.Valve, _ = st.Attributes["hvac_action"].(string)
+	return s
+}
+
+func first(values map[string]any, codes []string) (string, bool) {
+	for _, code := range codes {
+		if _, ok := values[code]; ok {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+func temperature(spec *cloud.Spec, code string, value any) (float64, string, bool) {
+	raw, ok := util.Number(value)
+	if !ok {
+		return 0, "", false
+	}
+	unit := "°C"
+	if strings.HasSuffix(code, "_f") {
+		unit = "°F"
+	}
+	if values, ok := specValues(spec, code); ok {
+		if values.Unit != "" {
+			unit = units.Normalize(values.Unit)
+		}
+		return units.Round(values.Scaled(raw), values.Scale), unit, true
+	}
+	if math.Abs(raw) >= 50 && unit == "°C" {
+		return raw / 10, unit, true
+	}
+	return raw, unit, true
+}
+
+func specValues(spec *cloud.Spec, code string) (cloud.SpecValues, bool) {
+	if spec == nil {
+		return cloud.SpecValues{}, false
+	}
+	item, ok := spec.Function(code)
+	if !ok {
+		item, ok = spec.StatusItem(code)
+	}
+	if !ok {
+		return cloud.SpecValues{}, false
+	}
+	values, err := item.Parsed()
+	return values, err == nil
+}
+
+// Request is a change to make. Empty fields are left alone.
+type Request struct {
+	// Target is the set point; TargetUnit is its unit, or "" for the
+	// device's own.
+	Target     *float64
+	TargetUnit string
+	Mode       string
+	Preset     string
+}
+
+// ParseTarget reads 21.5, 21.5C or 70F.
+func ParseTarget(s string) (float64, string, error) {
+	in := strings.TrimSpace(s)
+	num := strings.TrimRight(in, "°CcFfK ")
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid target %q (want e.g. 21.5 or 70F)", s)
+	}
+	unit := strings.TrimSpace(strings.TrimPrefix(in, num))
+	if unit != "" {
+		unit = units.Normalize(unit)
+	}
+	return v, unit, nil
+}
+
+// modeAliases maps generic modes to the enum values products use for them.
+var modeAliases = map[string][]string{
+	"heat": {"heat", "hot", "manual", "heating", "comfort"},
+	"cool": {"cool", "cold", "cooling"},
+	"auto": {"auto", "program", "smart", "schedule"},
+	"off":  {"off", "shutdown"},
+	"fan":  {"fan", "wind", "fan_only"},
+	"dry":  {"dry", "dehumidify", "wet"},
+}
+
+// Modes lists the generic modes --mode accepts besides the device's own.
+func Modes() []string {
+	return []string{"heat", "cool", "auto", "off", "fan", "dry"}
+}
+
+// Commands builds the DP commands for a Tuya device from its spec.
+func Commands(spec *cloud.Spec, r Request) ([]map[string]any, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("device spec unavailable")
+	}
+	var cmds []map[string]any
+	add := func(code string, value any) {
+		cmds = append(cmds, map[string]any{"code": code, "value": value})
+	}
+	modeRange := func() []string {
+		if values, ok := specValues(spec, "mode"); ok {
+			if _, writable := spec.Function("mode"); writable {
+				return values.Range
+			}
+		}
+		return nil
+	}()
+	_, hasSwitch := spec.Function("switch")
+
+	if mode := strings.ToLower(strings.TrimSpace(r.Mode)); mode != "" {
+		value, ok := matchEnum(modeRange, mode, modeAliases[mode])
+		switch {
+		case ok:
+			if hasSwitch && mode != "off" {
+				add("switch", true)
+			}
+			add("mode", value)
+		case mode == "off" && hasSwitch:
+			add("switch", false)
+		default:
+			return nil, fmt.Errorf("mode %q not supported; device modes: %s", r.Mode, describe(modeRange))
+		}
+	}
+
+	if preset := strings.ToLower(strings.TrimSpace(r.Preset)); preset != "" {
+		_, hasEco := spec.Function("eco")
+		switch {
+		case preset == "eco" && hasEco:
+			add("eco", true)
+		case (preset == "none" || preset == "comfort") && hasEco:
+			add("eco", false)
+		default:
+			value, ok := matchEnum(modeRange, preset, nil)
+			if !ok {
+				return nil, fmt.Errorf("preset %q not supported; device modes: %s", r.Preset, describe(modeRange))
+			}
+			// Without an eco DP the preset is a mode value, so it cannot
+			// be combined with a different --mode.
+			if prev, set := modeCommand(cmds); set {
+				if prev != value {
+					return nil, fmt.Errorf("mode %q and preset %q both set the device's mode DP; pass only one", r.Mode, r.Preset)
+				}
+				break
+			}
+			add("mode", value)
+		}
+	}
+
+	if r.Target != nil {
+		code, item, ok := "", cloud.SpecItem{}, false
+		for _, c := range targetCodes {
+			if item, ok = spec.Function(c); ok {
+				code = c
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("device has no temp_set DP")
+		}
+		raw, err := targetValue(code, item, *r.Target, r.TargetUnit)
+		if err != nil {
+			return nil, err
+		}
+		add(code, raw)
+	}
+	if len(cmds) == 0 {
+		return nil, fmt.Errorf("nothing to set")
+	}
+	return cmds, nil
+}
+
+// targetValue converts a set point to the DP's raw integer: converted to the
+// DP's unit, scaled, snapped to its step and checked against its range.
+func targetValue(code string, item cloud.SpecItem, target float64, unit string) (int, error) {
+	values, err := item.Parsed()
+	if err != nil {
+		return 0, err
+	}
+	dpUnit := "°C"
+	if strings.HasSuffix(code, "_f") {
+		dpUnit = "°F"
+	}
+	if values.Unit != "" {
+		dpUnit = units.Normalize(values.Unit)
+	}
+	if unit != "" {
+		if target, err = units.Convert(target, unit, dpUnit); err != nil {
+			return 0, err
+		}
+	}
+	raw := values.Raw(target)
+	if !values.InRange(raw) {
+		lo, hi := "?", "?"
+		if values.Min != nil {
+			lo = strconv.FormatFloat(values.Scaled(*values.Min), 'f', -1, 64)
+		}
+		if values.Max != nil {
+			hi = strconv.FormatFloat(values.Scaled(*values.Max), 'f', -1, 64)
+		}
+		return 0, fmt.Errorf("target %s %s out of range %s-%s %s", strconv.FormatFloat(target, 'f', -1, 64), dpUnit, lo, hi, dpUnit)
+	}
+	return int(raw), nil
+}
+
+// modeCommand returns the value of the mode command in cmds, if any.
+func modeCommand(cmds []map[string]any) (any, bool) {
+	for _, c := range cmds {
+		if c["code"] == "mode" {
+			return c["value"], true
+		}
+	}
+	return nil, false
+}
+
+// Call is one Home Assistant climate service call.
+type Call struct {
+	Service string         `json:"service"`
+	Data    map[string]any `json:"data"`
+}
+
+// HACalls maps a request to climate services: set_temperature (carrying the
+// HVAC mode when both are given), set_hvac_mode and set_preset_mode. unit is
+// Home Assistant's temperature unit, which a target with a unit is
+// converted to; hvacModes and presetModes are the entity's supported
+// values, if known.
+func HACalls(r Request, unit string, hvacModes, presetModes []string) ([]Call, error) {
+	var calls []Call
+	mode := ""
+	if m := strings.ToLower(strings.TrimSpace(r.Mode)); m != "" {
+		haAliases := map[string][]string{"fan": {"fan_only"}, "auto": {"auto", "heat_cool"}}
+		value, ok := matchEnum(hvacModes, m, append([]string{m}, haAliases[m]...))
+		if !ok && len(hvacModes) > 0 {
+			return nil, fmt.Errorf("mode %q not supported; entity modes: %s", r.Mode, describe(hvacModes))
+		}
+		if !ok {
+			value = m
+			if m == "fan" {
+				value = "fan_only"
+			}
+		}
+		mode = value
+	}
+	if r.Target != nil {
+		target := *r.Target
+		if r.TargetUnit != "" {
+			if unit == "" {
+				return nil, fmt.Errorf("temperature unit of Home Assistant is unknown; give the target without a unit")
+			}
+			v, err := units.Convert(target, r.TargetUnit, units.Normalize(unit))
+			if err != nil {
+				return nil, err
+			}
+			target = units.Round(v, 1)
+		}
+		data := map[string]any{"temperature": target}
+		if mode != "" {
+			data["hvac_mode"] = mode
+		}
+		calls = append(calls, Call{Service: "set_temperature", Data: data})
+	} else if mode != "" {
+		calls = append(calls, Call{Service: "set_hvac_mode", Data: map[string]any{"hvac_mode": mode}})
+	}
+	if p := strings.TrimSpace(r.Preset); p != "" {
+		value, ok := matchEnum(presetModes, strings.ToLower(p), nil)
+		if !ok && len(presetModes) > 0 {
+			return nil, fmt.Errorf("preset %q not supported; entity presets: %s", r.Preset, describe(presetModes))
+		}
+		if !ok {
+			value = p
+		}
+		calls = append(calls, Call{Service: "set_preset_mode", Data: map[string]any{"preset_mode": value}})
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("nothing to set")
+	}
+	return calls, nil
+}
+
+// matchEnum finds want, or else the first alias, in a device's enum range
+// (case-insensitively). An unknown range matches nothing.
+func matchEnum(rng []string, want string, aliases []string) (string, bool) {
+	for _, candidate := range append([]string{want}, aliases...) {
+		for _, v := range rng {
+			if strings.EqualFold(v, candidate) {
+				return v, true
+			}
+		}
+	}
+	return "", false
+}
+
+func describe(rng []string) string {
+	if len(rng) == 0 {
+		return "none"
+	}
+	return strings.Join(rng, ", ")
+}
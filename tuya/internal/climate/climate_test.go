@@ -0,0 +1,168 @@
+package climate
+
+import (
+	"reflect"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+)
+
+var trvSpec = &cloud.Spec{
+	Category: "wkf",
+	Functions: []cloud.SpecItem{
+		{Code: "switch", Type: "Boolean", Values: "{}"},
+		{Code: "mode", Type: "Enum", Values: `{"range":["auto","manual","holiday"]}`},
+		{Code: "temp_set", Type: "Integer", Values: `{"unit":"℃","min":50,"max":300,"scale":1,"step":5}`},
+		{Code: "eco", Type: "Boolean", Values: "{}"},
+	},
+	Status: []cloud.SpecItem{
+		{Code: "temp_current", Type: "Integer", Values: `{"unit":"℃","min":-100,"max":500,"scale":1,"step":1}`},
+		{Code: "temp_set", Type: "Integer", Values: `{"unit":"℃","min":50,"max":300,"scale":1,"step":5}`},
+	},
+}
+
+func TestFromTuya(t *testing.T) {
+	statuses := []cloud.Status{
+		{Code: "temp_current", Value: float64(205)},
+		{Code: "temp_set", Value: float64(215)},
+		{Code: "mode", Value: "manual"},
+		{Code: "switch", Value: true},
+		{Code: "eco", Value: true},
+		{Code: "valve_open_degree", Value: float64(40)},
+	}
+	s := FromTuya(statuses, trvSpec)
+	if s.Current == nil || *s.Current != 20.5 || s.Target == nil || *s.Target != 21.5 {
+		t.Fatalf("expected 20.5 → 21.5, got %+v", s)
+	}
+	if got, want := s.Summary(), "20.5 °C → 21.5 °C, manual, eco, valve 40%"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// Without a spec, tenths are detected from the magnitude.
+	s = FromTuya([]cloud.Status{{Code: "temp_current", Value: float64(19)}, {Code: "temp_set", Value: float64(210)}, {Code: "switch", Value: false}}, nil)
+	if *s.Current != 19 || *s.Target != 21 || s.Mode != "off" {
+		t.Fatalf("expected 19 → 21, off, got %s", s.Summary())
+	}
+}
+
+func TestCommandsTarget(t *testing.T) {
+	target := 21.3
+	cmds, err := Commands(trvSpec, Request{Target: &target})
+	if err != nil {
+		t.Fatalf("commands: %v", err)
+	}
+	// 21.3 °C is 213 tenths, snapped to the step of 5.
+	want := []map[string]any{{"code": "temp_set", "value": 215}}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("expected %v, got %v", want, cmds)
+	}
+
+	f := 70.0
+	cmds, err = Commands(trvSpec, Request{Target: &f, TargetUnit: "°F"})
+	if err != nil || cmds[0]["value"] != 210 {
+		t.Fatalf("expected 70°F as 210, got %v (%v)", cmds, err)
+	}
+
+	hot := 35.0
+	if _, err := Commands(trvSpec, Request{Target: &hot}); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+}
+
+func TestCommandsMode(t *testing.T) {
+	cmds, err := Commands(trvSpec, Request{Mode: "heat", Preset: "eco"})
+	if err != nil {
+		t.Fatalf("commands: %v", err)
+	}
+	want := []map[string]any{
+		{"code": "switch", "value": true},
+		{"code": "mode", "value": "manual"},
+		{"code": "eco", "value": true},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("expected %v, got %v", want, cmds)
+	}
+
+	cmds, err = Commands(trvSpec, Request{Mode: "off"})
+	if err != nil || !reflect.DeepEqual(cmds, []map[string]any{{"code": "switch", "value": false}}) {
+		t.Fatalf("expected switch off, got %v (%v)", cmds, err)
+	}
+
+	if _, err := Commands(trvSpec, Request{Mode: "cool"}); err == nil {
+		t.Fatalf("expected unsupported mode error")
+	}
+}
+
+func TestCommandsPresetAsMode(t *testing.T) {
+	spec := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "mode", Type: "Enum", Values: `{"range":["auto","manual","comfort","eco"]}`},
+	}}
+	if _, err := Commands(spec, Request{Mode: "heat", Preset: "comfort"}); err == nil {
+		t.Fatalf("expected conflicting mode and preset to be rejected")
+	}
+	cmds, err := Commands(spec, Request{Mode: "auto", Preset: "auto"})
+	if err != nil || !reflect.DeepEqual(cmds, []map[string]any{{"code": "mode", "value": "auto"}}) {
+		t.Fatalf("expected one mode command, got %v (%v)", cmds, err)
+	}
+	cmds, err = Commands(spec, Request{Preset: "eco"})
+	if err != nil || !reflect.DeepEqual(cmds, []map[string]any{{"code": "mode", "value": "eco"}}) {
+		t.Fatalf("expected mode=eco, got %v (%v)", cmds, err)
+	}
+}
+
+func TestHACalls(t *testing.T) {
+	target := 21.5
+	calls, err := HACalls(Request{Target: &target, Mode: "heat", Preset: "eco"}, "°C", []string{"off", "heat", "auto"}, []string{"none", "eco"})
+	if err != nil {
+		t.Fatalf("calls: %v", err)
+	}
+	want := []Call{
+		{Service: "set_temperature", Data: map[string]any{"temperature": 21.5, "hvac_mode": "heat"}},
+		{Service: "set_preset_mode", Data: map[string]any{"preset_mode": "eco"}},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+
+	calls, err = HACalls(Request{Mode: "fan"}, "", nil, nil)
+	if err != nil || calls[0].Service != "set_hvac_mode" || calls[0].Data["hvac_mode"] != "fan_only" {
+		t.Fatalf("expected set_hvac_mode fan_only, got %v (%v)", calls, err)
+	}
+	if _, err := HACalls(Request{Mode: "cool"}, "", []string{"off", "heat"}, nil); err == nil {
+		t.Fatalf("expected unsupported mode error")
+	}
+
+	fahrenheit := 70.0
+	calls, err = HACalls(Request{Target: &fahrenheit, TargetUnit: "°F"}, "°C", nil, nil)
+	if err != nil || calls[0].Data["temperature"] != 21.1 {
+		t.Fatalf("expected 70F as 21.1 on a °C install, got %v (%v)", calls, err)
+	}
+	calls, err = HACalls(Request{Target: &fahrenheit, TargetUnit: "°F"}, "°F", nil, nil)
+	if err != nil || calls[0].Data["temperature"] != 70.0 {
+		t.Fatalf("expected 70F unchanged on a °F install, got %v (%v)", calls, err)
+	}
+	if _, err := HACalls(Request{Target: &fahrenheit, TargetUnit: "°F"}, "", nil, nil); err == nil {
+		t.Fatalf("expected an error when Home Assistant's unit is unknown")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := map[string]struct {
+		v    float64
+		unit string
+	}{
+		"21.5":  {21.5, ""},
+		"21.5C": {21.5, "°C"},
+		"70F":   {70, "°F"},
+		"70 °F": {70, "°F"},
+	}
+	for in, want := range cases {
+		v, unit, err := ParseTarget(in)
+		if err != nil || v != want.v || unit != want.unit {
+			t.Fatalf("ParseTarget(%q): expected %v %q, got %v %q (%v)", in, want.v, want.unit, v, unit, err)
+		}
+	}
+	if _, _, err := ParseTarget("warm"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
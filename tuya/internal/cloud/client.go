@@ -10,11 +10,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,6 +26,14 @@ type Client struct {
 
 	tokenCachePath string
 	http           *http.Client
+
+	mu         sync.Mutex
+	token      *Token
+	serverTime int64
+
+	endpointMu sync.Mutex
+
+	options Options
 }
 
 type Token struct {
@@ -72,6 +80,9 @@ type apiResponse[T any] struct {
 
 func New(endpoint, accessID, accessKey, userID string) *Client {
 	endpoint = strings.TrimRight(endpoint, "/")
+	if strings.EqualFold(endpoint, EndpointAuto) {
+		endpoint = EndpointAuto
+	}
 	return &Client{
 		endpoint:  endpoint,
 		accessID:  accessID,
@@ -87,75 +98,10 @@ func (c *Client) SetTokenCachePath(path string) {
 	c.tokenCachePath = path
 }
 
-func (c *Client) tokenCacheDefaultPath() (string, error) {
-	if c.tokenCachePath != "" {
-		return c.tokenCachePath, nil
-	}
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(home, ".config", "tuya-hub", "token.json"), nil
-}
-
-func (c *Client) loadToken() (*Token, error) {
-	path, err := c.tokenCacheDefaultPath()
-	if err != nil {
-		return nil, err
-	}
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, nil
-	}
-	var tok Token
-	if err := json.Unmarshal(data, &tok); err != nil {
-		return nil, err
-	}
-	if tok.AccessToken == "" || tok.ExpiresAt == 0 {
-		return nil, nil
-	}
-	now := time.Now().Unix()
-	if tok.ExpiresAt <= now+30 {
-		return nil, nil
-	}
-	return &tok, nil
-}
-
-func (c *Client) saveToken(tok *Token) error {
-	path, err := c.tokenCacheDefaultPath()
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-	data, err := json.MarshalIndent(tok, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, data, 0o600)
-}
-
-func (c *Client) GetToken() (*Token, error) {
-	if c.accessID == "" || c.accessKey == "" {
-		return nil, errors.New("cloud accessId/accessKey missing")
-	}
-
-	if cached, err := c.loadToken(); err == nil && cached != nil {
-		return cached, nil
-	}
-
-	var result Token
-	if err := c.do("GET", "/v1.0/token", url.Values{"grant_type": []string{"1"}}, nil, "", &result); err != nil {
-		return nil, err
-	}
-
-	result.ExpiresAt = time.Now().Unix() + result.ExpireTime - 60
-	if err := c.saveToken(&result); err != nil {
-		return nil, err
-	}
-
-	return &result, nil
+// Endpoint returns the OpenAPI endpoint, resolving cloud.endpoint: auto.
+func (c *Client) Endpoint() string {
+	c.resolveEndpoint()
+	return c.endpoint
 }
 
 func (c *Client) GetDevices() ([]Device, error) {
@@ -246,6 +192,33 @@ func (c *Client) GetUsers(schema string, pageNo, pageSize int, startTime, endTim
 	return &result, nil
 }
 
+// Raw performs a signed request against any OpenAPI path and returns the
+// decoded "result". Token grants are signed without an access token.
+func (c *Client) Raw(method, path string, query url.Values, body json.RawMessage) (json.RawMessage, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	accessToken := ""
+	if !strings.HasPrefix(path, "/v1.0/token") {
+		tok, err := c.GetToken()
+		if err != nil {
+			return nil, err
+		}
+		accessToken = tok.AccessToken
+	} else if err := c.resolveEndpoint(); err != nil {
+		return nil, err
+	}
+	var payload any
+	if body != nil {
+		payload = body
+	}
+	var result json.RawMessage
+	if err := c.do(strings.ToUpper(method), path, query, payload, accessToken, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *Client) do(method, path string, query url.Values, body any, accessToken string, out any) error {
 	reqURL := c.endpoint + path
 	if query != nil && len(query) > 0 {
@@ -263,23 +236,25 @@ func (c *Client) do(method, path string, query url.Values, body any, accessToken
 		bodyBytes = []byte{}
 	}
 
-	contentHash := sha256Hex(bodyBytes)
-
 	pathWithQuery := path
 	if query != nil && len(query) > 0 {
 		pathWithQuery = path + "?" + query.Encode()
 	}
 
-	stringToSign := strings.Join([]string{method, contentHash, "", pathWithQuery}, "\n")
-
-	t := fmt.Sprintf("%d", time.Now().UnixMilli())
-	nonce := uuid()
-	signStr := c.accessID + t + nonce + stringToSign
-	if accessToken != "" {
-		signStr = c.accessID + accessToken + t + nonce + stringToSign
+	headers := c.options.signedHeaders()
+	in := SignInput{
+		ClientID:    c.accessID,
+		Secret:      c.accessKey,
+		AccessToken: accessToken,
+		Timestamp:   fmt.Sprintf("%d", time.Now().UnixMilli()),
+		Nonce:       uuid(),
+		Method:      method,
+		URL:         pathWithQuery,
+		Body:        bodyBytes,
+		Headers:     headers,
 	}
 
-	sign := hmacSHA256Upper(signStr, c.accessKey)
+	slog.Debug("tuya sign", "string_to_sign", StringToSign(in), "signature_headers", SignatureHeaders(headers))
 
 	req, err := http.NewRequest(method, reqURL, bytes.NewReader(bodyBytes))
 	if err != nil {
@@ -287,13 +262,25 @@ func (c *Client) do(method, path string, query url.Values, body any, accessToken
 	}
 
 	req.Header.Set("client_id", c.accessID)
-	req.Header.Set("sign", sign)
-	req.Header.Set("t", t)
+	req.Header.Set("sign", Sign(in))
+	req.Header.Set("t", in.Timestamp)
 	req.Header.Set("sign_method", "HMAC-SHA256")
-	req.Header.Set("nonce", nonce)
+	req.Header.Set("nonce", in.Nonce)
 	if accessToken != "" {
 		req.Header.Set("access_token", accessToken)
 	}
+	if len(headers) > 0 {
+		for _, h := range headers {
+			req.Header.Set(h.Name, h.Value)
+		}
+		req.Header.Set("Signature-Headers", SignatureHeaders(headers))
+	}
+	if c.options.Lang != "" {
+		req.Header.Set("lang", c.options.Lang)
+	}
+	if c.options.Mode != "" {
+		req.Header.Set("mode", c.options.Mode)
+	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -313,33 +300,61 @@ func (c *Client) do(method, path string, query url.Values, body any, accessToken
 		return fmt.Errorf("tuya api error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
 	}
 
-	if out == nil {
-		return nil
+	serverTime, err := decodeResponse(data, out)
+	if serverTime != 0 {
+		c.mu.Lock()
+		c.serverTime = serverTime
+		c.mu.Unlock()
 	}
+	return err
+}
 
-	return decodeResponse(data, out)
+// APIError is a failed Tuya response ({"success":false,"code":...}).
+type APIError struct {
+	Code int
+	Msg  string
 }
 
-func decodeResponse(data []byte, out any) error {
+func (e *APIError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = "tuya api error"
+	}
+	if e.Code != 0 {
+		return fmt.Sprintf("%s (code %d)", msg, e.Code)
+	}
+	return msg
+}
+
+func decodeResponse(data []byte, out any) (int64, error) {
 	var wrapper struct {
 		Success bool            `json:"success"`
 		Result  json.RawMessage `json:"result"`
 		Msg     string          `json:"msg"`
 		Code    int             `json:"code"`
+		T       int64           `json:"t"`
 	}
 	if err := json.Unmarshal(data, &wrapper); err != nil {
-		return err
+		return 0, err
 	}
 	if !wrapper.Success {
-		if wrapper.Msg != "" {
-			return errors.New(wrapper.Msg)
-		}
-		return errors.New("tuya api error")
+		return wrapper.T, &APIError{Code: wrapper.Code, Msg: wrapper.Msg}
 	}
 	if out == nil {
-		return nil
+		return wrapper.T, nil
+	}
+	return wrapper.T, json.Unmarshal(wrapper.Result, out)
+}
+
+// ServerTime returns the "t" timestamp of the last Tuya response, or the
+// zero time when none has been seen.
+func (c *Client) ServerTime() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.serverTime == 0 {
+		return time.Time{}
 	}
-	return json.Unmarshal(wrapper.Result, out)
+	return time.UnixMilli(c.serverTime)
 }
 
 func sha256Hex(data []byte) string {
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package cloud
+
+// lockFile is a no-op where flock is unavailable; writes stay atomic.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,187 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// EndpointAuto as cloud.endpoint makes the client detect the data center on
+// first use and remember it next to the token cache.
+const EndpointAuto = "auto"
+
+// Region is a Tuya data center: its OpenAPI endpoint and the Pulsar message
+// queue used for device events.
+type Region struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+	URL   string `json:"url"`
+	MQ    string `json:"mq,omitempty"`
+}
+
+var Regions = []Region{
+	{Code: "us", Label: "Western America", URL: "https://openapi.tuyaus.com", MQ: "pulsar+ssl://mqe.tuyaus.com:7285/"},
+	{Code: "us-east", Label: "Eastern America", URL: "https://openapi-ueaz.tuyaus.com", MQ: "pulsar+ssl://mqe-ueaz.tuyaus.com:7285/"},
+	{Code: "eu", Label: "Central Europe", URL: "https://openapi.tuyaeu.com", MQ: "pulsar+ssl://mqe.tuyaeu.com:7285/"},
+	{Code: "eu-west", Label: "Western Europe", URL: "https://openapi-weaz.tuyaeu.com", MQ: "pulsar+ssl://mqe-weaz.tuyaeu.com:7285/"},
+	{Code: "cn", Label: "China", URL: "https://openapi.tuyacn.com", MQ: "pulsar+ssl://mqe.tuyacn.com:7285/"},
+	{Code: "in", Label: "India", URL: "https://openapi.tuyain.com", MQ: "pulsar+ssl://mqe.tuyain.com:7285/"},
+	{Code: "sg", Label: "Singapore", URL: "https://openapi-sg.iotbing.com"},
+}
+
+// RegionByCode looks up a region by its short code (eu, us-east, ...).
+func RegionByCode(code string) (Region, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	for _, r := range Regions {
+		if r.Code == code {
+			return r, true
+		}
+	}
+	return Region{}, false
+}
+
+// RegionForEndpoint returns the region whose OpenAPI endpoint is url.
+func RegionForEndpoint(url string) (Region, bool) {
+	url = strings.TrimRight(strings.TrimSpace(url), "/")
+	for _, r := range Regions {
+		if strings.EqualFold(r.URL, url) {
+			return r, true
+		}
+	}
+	return Region{}, false
+}
+
+// Probe is the outcome of trying credentials against one region.
+type Probe struct {
+	Region
+	Token   bool   `json:"token"`
+	Devices int    `json:"devices"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProbeRegions grants a token and lists devices in every region in parallel.
+// Probes use throwaway clients and never touch the token cache.
+func ProbeRegions(accessID, accessKey, userID string) []Probe {
+	results := make([]Probe, len(Regions))
+	var wg sync.WaitGroup
+	for i, r := range Regions {
+		wg.Add(1)
+		go func(i int, r Region) {
+			defer wg.Done()
+			res := Probe{Region: r}
+			client := New(r.URL, accessID, accessKey, userID)
+			if _, err := client.RequestToken(); err != nil {
+				res.Error = err.Error()
+				results[i] = res
+				return
+			}
+			res.Token = true
+			devices, err := client.GetDevices()
+			if err != nil {
+				res.Error = err.Error()
+			}
+			res.Devices = len(devices)
+			results[i] = res
+		}(i, r)
+	}
+	wg.Wait()
+	return results
+}
+
+// ErrRegionNotFound means no region both accepted the credentials and could
+// be singled out as the project's home.
+var ErrRegionNotFound = errors.New("no data center accepted these credentials")
+
+// DetectRegion finds the region holding the project's linked devices. When
+// no region returns devices but exactly one grants a token, that region is
+// the project's data center and is returned.
+func DetectRegion(accessID, accessKey, userID string) (Region, []Probe, error) {
+	probes := ProbeRegions(accessID, accessKey, userID)
+	if best, ok := BestProbe(probes); ok {
+		return best.Region, probes, nil
+	}
+	return Region{}, probes, ErrRegionNotFound
+}
+
+// BestProbe picks the region with the most devices, falling back to the only
+// region that granted a token.
+func BestProbe(probes []Probe) (Probe, bool) {
+	var best *Probe
+	granted := []Probe{}
+	for i := range probes {
+		p := &probes[i]
+		if p.Token {
+			granted = append(granted, *p)
+		}
+		if p.Devices > 0 && (best == nil || p.Devices > best.Devices) {
+			best = p
+		}
+	}
+	if best != nil {
+		return *best, true
+	}
+	if len(granted) == 1 {
+		return granted[0], true
+	}
+	return Probe{}, false
+}
+
+// regionCache maps access IDs to detected endpoints.
+type regionCache map[string]string
+
+func (c *Client) regionCachePath() (string, error) {
+	path, err := c.tokenCacheDefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "regions.json"), nil
+}
+
+// resolveEndpoint replaces EndpointAuto with a concrete endpoint, from the
+// region cache or by detection.
+func (c *Client) resolveEndpoint() error {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+	if c.endpoint != EndpointAuto {
+		return nil
+	}
+
+	path, err := c.regionCachePath()
+	if err != nil {
+		return err
+	}
+	cache := regionCache{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	if url := cache[c.accessID]; url != "" {
+		c.endpoint = url
+		return nil
+	}
+
+	region, probes, err := DetectRegion(c.accessID, c.accessKey, c.userID)
+	if err != nil {
+		var errs []string
+		for _, p := range probes {
+			if p.Error != "" {
+				errs = append(errs, p.Code+": "+p.Error)
+			}
+		}
+		return fmt.Errorf("cloud.endpoint auto: %w (%s)", err, strings.Join(errs, "; "))
+	}
+	c.endpoint = region.URL
+
+	cache[c.accessID] = region.URL
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
@@ -0,0 +1,53 @@
+package cloud
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegionLookup(t *testing.T) {
+	r, ok := RegionForEndpoint("https://openapi-weaz.tuyaeu.com/")
+	if !ok || r.Code != "eu-west" {
+		t.Fatalf("expected eu-west, got %+v", r)
+	}
+	if _, ok := RegionByCode("IN"); !ok {
+		t.Fatalf("expected india region")
+	}
+	if _, ok := RegionForEndpoint("https://example.com"); ok {
+		t.Fatalf("expected no region for unknown endpoint")
+	}
+}
+
+func TestBestProbe(t *testing.T) {
+	probes := []Probe{
+		{Region: Region{Code: "us"}, Token: true},
+		{Region: Region{Code: "eu"}, Token: true, Devices: 2},
+		{Region: Region{Code: "cn"}, Error: "clientId is invalid"},
+	}
+	if best, ok := BestProbe(probes); !ok || best.Code != "eu" {
+		t.Fatalf("expected eu, got %+v", best)
+	}
+
+	probes[1].Devices = 0
+	if _, ok := BestProbe(probes); ok {
+		t.Fatalf("expected no pick when two regions grant tokens without devices")
+	}
+
+	probes[0].Token = false
+	if best, ok := BestProbe(probes); !ok || best.Code != "eu" {
+		t.Fatalf("expected the only granting region, got %+v", best)
+	}
+}
+
+func TestAutoEndpointUsesRegionCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "regions.json"), []byte(`{"id":"https://openapi.tuyain.com"}`), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	c := New("Auto", "id", "key", "")
+	c.SetTokenCachePath(filepath.Join(dir, "token.json"))
+	if got := c.Endpoint(); got != "https://openapi.tuyain.com" {
+		t.Fatalf("expected cached endpoint, got %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+package cloud
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Examples from Tuya's "Sign requests for cloud authorization" documentation.
+var docHeaders = []Header{
+	{Name: "area_id", Value: "29a33e8796834b1efa6"},
+	{Name: "call_id", Value: "8afdb70ab2ed11eb85290242ac130003"},
+}
+
+func docInput(accessToken string) SignInput {
+	return SignInput{
+		ClientID:    "1KAD46OrT9HafiKdsXeg",
+		Secret:      "4OHBOnWOqaEC1mWXOpVL3yV50s0qGSRC",
+		AccessToken: accessToken,
+		Timestamp:   "1588925778000",
+		Nonce:       "5138cc3a9033d69856923fd07b491173",
+		Method:      "GET",
+		URL:         "/v1.0/token?grant_type=1",
+		Headers:     docHeaders,
+	}
+}
+
+func TestStringToSign(t *testing.T) {
+	want := "GET\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\narea_id:29a33e8796834b1efa6\ncall_id:8afdb70ab2ed11eb85290242ac130003\n\n/v1.0/token?grant_type=1"
+	if got := StringToSign(docInput("")); got != want {
+		t.Fatalf("unexpected stringToSign:\n%q\nwant\n%q", got, want)
+	}
+	if got := SignatureHeaders(docHeaders); got != "area_id:call_id" {
+		t.Fatalf("unexpected Signature-Headers: %q", got)
+	}
+}
+
+func TestSignGolden(t *testing.T) {
+	tokenSign := "9E48A3E93B302EEECC803C7241985D0A34EB944F40FB573C7B5C2A82158AF13E"
+	if got := Sign(docInput("")); got != tokenSign {
+		t.Fatalf("token request sign = %s, want %s", got, tokenSign)
+	}
+	in := docInput("3f4eda2bdec17232f67c0b188af3eec1")
+	in.URL = "/v2.0/apps/schema/users?page_no=1&page_size=50"
+	businessSign := "AE4481C692AA80B25F3A7E12C3A5FD9BBF6251539DD78E565A1A72A508A88784"
+	if got := Sign(in); got != businessSign {
+		t.Fatalf("business request sign = %s, want %s", got, businessSign)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	in := docInput("")
+	if !Verify(in, "9e48a3e93b302eeecc803c7241985d0a34eb944f40fb573c7b5c2a82158af13e") {
+		t.Fatalf("expected lower-case signature to verify")
+	}
+	in.Body = []byte(`{"x":1}`)
+	if Verify(in, "9E48A3E93B302EEECC803C7241985D0A34EB944F40FB573C7B5C2A82158AF13E") {
+		t.Fatalf("expected signature over a different body to fail")
+	}
+}
+
+func TestOptionsSignedHeaders(t *testing.T) {
+	o := Options{AreaID: "a1", Lang: "en", Headers: map[string]string{"call_id": "c", "area_id": "ignored"}}
+	got := SignatureHeaders(o.signedHeaders())
+	if got != "area_id:call_id" {
+		t.Fatalf("unexpected signed headers: %q", got)
+	}
+}
+
+func TestClientSendsSignedHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var headers []Header
+		for _, name := range strings.Split(r.Header.Get("Signature-Headers"), ":") {
+			headers = append(headers, Header{Name: name, Value: r.Header.Get(name)})
+		}
+		in := SignInput{
+			ClientID:    r.Header.Get("client_id"),
+			Secret:      "key",
+			AccessToken: r.Header.Get("access_token"),
+			Timestamp:   r.Header.Get("t"),
+			Nonce:       r.Header.Get("nonce"),
+			Method:      r.Method,
+			URL:         r.URL.RequestURI(),
+			Body:        body,
+			Headers:     headers,
+		}
+		if !Verify(in, r.Header.Get("sign")) || r.Header.Get("lang") != "de" {
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "code": 1004, "msg": "sign invalid"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": map[string]any{"access_token": "tok", "expire_time": 7200}})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "id", "key", "")
+	c.SetTokenCachePath(filepath.Join(t.TempDir(), "token.json"))
+	c.SetOptions(Options{Lang: "de", AreaID: "area", Headers: map[string]string{"call_id": "c1"}})
+	if _, err := c.RequestToken(); err != nil {
+		t.Fatalf("token request failed: %v", err)
+	}
+}
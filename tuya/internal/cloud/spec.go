@@ -0,0 +1,145 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// SpecItem is one data point (DP) from a device specification. Values is the
+// raw JSON string Tuya returns, e.g. {"min":0,"max":1000,"scale":1,"step":1}.
+type SpecItem struct {
+	Code   string `json:"code"`
+	Type   string `json:"type"`
+	Values string `json:"values"`
+}
+
+type Spec struct {
+	Category  string     `json:"category"`
+	Functions []SpecItem `json:"functions"`
+	Status    []SpecItem `json:"status"`
+}
+
+// SpecValues is the decoded form of SpecItem.Values.
+type SpecValues struct {
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Scale int      `json:"scale,omitempty"`
+	Step  float64  `json:"step,omitempty"`
+	Unit  string   `json:"unit,omitempty"`
+	Range []string `json:"range,omitempty"`
+}
+
+func (s SpecItem) Parsed() (SpecValues, error) {
+	var out SpecValues
+	if strings.TrimSpace(s.Values) == "" || s.Values == "{}" {
+		return out, nil
+	}
+	if err := json.Unmarshal([]byte(s.Values), &out); err != nil {
+		return out, fmt.Errorf("spec %s: %w", s.Code, err)
+	}
+	return out, nil
+}
+
+// Scaled converts a raw integer DP value to its real value: Tuya reports
+// 23.5 with scale 1 as 235.
+func (v SpecValues) Scaled(raw float64) float64 {
+	return raw / math.Pow(10, float64(v.Scale))
+}
+
+// Raw is the inverse of Scaled: it turns a real value into the DP's raw
+// integer, snapped to the step.
+func (v SpecValues) Raw(real float64) float64 {
+	raw := real * math.Pow(10, float64(v.Scale))
+	if v.Step > 0 {
+		raw = math.Round(raw/v.Step) * v.Step
+	}
+	return math.Round(raw)
+}
+
+// InRange reports whether a raw value lies within the DP's min and max.
+func (v SpecValues) InRange(raw float64) bool {
+	return (v.Min == nil || raw >= *v.Min) && (v.Max == nil || raw <= *v.Max)
+}
+
+// Function returns the writable DP with the given code.
+func (s *Spec) Function(code string) (SpecItem, bool) {
+	for _, f := range s.Functions {
+		if f.Code == code {
+			return f, true
+		}
+	}
+	return SpecItem{}, false
+}
+
+// StatusItem returns the reported DP with the given code.
+func (s *Spec) StatusItem(code string) (SpecItem, bool) {
+	for _, st := range s.Status {
+		if st.Code == code {
+			return st, true
+		}
+	}
+	return SpecItem{}, false
+}
+
+// JSONSchema describes the accepted value of the DP as a JSON schema.
+func (s SpecItem) JSONSchema() map[string]any {
+	values, _ := s.Parsed()
+	schema := map[string]any{}
+	switch strings.ToLower(s.Type) {
+	case "boolean", "bool":
+		schema["type"] = "boolean"
+	case "integer", "value":
+		schema["type"] = "integer"
+		if values.Min != nil {
+			schema["minimum"] = *values.Min
+		}
+		if values.Max != nil {
+			schema["maximum"] = *values.Max
+		}
+		if values.Step > 1 {
+			schema["multipleOf"] = values.Step
+		}
+	case "enum":
+		schema["type"] = "string"
+		if len(values.Range) > 0 {
+			schema["enum"] = values.Range
+		}
+	case "json":
+		schema["type"] = []string{"object", "string"}
+	default:
+		schema["type"] = "string"
+	}
+	if values.Unit != "" {
+		schema["description"] = "unit: " + values.Unit
+	}
+	return schema
+}
+
+func (c *Client) GetDeviceSpec(deviceID string) (*Spec, error) {
+	tok, err := c.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/v1.0/iot-03/devices/%s/specification", url.PathEscape(deviceID))
+	var result Spec
+	if err := c.do("GET", path, nil, nil, tok.AccessToken, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) TriggerScene(homeID, sceneID string) error {
+	if strings.TrimSpace(homeID) == "" || strings.TrimSpace(sceneID) == "" {
+		return fmt.Errorf("home id and scene id required")
+	}
+	tok, err := c.GetToken()
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/v1.0/homes/%s/scenes/%s/trigger", url.PathEscape(homeID), url.PathEscape(sceneID))
+	var result any
+	return c.do("POST", path, nil, nil, tok.AccessToken, &result)
+}
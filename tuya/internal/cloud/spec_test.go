@@ -0,0 +1,17 @@
+package cloud
+
+import "testing"
+
+func TestSpecValuesRaw(t *testing.T) {
+	min, max := 50.0, 350.0
+	v := SpecValues{Min: &min, Max: &max, Scale: 1, Step: 5}
+	if raw := v.Raw(21.3); raw != 215 {
+		t.Fatalf("expected 215, got %v", raw)
+	}
+	if got := v.Scaled(v.Raw(21.5)); got != 21.5 {
+		t.Fatalf("expected Raw to invert Scaled, got %v", got)
+	}
+	if v.InRange(v.Raw(40)) || !v.InRange(v.Raw(35)) {
+		t.Fatalf("unexpected range check for %+v", v)
+	}
+}
@@ -0,0 +1,62 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func statsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result any
+		switch r.URL.Path {
+		case "/v1.0/token":
+			result = map[string]any{"access_token": "tok", "expire_time": 7200, "uid": "u"}
+		case "/v1.0/devices/plug/statistics/days":
+			if r.URL.Query().Get("code") != "add_ele" || r.URL.Query().Get("start_day") != "20261012" {
+				http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+				return
+			}
+			result = map[string]any{"days": map[string]any{"20261012": "0.25", "20261013": 1.5}}
+		case "/v2.0/cloud/thing/plug/report-logs":
+			if r.URL.Query().Get("last_row_key") == "" {
+				result = map[string]any{"logs": []map[string]any{{"code": "add_ele", "value": "5", "event_time": 2000}}, "has_more": true, "last_row_key": "k1"}
+			} else {
+				result = map[string]any{"logs": []map[string]any{{"code": "add_ele", "value": "3", "event_time": 1000}}, "has_more": false}
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStatisticsAndReportLogs(t *testing.T) {
+	srv := statsServer(t)
+	c := New(srv.URL, "id", "key", "")
+	c.SetTokenCachePath(filepath.Join(t.TempDir(), "token.json"))
+
+	day := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	days, err := c.StatisticsDays("plug", "add_ele", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("statistics failed: %v", err)
+	}
+	if days["20261012"] != 0.25 || days["20261013"] != 1.5 {
+		t.Fatalf("unexpected statistics: %v", days)
+	}
+
+	logs, err := c.ReportLogs("plug", []string{"add_ele"}, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("report logs failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].EventTime != 1000 || logs[1].Value != "5" {
+		t.Fatalf("expected both pages oldest first, got %+v", logs)
+	}
+}
@@ -0,0 +1,244 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// tokenMargin is how long before expiry a cached token stops being reused.
+const tokenMargin = 30
+
+// The token cache file maps "<accessId>@<endpoint>" to a token, so several
+// projects and data centers can share one file without serving each other's
+// tokens.
+type tokenCache map[string]*Token
+
+func (c *Client) tokenCacheDefaultPath() (string, error) {
+	if c.tokenCachePath != "" {
+		return c.tokenCachePath, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "tuya-hub", "token.json"), nil
+}
+
+func (c *Client) tokenCacheKey() string {
+	return c.accessID + "@" + c.endpoint
+}
+
+func readTokenCache(path string) (tokenCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tokenCache{}, nil
+		}
+		return nil, err
+	}
+	cache := tokenCache{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		// Older releases stored a single unkeyed token; start over.
+		return tokenCache{}, nil
+	}
+	return cache, nil
+}
+
+func validToken(tok *Token) bool {
+	return tok != nil && tok.AccessToken != "" && tok.ExpiresAt > time.Now().Unix()+tokenMargin
+}
+
+func (c *Client) loadToken() (*Token, error) {
+	path, err := c.tokenCacheDefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := readTokenCache(path)
+	if err != nil {
+		return nil, err
+	}
+	tok := cache[c.tokenCacheKey()]
+	if !validToken(tok) {
+		return nil, nil
+	}
+	return tok, nil
+}
+
+// saveToken merges tok into the cache file, dropping expired entries, and
+// replaces the file atomically. Callers hold the cache lock.
+func (c *Client) saveToken(tok *Token) error {
+	path, err := c.tokenCacheDefaultPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	cache, err := readTokenCache(path)
+	if err != nil {
+		return err
+	}
+	for key, t := range cache {
+		if !validToken(t) {
+			delete(cache, key)
+		}
+	}
+	cache[c.tokenCacheKey()] = tok
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Client) GetToken() (*Token, error) {
+	if c.accessID == "" || c.accessKey == "" {
+		return nil, errors.New("cloud accessId/accessKey missing")
+	}
+	if err := c.resolveEndpoint(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if validToken(c.token) {
+		tok := c.token
+		c.mu.Unlock()
+		return tok, nil
+	}
+	c.mu.Unlock()
+
+	tok, err := tokenFlight.do(c.tokenCacheKey(), c.fetchToken)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.token = tok
+	c.mu.Unlock()
+	return tok, nil
+}
+
+// fetchToken returns a cached token or grants a new one. The advisory lock
+// makes concurrent processes wait for a single refresh instead of racing.
+func (c *Client) fetchToken() (*Token, error) {
+	if cached, err := c.loadToken(); err == nil && cached != nil {
+		return cached, nil
+	}
+
+	path, err := c.tokenCacheDefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if cached, err := c.loadToken(); err == nil && cached != nil {
+		return cached, nil
+	}
+
+	tok, err := c.grantToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.saveToken(tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+func (c *Client) grantToken() (*Token, error) {
+	var result Token
+	if err := c.do("GET", "/v1.0/token", url.Values{"grant_type": []string{"1"}}, nil, "", &result); err != nil {
+		return nil, err
+	}
+	result.ExpiresAt = time.Now().Unix() + result.ExpireTime - 60
+	return &result, nil
+}
+
+// RequestToken performs a fresh token grant without touching the cache file.
+// The token is kept in memory for later calls on this client; diagnostics use
+// it to validate credentials against a specific endpoint.
+func (c *Client) RequestToken() (*Token, error) {
+	if c.accessID == "" || c.accessKey == "" {
+		return nil, errors.New("cloud accessId/accessKey missing")
+	}
+	if err := c.resolveEndpoint(); err != nil {
+		return nil, err
+	}
+	tok, err := c.grantToken()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.token = tok
+	c.mu.Unlock()
+	return tok, nil
+}
+
+// flightGroup collapses concurrent calls with the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	tok *Token
+	err error
+}
+
+var tokenFlight = &flightGroup{}
+
+func (g *flightGroup) do(key string, fn func() (*Token, error)) (*Token, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.tok, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.tok, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.tok, call.err
+}
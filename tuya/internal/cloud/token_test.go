@@ -0,0 +1,111 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func tokenServer(t *testing.T, grants *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0/token" {
+			http.NotFound(w, r)
+			return
+		}
+		n := atomic.AddInt32(grants, 1)
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"result":  map[string]any{"access_token": "tok-" + string(rune('0'+n)), "expire_time": 7200, "uid": "u"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetTokenSingleFlight(t *testing.T) {
+	var grants int32
+	srv := tokenServer(t, &grants)
+	cachePath := filepath.Join(t.TempDir(), "token.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := New(srv.URL, "id", "key", "")
+			c.SetTokenCachePath(cachePath)
+			if _, err := c.GetToken(); err != nil {
+				t.Errorf("get token failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if grants != 1 {
+		t.Fatalf("expected one token grant, got %d", grants)
+	}
+}
+
+func TestTokenCacheKeyedByProject(t *testing.T) {
+	var grants int32
+	srv := tokenServer(t, &grants)
+	cachePath := filepath.Join(t.TempDir(), "token.json")
+
+	a := New(srv.URL, "project-a", "key", "")
+	a.SetTokenCachePath(cachePath)
+	b := New(srv.URL, "project-b", "key", "")
+	b.SetTokenCachePath(cachePath)
+
+	tokA, err := a.GetToken()
+	if err != nil {
+		t.Fatalf("get token a failed: %v", err)
+	}
+	tokB, err := b.GetToken()
+	if err != nil {
+		t.Fatalf("get token b failed: %v", err)
+	}
+	if tokA.AccessToken == tokB.AccessToken {
+		t.Fatalf("expected separate tokens per access id")
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatalf("read cache failed: %v", err)
+	}
+	var cache map[string]Token
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatalf("decode cache failed: %v", err)
+	}
+	if len(cache) != 2 {
+		t.Fatalf("expected 2 cached tokens, got %d", len(cache))
+	}
+
+	// A fresh client for project a reuses the cached token from disk.
+	again := New(srv.URL, "project-a", "key", "")
+	again.SetTokenCachePath(cachePath)
+	tok, err := again.GetToken()
+	if err != nil || tok.AccessToken != tokA.AccessToken {
+		t.Fatalf("expected cached token %q, got %v (%v)", tokA.AccessToken, tok, err)
+	}
+	if grants != 2 {
+		t.Fatalf("expected 2 grants, got %d", grants)
+	}
+}
+
+func TestLegacyTokenFileIgnored(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "token.json")
+	os.WriteFile(cachePath, []byte(`{"access_token":"old","expires_at":99999999999}`), 0o600)
+	c := New("https://example.invalid", "id", "key", "")
+	c.SetTokenCachePath(cachePath)
+	tok, err := c.loadToken()
+	if err != nil || tok != nil {
+		t.Fatalf("expected legacy file to be ignored, got %v (%v)", tok, err)
+	}
+}
@@ -2,11 +2,17 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"tuya-hub/internal/secret"
 )
 
 type HomeAssistant struct {
@@ -21,22 +27,172 @@ type Cloud struct {
 	Region    string `yaml:"region"`
 	Schema    string `yaml:"schema"`
 	UserID    string `yaml:"userId"`
+	// Lang localizes device and room names (lang header), e.g. "en".
+	Lang string `yaml:"lang,omitempty"`
+	// AreaID and Headers are sent as signed headers; Mode as the mode header.
+	AreaID  string            `yaml:"areaId,omitempty"`
+	Mode    string            `yaml:"mode,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// Location places solar schedules. Latitude and longitude are pointers so
+// that a block with only a timezone is not taken for 0,0.
+type Location struct {
+	Latitude  *float64 `yaml:"latitude,omitempty"`
+	Longitude *float64 `yaml:"longitude,omitempty"`
+	Timezone  string   `yaml:"timezone,omitempty"`
+}
+
+// HasCoordinates reports whether both latitude and longitude are set.
+func (l *Location) HasCoordinates() bool {
+	return l != nil && l.Latitude != nil && l.Longitude != nil
+}
+
+type Schedule struct {
+	Name     string   `yaml:"name"`
+	At       string   `yaml:"at"`
+	Command  []string `yaml:"command"`
+	Disabled bool     `yaml:"disabled,omitempty"`
+}
+
+type Scheduler struct {
+	CatchUp       string `yaml:"catchUp,omitempty"`
+	CatchUpWindow string `yaml:"catchUpWindow,omitempty"`
+	LogPath       string `yaml:"logPath,omitempty"`
+	StatePath     string `yaml:"statePath,omitempty"`
+}
+
+type Server struct {
+	Listen   string `yaml:"listen,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+	CacheTTL string `yaml:"cacheTTL,omitempty"`
+}
+
+type MCP struct {
+	AllowWrite    []string `yaml:"allowWrite,omitempty"`
+	AllowServices []string `yaml:"allowServices,omitempty"`
+	AllowScenes   []string `yaml:"allowScenes,omitempty"`
+	HomeID        string   `yaml:"homeId,omitempty"`
+}
+
+type SafetyRules struct {
+	Entities []string `yaml:"entities,omitempty"`
+	Devices  []string `yaml:"devices,omitempty"`
+	Codes    []string `yaml:"codes,omitempty"`
+	Services []string `yaml:"services,omitempty"`
+}
+
+type Safety struct {
+	ReadOnly bool        `yaml:"readOnly,omitempty"`
+	Default  string      `yaml:"default,omitempty"`
+	Allow    SafetyRules `yaml:"allow,omitempty"`
+	Deny     SafetyRules `yaml:"deny,omitempty"`
+}
+
+type Profile struct {
+	Backend       string            `yaml:"backend,omitempty"`
+	HomeAssistant HomeAssistant     `yaml:"homeAssistant,omitempty"`
+	Cloud         Cloud             `yaml:"cloud,omitempty"`
+	Aliases       map[string]string `yaml:"aliases,omitempty"`
+	Safety        *Safety           `yaml:"safety,omitempty"`
+	ReadOnly      bool              `yaml:"readOnly,omitempty"`
+}
+
+// SensorKind defines a poll --kind, or replaces a built-in one of the same
+// name. Codes are Tuya DP codes and may use * globs.
+type SensorKind struct {
+	Unit          string   `yaml:"unit,omitempty"`
+	DeviceClasses []string `yaml:"deviceClasses,omitempty"`
+	Units         []string `yaml:"units,omitempty"`
+	Codes         []string `yaml:"codes,omitempty"`
+	Categories    []string `yaml:"categories,omitempty"`
+}
+
+// Units picks the units poll reports readings in. System is metric (the
+// default) or imperial; Kinds overrides the unit per sensor kind, e.g.
+// {temperature: °C, power: kW}.
+type Units struct {
+	System string            `yaml:"system,omitempty"`
+	Kinds  map[string]string `yaml:"kinds,omitempty"`
+}
+
+// Tariff prices energy for tuya energy. Rate applies per kWh wherever no
+// period matches, so a flat tariff is just a rate.
+type Tariff struct {
+	Currency string         `yaml:"currency,omitempty"`
+	Rate     float64        `yaml:"rate,omitempty"`
+	Periods  []TariffPeriod `yaml:"periods,omitempty"`
+}
+
+// TariffPeriod is a time-of-use window, From to To as HH:MM local time; it
+// may cross midnight. Days (mon..sun) limits it to those weekdays.
+type TariffPeriod struct {
+	Name string   `yaml:"name,omitempty"`
+	From string   `yaml:"from"`
+	To   string   `yaml:"to"`
+	Days []string `yaml:"days,omitempty"`
+	Rate float64  `yaml:"rate"`
+}
+
+type Vault struct {
+	Path       string `yaml:"path,omitempty"`
+	Passphrase string `yaml:"passphrase,omitempty"`
 }
 
 type Config struct {
-	Backend       string        `yaml:"backend"`
-	HomeAssistant HomeAssistant `yaml:"homeAssistant"`
-	Cloud         Cloud         `yaml:"cloud"`
+	Version       int                   `yaml:"version"`
+	Backend       string                `yaml:"backend,omitempty"`
+	HomeAssistant HomeAssistant         `yaml:"homeAssistant,omitempty"`
+	Cloud         Cloud                 `yaml:"cloud,omitempty"`
+	Aliases       map[string]string     `yaml:"aliases,omitempty"`
+	Profile       string                `yaml:"profile,omitempty"`
+	Profiles      map[string]*Profile   `yaml:"profiles,omitempty"`
+	Server        Server                `yaml:"server,omitempty"`
+	MCP           MCP                   `yaml:"mcp,omitempty"`
+	Safety        Safety                `yaml:"safety,omitempty"`
+	Vault         Vault                 `yaml:"vault,omitempty"`
+	Location      *Location             `yaml:"location,omitempty"`
+	Scheduler     Scheduler             `yaml:"scheduler,omitempty"`
+	Schedules     []Schedule            `yaml:"schedules,omitempty"`
+	SensorKinds   map[string]SensorKind `yaml:"sensorKinds,omitempty"`
+	Units         Units                 `yaml:"units,omitempty"`
+	Rooms         map[string][]string   `yaml:"rooms,omitempty"`
+	Groups        map[string][]string   `yaml:"groups,omitempty"`
+	Tariff        Tariff                `yaml:"tariff,omitempty"`
+
+	// Active is the profile applied by UseProfile; it is never written out.
+	Active string `yaml:"-"`
+	// Warnings lists unknown keys found by Load.
+	Warnings []string `yaml:"-"`
+	// MigratedFrom is the file's version when Load upgraded an older layout,
+	// and 0 otherwise. Callers persist the upgrade with Save.
+	MigratedFrom int `yaml:"-"`
 }
 
-func DefaultPath() (string, error) {
+func DefaultDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".config", "tuya-hub", "config.yaml"), nil
+	return filepath.Join(home, ".config", "tuya-hub"), nil
+}
+
+// DefaultPath is the config used without --config: TUYA_CONFIG when set,
+// else config.yaml in DefaultDir.
+func DefaultPath() (string, error) {
+	if p := strings.TrimSpace(os.Getenv("TUYA_CONFIG")); p != "" {
+		return p, nil
+	}
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
 }
 
+// Load reads the config at path (default DefaultPath). A missing file yields
+// an empty config; any other read error is returned. Unknown keys are
+// reported in Warnings and older layouts are migrated in memory.
 func Load(path string) (*Config, error) {
 	if path == "" {
 		var err error
@@ -47,13 +203,32 @@ func Load(path string) (*Config, error) {
 	}
 	data, err := os.ReadFile(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
 		return &Config{}, nil
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	warnings := unknownKeys(&doc, filepath.Base(path))
+	from, err := migrate(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg := &Config{}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
 	}
-	return &cfg, nil
+	cfg.Warnings = warnings
+	if from < CurrentVersion {
+		cfg.MigratedFrom = from
+	}
+	return cfg, nil
 }
 
 func (c *Config) ApplyEnv() {
@@ -84,6 +259,221 @@ func (c *Config) ApplyEnv() {
 	if v := strings.TrimSpace(os.Getenv("TUYA_CLOUD_USER_ID")); v != "" {
 		c.Cloud.UserID = v
 	}
+	if v := strings.TrimSpace(os.Getenv("TUYA_CLOUD_LANG")); v != "" {
+		c.Cloud.Lang = v
+	}
+	if v := strings.TrimSpace(os.Getenv("TUYA_SERVER_TOKEN")); v != "" {
+		c.Server.Token = v
+	}
+}
+
+// UseProfile overlays the named profile onto the top-level settings. An empty
+// name falls back to TUYA_PROFILE, then to the config's default profile.
+func (c *Config) UseProfile(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = c.selectedProfile()
+	}
+	if name == "" {
+		return nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		names := c.ProfileNames()
+		if len(names) == 0 {
+			return fmt.Errorf("profile %q not found (no profiles configured)", name)
+		}
+		return fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	if p.Backend != "" {
+		c.Backend = p.Backend
+	}
+	overlayString(&c.HomeAssistant.URL, p.HomeAssistant.URL)
+	overlayString(&c.HomeAssistant.Token, p.HomeAssistant.Token)
+	overlayString(&c.Cloud.AccessID, p.Cloud.AccessID)
+	overlayString(&c.Cloud.AccessKey, p.Cloud.AccessKey)
+	overlayString(&c.Cloud.Endpoint, p.Cloud.Endpoint)
+	overlayString(&c.Cloud.Region, p.Cloud.Region)
+	overlayString(&c.Cloud.Schema, p.Cloud.Schema)
+	overlayString(&c.Cloud.UserID, p.Cloud.UserID)
+	overlayString(&c.Cloud.Lang, p.Cloud.Lang)
+	overlayString(&c.Cloud.AreaID, p.Cloud.AreaID)
+	overlayString(&c.Cloud.Mode, p.Cloud.Mode)
+	if len(p.Cloud.Headers) > 0 {
+		c.Cloud.Headers = p.Cloud.Headers
+	}
+	if len(p.Aliases) > 0 {
+		merged := map[string]string{}
+		for k, v := range c.Aliases {
+			merged[k] = v
+		}
+		for k, v := range p.Aliases {
+			merged[k] = v
+		}
+		c.Aliases = merged
+	}
+	if p.Safety != nil {
+		c.Safety = *p.Safety
+	}
+	if p.ReadOnly {
+		c.Safety.ReadOnly = true
+	}
+	c.Active = name
+	return nil
+}
+
+// selectedProfile names the profile in use: the applied one, else
+// TUYA_PROFILE, else the config's default.
+func (c *Config) selectedProfile() string {
+	if c.Active != "" {
+		return c.Active
+	}
+	if name := strings.TrimSpace(os.Getenv("TUYA_PROFILE")); name != "" {
+		return name
+	}
+	return strings.TrimSpace(c.Profile)
+}
+
+func overlayString(dst *string, v string) {
+	if strings.TrimSpace(v) != "" {
+		*dst = v
+	}
+}
+
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveAlias maps a configured alias to its device or entity id.
+func (c *Config) ResolveAlias(id string) string {
+	if v, ok := c.Aliases[strings.TrimSpace(id)]; ok && v != "" {
+		return v
+	}
+	return id
+}
+
+// RoomOf returns the room listing id, directly or through an alias, or "".
+func (c *Config) RoomOf(id string) string {
+	names := make([]string, 0, len(c.Rooms))
+	for name := range c.Rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, member := range c.Rooms[name] {
+			if member == id || c.ResolveAlias(member) == id {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// GroupMembers returns the ids in a named group, with aliases resolved.
+func (c *Config) GroupMembers(name string) ([]string, bool) {
+	for key, members := range c.Groups {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		out := make([]string, 0, len(members))
+		for _, m := range members {
+			out = append(out, c.ResolveAlias(m))
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func (c *Config) FindSchedule(name string) int {
+	for i, s := range c.Schedules {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// secretFields lists the credential fields that may hold secret references.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"homeAssistant.token": &c.HomeAssistant.Token,
+		"cloud.accessId":      &c.Cloud.AccessID,
+		"cloud.accessKey":     &c.Cloud.AccessKey,
+		"server.token":        &c.Server.Token,
+	}
+}
+
+// ResolveSecrets replaces env:, file:, cmd: and vault: references in
+// credential fields with their values.
+func (c *Config) ResolveSecrets(r *secret.Resolver) error {
+	fields := c.secretFields()
+	for _, name := range sortedKeys(fields) {
+		ptr := fields[name]
+		if !secret.IsRef(*ptr) {
+			continue
+		}
+		val, err := r.Resolve(*ptr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*ptr = val
+	}
+	return nil
+}
+
+// PlaintextSecrets names the credential fields stored as plain values,
+// including those inside profiles.
+func (c *Config) PlaintextSecrets() []string {
+	var out []string
+	collect := func(prefix string, fields map[string]*string) {
+		for _, name := range sortedKeys(fields) {
+			if name == "cloud.accessId" {
+				continue
+			}
+			v := strings.TrimSpace(*fields[name])
+			if v != "" && !secret.IsRef(v) {
+				out = append(out, prefix+name)
+			}
+		}
+	}
+	collect("", c.secretFields())
+	for _, name := range c.ProfileNames() {
+		p := c.Profiles[name]
+		if p == nil {
+			continue
+		}
+		collect("profiles."+name+".", map[string]*string{
+			"homeAssistant.token": &p.HomeAssistant.Token,
+			"cloud.accessKey":     &p.Cloud.AccessKey,
+		})
+	}
+	return out
+}
+
+func (c *Config) VaultPath() string {
+	if strings.TrimSpace(c.Vault.Path) != "" {
+		return c.Vault.Path
+	}
+	dir, err := DefaultDir()
+	if err != nil {
+		return "vault.json"
+	}
+	return filepath.Join(dir, "vault.json")
+}
+
+func sortedKeys(m map[string]*string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (c *Config) BackendOr(defaultBackend string) string {
@@ -112,6 +502,10 @@ func (c *Config) Validate(backend string) error {
 	return nil
 }
 
+// Save writes cfg at the current version, keeping the previous file as
+// <path>.bak. Values are written into the existing file, so its comments and
+// unknown keys are kept; a save that would still lose an unknown key (one
+// inside a removed entry) is refused.
 func Save(path string, cfg *Config) (string, error) {
 	if path == "" {
 		var err error
@@ -123,12 +517,52 @@ func Save(path string, cfg *Config) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return "", err
 	}
-	data, err := yaml.Marshal(cfg)
+	cfg.Version = CurrentVersion
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{}}}
+	if err := doc.Content[0].Encode(cfg); err != nil {
+		return "", err
+	}
+	prev, err := os.ReadFile(path)
+	if err == nil {
+		if doc, err = updateDocument(prev, doc.Content[0]); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	data, err := yaml.Marshal(doc)
 	if err != nil {
 		return "", err
 	}
+	if prev != nil {
+		if err := os.WriteFile(BackupPath(path), prev, 0o600); err != nil {
+			return "", fmt.Errorf("backup config: %w", err)
+		}
+	}
 	if err := os.WriteFile(path, data, 0o600); err != nil {
 		return "", err
 	}
+	cfg.MigratedFrom = 0
 	return path, nil
 }
+
+// updateDocument merges the encoded config into the file as read,
+// migrating the file's layout first.
+func updateDocument(prev []byte, src *yaml.Node) (*yaml.Node, error) {
+	fresh := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{src}}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(prev, &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fresh, nil
+	}
+	if _, err := migrate(&doc); err != nil {
+		return nil, err
+	}
+	unknown := len(unknownKeys(&doc, ""))
+	mergeNode(doc.Content[0], src, reflect.TypeOf(Config{}))
+	if len(unknownKeys(&doc, "")) < unknown {
+		return nil, fmt.Errorf("saving would drop unknown keys; fix or remove them first (tuya config validate lists them)")
+	}
+	return &doc, nil
+}
+
+func BackupPath(path string) string {
+	return path + ".bak"
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"tuya-hub/internal/secret"
 )
 
 func TestSaveLoadConfig(t *testing.T) {
@@ -42,6 +49,13 @@ func TestSaveLoadConfig(t *testing.T) {
 	}
 }
 
+func TestDefaultPathFromEnv(t *testing.T) {
+	t.Setenv("TUYA_CONFIG", "/etc/tuya/config.yaml")
+	if p, err := DefaultPath(); err != nil || p != "/etc/tuya/config.yaml" {
+		t.Fatalf("expected TUYA_CONFIG path, got %q (%v)", p, err)
+	}
+}
+
 func TestApplyEnv(t *testing.T) {
 	os.Setenv("TUYA_BACKEND", "cloud")
 	os.Setenv("TUYA_CLOUD_SCHEMA", "smartlife")
@@ -62,3 +76,328 @@ func TestApplyEnv(t *testing.T) {
 		t.Fatalf("expected userId uid, got %q", cfg.Cloud.UserID)
 	}
 }
+
+func TestUseProfile(t *testing.T) {
+	cfg := &Config{
+		Backend: "ha",
+		Cloud:   Cloud{AccessID: "base-id", Schema: "smartlife"},
+		Aliases: map[string]string{"porch": "switch.porch"},
+		Profiles: map[string]*Profile{
+			"cabin": {
+				Backend:  "cloud",
+				Cloud:    Cloud{AccessID: "cabin-id", Endpoint: "https://openapi.tuyaus.com"},
+				Aliases:  map[string]string{"heater": "dev123"},
+				ReadOnly: true,
+			},
+		},
+	}
+	if err := cfg.UseProfile("cabin"); err != nil {
+		t.Fatalf("use profile failed: %v", err)
+	}
+	if cfg.Backend != "cloud" || cfg.Cloud.AccessID != "cabin-id" {
+		t.Fatalf("expected cabin overlay, got %+v", cfg.Cloud)
+	}
+	if cfg.Cloud.Schema != "smartlife" {
+		t.Fatalf("expected base schema to be kept, got %q", cfg.Cloud.Schema)
+	}
+	if cfg.ResolveAlias("heater") != "dev123" || cfg.ResolveAlias("porch") != "switch.porch" {
+		t.Fatalf("expected merged aliases, got %v", cfg.Aliases)
+	}
+	if !cfg.Safety.ReadOnly || cfg.Active != "cabin" {
+		t.Fatalf("expected read-only active cabin profile")
+	}
+
+	if err := cfg.UseProfile("office"); err == nil {
+		t.Fatalf("expected error for unknown profile")
+	}
+}
+
+func TestUseProfileFromEnv(t *testing.T) {
+	t.Setenv("TUYA_PROFILE", "home")
+	cfg := &Config{Profiles: map[string]*Profile{"home": {Backend: "cloud"}}}
+	if err := cfg.UseProfile(""); err != nil {
+		t.Fatalf("use profile failed: %v", err)
+	}
+	if cfg.Backend != "cloud" {
+		t.Fatalf("expected env-selected profile, got %q", cfg.Backend)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("TUYA_TEST_KEY", "resolved-key")
+	cfg := &Config{
+		HomeAssistant: HomeAssistant{Token: "plain-token"},
+		Cloud:         Cloud{AccessID: "id", AccessKey: "env:TUYA_TEST_KEY"},
+		Profiles: map[string]*Profile{
+			"cabin": {Cloud: Cloud{AccessKey: "cabin-plain"}},
+		},
+	}
+
+	plain := cfg.PlaintextSecrets()
+	want := []string{"homeAssistant.token", "profiles.cabin.cloud.accessKey"}
+	if !reflect.DeepEqual(plain, want) {
+		t.Fatalf("expected %v, got %v", want, plain)
+	}
+
+	if err := cfg.ResolveSecrets(&secret.Resolver{}); err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if cfg.Cloud.AccessKey != "resolved-key" || cfg.HomeAssistant.Token != "plain-token" {
+		t.Fatalf("unexpected resolved values: %+v %+v", cfg.Cloud, cfg.HomeAssistant)
+	}
+
+	cfg.Server.Token = "env:TUYA_TEST_UNSET"
+	if err := cfg.ResolveSecrets(&secret.Resolver{}); err == nil {
+		t.Fatalf("expected error for unset env reference")
+	}
+}
+
+func TestGetSetKeys(t *testing.T) {
+	cfg := &Config{Backend: "ha"}
+	if err := cfg.Set("cloud.endpoint", "auto"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := cfg.Set("cloud.userId", "12345"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := cfg.Set("profiles.work.readOnly", "true"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := cfg.Set("mcp.allowWrite", "[switch.*, light.*]"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if cfg.Cloud.Endpoint != "auto" || cfg.Cloud.UserID != "12345" || !cfg.Profiles["work"].ReadOnly || len(cfg.MCP.AllowWrite) != 2 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if v, err := cfg.Get("cloud.endpoint"); err != nil || v != "auto" {
+		t.Fatalf("expected auto, got %v (%v)", v, err)
+	}
+	if err := cfg.Set("cloud.endpiont", "x"); err == nil {
+		t.Fatalf("expected unknown key error")
+	}
+	if err := cfg.Set("safety.readOnly", "maybe"); err == nil {
+		t.Fatalf("expected type error")
+	}
+	if cfg.Safety.ReadOnly {
+		t.Fatalf("failed set must not modify config")
+	}
+}
+
+func TestSetReachesSelectedProfile(t *testing.T) {
+	t.Setenv("TUYA_PROFILE", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "backend: cloud\ncloud:\n  accessId: id\n  endpoint: https://openapi.tuyaus.com\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if v, err := cfg.Get("cloud.endpoint"); err != nil || v != "https://openapi.tuyaus.com" {
+		t.Fatalf("expected the profile's endpoint, got %v (%v)", v, err)
+	}
+	if err := cfg.Set("cloud.endpoint", "https://openapi.tuyaeu.com"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := Save(path, cfg); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if err := cfg.UseProfile(""); err != nil || cfg.Cloud.Endpoint != "https://openapi.tuyaeu.com" {
+		t.Fatalf("set did not reach the active profile: %q (%v)", cfg.Cloud.Endpoint, err)
+	}
+	if cfg.ProfileKey("mcp.allowWrite") != "mcp.allowWrite" || cfg.ProfileKey("cloud.lang") != "profiles.default.cloud.lang" {
+		t.Fatalf("unexpected profile keys")
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cfg := &Config{
+		HomeAssistant: HomeAssistant{Token: "secret"},
+		Cloud:         Cloud{AccessID: "id", AccessKey: "env:TUYA_KEY"},
+		Profiles:      map[string]*Profile{"home": {Cloud: Cloud{AccessKey: "plain"}}},
+	}
+	masked, err := cfg.Masked()
+	if err != nil {
+		t.Fatalf("mask failed: %v", err)
+	}
+	if masked.HomeAssistant.Token != MaskedValue || masked.Cloud.AccessKey != "env:TUYA_KEY" || masked.Cloud.AccessID != "id" {
+		t.Fatalf("unexpected masking: %+v", masked)
+	}
+	if masked.Profiles["home"].Cloud.AccessKey != MaskedValue || cfg.Profiles["home"].Cloud.AccessKey != "plain" {
+		t.Fatalf("profile secrets not masked on a copy")
+	}
+}
+
+func TestLoadWarnsOnUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "version: 2\nbackend: cloud\ncloud:\n  accessID: id\n  endpiont: auto\nprofiles:\n  home:\n    cloud:\n      usrId: x\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	want := []string{
+		"config.yaml:4: unknown key cloud.accessID (did you mean cloud.accessId?)",
+		"config.yaml:5: unknown key cloud.endpiont (did you mean cloud.endpoint?)",
+		"config.yaml:9: unknown key profiles.home.cloud.usrId (did you mean profiles.home.cloud.userId?)",
+	}
+	if !reflect.DeepEqual(cfg.Warnings, want) {
+		t.Fatalf("unexpected warnings:\n%v", cfg.Warnings)
+	}
+	if cfg.MigratedFrom != 0 {
+		t.Fatalf("current version must not migrate")
+	}
+}
+
+func TestLoadMigratesSingleBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "backend: ha\nhomeAssistant:\n  url: http://ha:8123\n  token: tok\ncloud:\n  accessId: \"\"\naliases:\n  patio: switch.patio\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.MigratedFrom != 1 || cfg.Profile != "default" || cfg.HomeAssistant.URL != "" {
+		t.Fatalf("expected migration to default profile, got %+v", cfg)
+	}
+	p := cfg.Profiles["default"]
+	if p == nil || p.Backend != "ha" || p.HomeAssistant.Token != "tok" || cfg.Aliases["patio"] != "switch.patio" {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+	if err := cfg.UseProfile(""); err != nil || cfg.HomeAssistant.URL != "http://ha:8123" {
+		t.Fatalf("migrated profile not applied: %v", err)
+	}
+
+	if _, err := Save(path, cfg); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	backup, err := os.ReadFile(BackupPath(path))
+	if err != nil || string(backup) != data {
+		t.Fatalf("expected backup of the original file, got %q (%v)", backup, err)
+	}
+	reloaded, err := Load(path)
+	if err != nil || reloaded.Version != CurrentVersion || reloaded.MigratedFrom != 0 {
+		t.Fatalf("expected current version after save, got %+v (%v)", reloaded, err)
+	}
+}
+
+func TestLocationCoordinates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("version: 2\nlocation:\n  timezone: Europe/Amsterdam\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.Location == nil || cfg.Location.HasCoordinates() {
+		t.Fatalf("expected a timezone-only location without coordinates, got %+v", cfg.Location)
+	}
+	lat, lon := 0.0, 0.0
+	if !(&Location{Latitude: &lat, Longitude: &lon}).HasCoordinates() || (*Location)(nil).HasCoordinates() {
+		t.Fatalf("unexpected HasCoordinates")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(filepath.Join(dir, "missing.yaml"))
+	if err != nil || cfg == nil {
+		t.Fatalf("missing file should load empty, got %v", err)
+	}
+
+	newer := filepath.Join(dir, "newer.yaml")
+	os.WriteFile(newer, []byte("version: 99\n"), 0o600)
+	if _, err := Load(newer); err == nil {
+		t.Fatalf("expected error for newer version")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can read unreadable files")
+	}
+	locked := filepath.Join(dir, "locked.yaml")
+	os.WriteFile(locked, []byte("backend: ha\n"), 0o000)
+	if _, err := Load(locked); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected permission error, got %v", err)
+	}
+}
+
+func TestSaveKeepsCommentsAndUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "# my hub\nversion: 2\ncloud:\n  accessID: abc # typo\n  schema: tuyaSmart\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := cfg.Set("cloud.schema", "smartlife"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if _, err := Save(path, cfg); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	written, _ := os.ReadFile(path)
+	for _, want := range []string{"# my hub", "accessID: abc # typo", "schema: smartlife"} {
+		if !strings.Contains(string(written), want) {
+			t.Fatalf("expected %q in saved config:\n%s", want, written)
+		}
+	}
+}
+
+func TestSaveMigratesInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "# cloud project\nbackend: cloud\ncloud:\n  accessId: id # from the console\nhomeAssistant:\n  url: \"\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := Save(path, cfg); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	written, _ := os.ReadFile(path)
+	var tree map[string]any
+	if err := yaml.Unmarshal(written, &tree); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	for _, key := range []string{"backend", "homeAssistant", "cloud"} {
+		if _, ok := tree[key]; ok {
+			t.Fatalf("unexpected top-level %s after migration:\n%s", key, written)
+		}
+	}
+	if !strings.Contains(string(written), "accessId: id # from the console") || tree["profile"] != "default" {
+		t.Fatalf("expected comments kept inside the default profile:\n%s", written)
+	}
+}
+
+func TestSaveRefusesToDropUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "version: 2\nschedules:\n  - name: lamp\n    at: \"0 7 * * *\"\n    command: [set]\n    disabeld: true\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	cfg.Schedules = nil
+	if _, err := Save(path, cfg); err == nil {
+		t.Fatalf("expected save to refuse dropping an unknown key")
+	}
+	if written, _ := os.ReadFile(path); string(written) != data {
+		t.Fatalf("refused save must leave the file alone")
+	}
+}
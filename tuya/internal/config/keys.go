@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"tuya-hub/internal/secret"
+)
+
+// MaskedValue replaces plaintext secrets in Masked output.
+const MaskedValue = "********"
+
+// toTree converts the config into its YAML map form, keyed like the file.
+func (c *Config) toTree() (map[string]any, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]any{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// decodeTree decodes a YAML map into a config. In strict mode keys the
+// config does not know are an error.
+func decodeTree(tree map[string]any, strict bool) (*Config, error) {
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(strict)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Tree returns the config as nested maps keyed like the file, for output
+// that should use the file's key names.
+func (c *Config) Tree() (map[string]any, error) {
+	return c.toTree()
+}
+
+func splitKey(key string) ([]string, error) {
+	key = strings.Trim(strings.TrimSpace(key), ".")
+	if key == "" {
+		return nil, fmt.Errorf("config key required")
+	}
+	return strings.Split(key, "."), nil
+}
+
+// profileKeys are the top-level settings a profile overrides.
+var profileKeys = map[string]bool{"backend": true, "homeAssistant": true, "cloud": true}
+
+// ProfileKey maps a setting that profiles override (backend,
+// homeAssistant.*, cloud.*) to its copy in the selected profile, since that
+// copy is what commands use. Other keys, and configs without a selected
+// profile, are returned unchanged.
+func (c *Config) ProfileKey(key string) string {
+	key = strings.Trim(strings.TrimSpace(key), ".")
+	first, _, _ := strings.Cut(key, ".")
+	name := c.selectedProfile()
+	if !profileKeys[first] || name == "" || c.Profiles[name] == nil {
+		return key
+	}
+	return "profiles." + name + "." + key
+}
+
+// Get returns the value stored at a dotted key such as cloud.endpoint or
+// profiles.home.backend. Profile-scoped keys read the selected profile,
+// falling back to the top level where the profile leaves them empty.
+func (c *Config) Get(key string) (any, error) {
+	if scoped := c.ProfileKey(key); scoped != strings.Trim(strings.TrimSpace(key), ".") {
+		if v, err := c.get(scoped); err == nil && !isEmptyValue(v) {
+			return v, nil
+		}
+	}
+	return c.get(key)
+}
+
+func (c *Config) get(key string) (any, error) {
+	parts, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.toTree()
+	if err != nil {
+		return nil, err
+	}
+	var cur any = tree
+	for _, part := range parts {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("config key %s is not set", key)
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, fmt.Errorf("config key %s is not set", key)
+		}
+	}
+	return cur, nil
+}
+
+// Set stores value at a dotted key, in the selected profile for
+// profile-scoped keys (see ProfileKey). The value is parsed as YAML, so
+// numbers, booleans and [lists] keep their types; unknown keys and type
+// mismatches are rejected.
+func (c *Config) Set(key, value string) error {
+	key = c.ProfileKey(key)
+	parts, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	var parsed any
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		parsed = value
+	}
+	if _, ok := parsed.(map[string]any); ok {
+		return fmt.Errorf("%s: set nested keys one at a time", key)
+	}
+
+	tree, err := c.toTree()
+	if err != nil {
+		return err
+	}
+	cur := tree
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := cur[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			cur[part] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = parsed
+
+	updated, err := decodeTree(tree, true)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	updated.Active = c.Active
+	*c = *updated
+	return nil
+}
+
+// Masked returns a copy of the config with plaintext secrets replaced by
+// MaskedValue. References (env:, file:, cmd:, vault:) are kept as written.
+func (c *Config) Masked() (*Config, error) {
+	tree, err := c.toTree()
+	if err != nil {
+		return nil, err
+	}
+	out, err := decodeTree(tree, true)
+	if err != nil {
+		return nil, err
+	}
+	mask := func(ptr *string) {
+		if v := strings.TrimSpace(*ptr); v != "" && !secret.IsRef(v) {
+			*ptr = MaskedValue
+		}
+	}
+	for name, ptr := range out.secretFields() {
+		if name != "cloud.accessId" {
+			mask(ptr)
+		}
+	}
+	mask(&out.Vault.Passphrase)
+	for _, p := range out.Profiles {
+		if p != nil {
+			mask(&p.HomeAssistant.Token)
+			mask(&p.Cloud.AccessKey)
+		}
+	}
+	out.Active = c.Active
+	return out, nil
+}
+
+// IsSecretKey reports whether a dotted key names a credential field.
+func IsSecretKey(key string) bool {
+	key = strings.Trim(strings.TrimSpace(key), ".")
+	for _, suffix := range []string{"homeAssistant.token", "cloud.accessKey", "server.token", "vault.passphrase"} {
+		if key == suffix || strings.HasSuffix(key, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config layout written by Save. Files without a
+// version field are version 1.
+const CurrentVersion = 2
+
+// migrations[i] upgrades a version i+1 document to version i+2. They edit
+// the YAML nodes so comments and unknown keys survive.
+var migrations = []func(root *yaml.Node){
+	migrateV1,
+}
+
+// migrateV1 moves single-backend settings (top-level backend, homeAssistant
+// and cloud) into a "default" profile. Files that already use profiles are
+// left alone.
+func migrateV1(root *yaml.Node) {
+	if keyIndex(root, "profiles") >= 0 {
+		return
+	}
+	profile := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range []string{"backend", "homeAssistant", "cloud"} {
+		i := keyIndex(root, key)
+		if i < 0 {
+			continue
+		}
+		k, v := root.Content[i], root.Content[i+1]
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		var decoded any
+		if err := v.Decode(&decoded); err != nil || !isEmptyValue(decoded) {
+			profile.Content = append(profile.Content, k, v)
+		}
+	}
+	if len(profile.Content) == 0 {
+		return
+	}
+	root.Content = append(root.Content,
+		scalarNode("profiles"), &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{scalarNode("default"), profile}},
+		scalarNode("profile"), scalarNode("default"))
+}
+
+// keyIndex returns the index of key in a mapping node's content, or -1.
+func keyIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func scalarNode(v string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+}
+
+func isEmptyValue(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(t) == ""
+	case map[string]any:
+		for _, inner := range t {
+			if !isEmptyValue(inner) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// migrate upgrades a document in place and reports the version it started
+// from.
+func migrate(doc *yaml.Node) (int, error) {
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("config must be a mapping of keys")
+	}
+	from := 1
+	version := scalarNode(strconv.Itoa(CurrentVersion))
+	version.Tag = "!!int"
+	if i := keyIndex(root, "version"); i >= 0 {
+		var n int
+		if err := root.Content[i+1].Decode(&n); err != nil || n < 1 {
+			return 0, fmt.Errorf("version: %v is not a valid config version", root.Content[i+1].Value)
+		}
+		from = n
+		root.Content[i+1].Value = version.Value
+	} else {
+		key := scalarNode("version")
+		if len(root.Content) > 0 {
+			// A comment at the top of the file describes the file.
+			key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{key, version}, root.Content...)
+	}
+	if from > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is newer than this tuya supports (%d); upgrade tuya", from, CurrentVersion)
+	}
+	for v := from; v < CurrentVersion; v++ {
+		migrations[v-1](root)
+	}
+	return from, nil
+}
+
+// mergeNode writes src, the encoded config, over dst, the file as read, so
+// that values change in place. Comments stay, as do keys the config does
+// not know; known keys missing from src were cleared and are removed.
+func mergeNode(dst, src *yaml.Node, typ reflect.Type) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode && (typ.Kind() == reflect.Struct || typ.Kind() == reflect.Map):
+		var fields map[string]reflect.Type
+		if typ.Kind() == reflect.Struct {
+			fields = yamlFields(typ)
+		}
+		var content []*yaml.Node
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			key, val := dst.Content[i], dst.Content[i+1]
+			j := keyIndex(src, key.Value)
+			switch {
+			case j >= 0 && fields == nil:
+				mergeNode(val, src.Content[j+1], typ.Elem())
+			case j >= 0:
+				mergeNode(val, src.Content[j+1], fields[key.Value])
+			case fields != nil && fields[key.Value] == nil:
+				// Unknown key: keep it for the user to fix.
+			default:
+				continue
+			}
+			content = append(content, key, val)
+		}
+		for j := 0; j+1 < len(src.Content); j += 2 {
+			val := src.Content[j+1]
+			if val.Kind == yaml.ScalarNode && val.Value == "" {
+				continue
+			}
+			if keyIndex(dst, src.Content[j].Value) < 0 {
+				content = append(content, src.Content[j], src.Content[j+1])
+			}
+		}
+		dst.Content = content
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && typ.Kind() == reflect.Slice && len(dst.Content) == len(src.Content):
+		for i := range dst.Content {
+			mergeNode(dst.Content[i], src.Content[i], typ.Elem())
+		}
+	case dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode && dst.Value == src.Value:
+		// Unchanged; keep the file's quoting.
+	default:
+		head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+	}
+}
+
+// unknownKeys walks a YAML document against the Config type and describes
+// every key the config does not know, with a suggestion when one is close.
+func unknownKeys(doc *yaml.Node, file string) []string {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	var out []string
+	walkKeys(doc, reflect.TypeOf(Config{}), "", file, &out)
+	return out
+}
+
+func walkKeys(node *yaml.Node, typ reflect.Type, prefix, file string, out *[]string) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(typ)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("%s:%d: unknown key %s%s", file, key.Line, prefix, key.Value)
+				if s := suggestKey(key.Value, fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %s%s?)", prefix, s)
+				}
+				*out = append(*out, msg)
+				continue
+			}
+			walkKeys(val, field, prefix+key.Value+".", file, out)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkKeys(node.Content[i+1], typ.Elem(), prefix+node.Content[i].Value+".", file, out)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			walkKeys(item, typ.Elem(), fmt.Sprintf("%s%d.", prefix, i), file, out)
+		}
+	}
+}
+
+func yamlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// suggestKey returns the known key closest to key: an exact match ignoring
+// case, otherwise one within a small edit distance.
+func suggestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(key)); d < bestDist || (d == bestDist && best != "" && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
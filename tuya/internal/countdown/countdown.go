@@ -0,0 +1,135 @@
+// Package countdown reads and sets the countdown_N timers of plugs and
+// switches. When a timer reaches zero the device flips that channel, so a
+// timer on a channel that is on turns it off.
+package countdown
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/util"
+)
+
+// Timer is one countdown DP.
+type Timer struct {
+	Code      string        `json:"code"`
+	Channel   int           `json:"channel"`
+	Remaining time.Duration `json:"-"`
+	Seconds   int           `json:"seconds"`
+}
+
+// Channel reports whether code is a countdown DP and for which channel.
+// Plain "countdown" is channel 1.
+func Channel(code string) (int, bool) {
+	if code == "countdown" {
+		return 1, true
+	}
+	rest, ok := strings.CutPrefix(code, "countdown_")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Timers returns the countdown DPs in a status, by channel. The spec gives
+// each DP's unit and scale; without one values are taken as seconds.
+func Timers(statuses []cloud.Status, spec *cloud.Spec) []Timer {
+	var timers []Timer
+	for _, st := range statuses {
+		ch, ok := Channel(st.Code)
+		if !ok {
+			continue
+		}
+		raw, ok := util.Number(st.Value)
+		if !ok {
+			continue
+		}
+		values := specValues(spec, st.Code)
+		d := time.Duration(values.Scaled(raw) * float64(unitOf(values)))
+		timers = append(timers, Timer{
+			Code:      st.Code,
+			Channel:   ch,
+			Remaining: d,
+			Seconds:   int(d.Seconds()),
+		})
+	}
+	sort.Slice(timers, func(i, j int) bool { return timers[i].Channel < timers[j].Channel })
+	return timers
+}
+
+func specValues(spec *cloud.Spec, code string) cloud.SpecValues {
+	if spec == nil {
+		return cloud.SpecValues{}
+	}
+	item, ok := spec.Function(code)
+	if !ok {
+		item, ok = spec.StatusItem(code)
+	}
+	if !ok {
+		return cloud.SpecValues{}
+	}
+	values, _ := item.Parsed()
+	return values
+}
+
+// unitOf is the duration of one unit of a countdown DP: seconds unless the
+// spec says minutes or hours.
+func unitOf(values cloud.SpecValues) time.Duration {
+	switch strings.ToLower(values.Unit) {
+	case "min", "m", "minute", "minutes":
+		return time.Minute
+	case "h", "hour", "hours":
+		return time.Hour
+	}
+	return time.Second
+}
+
+// Format renders a remaining time as 29m12s, or "-" for an idle timer.
+func Format(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+// Command builds the DP command that starts a timer of d on channel; zero
+// cancels it. The spec supplies the code (countdown_N, or countdown on
+// single-channel devices), the unit and the allowed range.
+func Command(spec *cloud.Spec, channel int, d time.Duration) (map[string]any, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("device spec unavailable")
+	}
+	codes := []string{fmt.Sprintf("countdown_%d", channel)}
+	if channel == 1 {
+		codes = append(codes, "countdown")
+	}
+	for _, code := range codes {
+		item, ok := spec.Function(code)
+		if !ok {
+			continue
+		}
+		values, err := item.Parsed()
+		if err != nil {
+			return nil, err
+		}
+		unit := unitOf(values)
+		raw := values.Raw(d.Seconds() / unit.Seconds())
+		if !values.InRange(raw) {
+			max := "?"
+			if values.Max != nil {
+				max = Format(time.Duration(values.Scaled(*values.Max) * float64(unit)))
+			}
+			return nil, fmt.Errorf("countdown %s out of range for %s (max %s)", Format(d), code, max)
+		}
+		return map[string]any{"code": code, "value": int(raw)}, nil
+	}
+	return nil, fmt.Errorf("device has no countdown DP for channel %d", channel)
+}
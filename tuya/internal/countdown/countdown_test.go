@@ -0,0 +1,69 @@
+package countdown
+
+import (
+	"testing"
+	"time"
+
+	"tuya-hub/internal/cloud"
+)
+
+var plugSpec = &cloud.Spec{Functions: []cloud.SpecItem{
+	{Code: "switch_1", Type: "Boolean", Values: "{}"},
+	{Code: "countdown_1", Type: "Integer", Values: `{"unit":"s","min":0,"max":86400,"scale":0,"step":1}`},
+}}
+
+func TestTimers(t *testing.T) {
+	timers := Timers([]cloud.Status{
+		{Code: "switch_1", Value: true},
+		{Code: "countdown_2", Value: float64(0)},
+		{Code: "countdown_1", Value: float64(1752)},
+	}, nil)
+	if len(timers) != 2 || timers[0].Code != "countdown_1" || timers[0].Channel != 1 {
+		t.Fatalf("expected countdown_1 first, got %+v", timers)
+	}
+	if got := Format(timers[0].Remaining); got != "29m12s" {
+		t.Fatalf("expected 29m12s, got %s", got)
+	}
+	if got := Format(timers[1].Remaining); got != "-" {
+		t.Fatalf("expected -, got %s", got)
+	}
+	if timers := Timers([]cloud.Status{{Code: "countdown_1", Value: float64(1752)}}, plugSpec); timers[0].Seconds != 1752 {
+		t.Fatalf("expected a seconds spec to read 1752 s, got %+v", timers[0])
+	}
+	if _, ok := Channel("countdown_left"); ok {
+		t.Fatalf("expected countdown_left not to be a timer")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	cmd, err := Command(plugSpec, 1, 30*time.Minute)
+	if err != nil || cmd["code"] != "countdown_1" || cmd["value"] != 1800 {
+		t.Fatalf("expected countdown_1=1800, got %v (%v)", cmd, err)
+	}
+	if _, err := Command(plugSpec, 1, 25*time.Hour); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+	if _, err := Command(plugSpec, 2, time.Minute); err == nil {
+		t.Fatalf("expected error for missing channel 2")
+	}
+
+	single := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "countdown", Type: "Integer", Values: `{"unit":"s","min":0,"max":86400,"scale":0,"step":1}`},
+	}}
+	if cmd, err := Command(single, 1, 0); err != nil || cmd["code"] != "countdown" || cmd["value"] != 0 {
+		t.Fatalf("expected countdown=0, got %v (%v)", cmd, err)
+	}
+}
+
+func TestTimersMinuteSpec(t *testing.T) {
+	spec := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "countdown_1", Type: "Integer", Values: `{"unit":"min","min":0,"max":1440,"scale":0,"step":1}`},
+	}}
+	timers := Timers([]cloud.Status{{Code: "countdown_1", Value: float64(30)}}, spec)
+	if len(timers) != 1 || Format(timers[0].Remaining) != "30m0s" || timers[0].Seconds != 1800 {
+		t.Fatalf("expected 30 minutes, got %+v", timers)
+	}
+	if cmd, err := Command(spec, 1, 30*time.Minute); err != nil || cmd["value"] != 30 {
+		t.Fatalf("expected the command to round-trip as 30, got %v (%v)", cmd, err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package cover maps curtain, blind and shutter actions (open, close, stop,
+// move to a position) to Tuya DPs and Home Assistant cover services.
+package cover
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+)
+
+// Actions.
+const (
+	Open     = "open"
+	Close    = "close"
+	Stop     = "stop"
+	Position = "position"
+)
+
+// Actions lists the actions in the order the CLI shows them.
+func Actions() []string {
+	return []string{Open, Close, Stop, Position}
+}
+
+// Request is one cover action. Position is a percentage (0 closed, 100
+// open) and only used by the position action.
+type Request struct {
+	Action   string
+	Position int
+}
+
+// ParseRequest reads "open", "close", "stop" or "position N".
+func ParseRequest(args []string) (Request, error) {
+	if len(args) == 0 {
+		return Request{}, fmt.Errorf("action required (%s)", strings.Join(Actions(), "|"))
+	}
+	r := Request{Action: strings.ToLower(strings.TrimSpace(args[0]))}
+	switch r.Action {
+	case Open, Close, Stop:
+		if len(args) > 1 {
+			return r, fmt.Errorf("unexpected argument %q after %s", args[1], r.Action)
+		}
+	case Position:
+		if len(args) != 2 {
+			return r, fmt.Errorf("position needs one value, e.g. position 40")
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(args[1]), "%"))
+		if err != nil || n < 0 || n > 100 {
+			return r, fmt.Errorf("invalid position %q (want 0-100)", args[1])
+		}
+		r.Position = n
+	default:
+		return r, fmt.Errorf("unknown cover action: %s (want %s)", args[0], strings.Join(Actions(), "|"))
+	}
+	return r, nil
+}
+
+// controlAliases are the enum values products use for each action on the
+// control DP; older motors use mach_operate with FZ/ZZ.
+var controlAliases = map[string][]string{
+	Open:  {"open", "on", "FZ"},
+	Close: {"close", "off", "ZZ"},
+	Stop:  {"stop", "pause", "STOP"},
+}
+
+// channelCode returns base for channel 1 (or base_1 when only that exists)
+// and base_N for other channels.
+func channelCode(spec *cloud.Spec, base string, channel int) (string, cloud.SpecItem, bool) {
+	codes := []string{fmt.Sprintf("%s_%d", base, channel)}
+	if channel <= 1 {
+		codes = []string{base, base + "_1"}
+	}
+	for _, code := range codes {
+		if item, ok := spec.Function(code); ok {
+			return code, item, true
+		}
+	}
+	return "", cloud.SpecItem{}, false
+}
+
+// Commands builds the DP command for a Tuya curtain motor from its spec.
+func Commands(spec *cloud.Spec, r Request, channel int) ([]map[string]any, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("device spec unavailable")
+	}
+	if channel < 1 {
+		channel = 1
+	}
+	if r.Action == Position {
+		code, item, ok := channelCode(spec, "percent_control", channel)
+		if !ok {
+			return nil, fmt.Errorf("device has no percent_control DP; use open, close or stop")
+		}
+		values, err := item.Parsed()
+		if err != nil {
+			return nil, err
+		}
+		lo, hi := 0.0, 100.0
+		if values.Min != nil {
+			lo = values.Scaled(*values.Min)
+		}
+		if values.Max != nil {
+			hi = values.Scaled(*values.Max)
+		}
+		raw := values.Raw(lo + float64(r.Position)/100*(hi-lo))
+		if !values.InRange(raw) {
+			return nil, fmt.Errorf("position %d%% is out of range for %s", r.Position, code)
+		}
+		return []map[string]any{{"code": code, "value": int(raw)}}, nil
+	}
+
+	for _, base := range []string{"control", "mach_operate"} {
+		code, item, ok := channelCode(spec, base, channel)
+		if !ok {
+			continue
+		}
+		values, err := item.Parsed()
+		if err != nil {
+			return nil, err
+		}
+		for _, want := range controlAliases[r.Action] {
+			for _, v := range values.Range {
+				if strings.EqualFold(v, want) {
+					return []map[string]any{{"code": code, "value": v}}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s does not support %s; values: %s", code, r.Action, strings.Join(values.Range, ", "))
+	}
+	// Without a control DP, open and close can still be expressed as a
+	// position.
+	if r.Action == Open || r.Action == Close {
+		pos := Request{Action: Position}
+		if r.Action == Open {
+			pos.Position = 100
+		}
+		if cmds, err := Commands(spec, pos, channel); err == nil {
+			return cmds, nil
+		}
+	}
+	return nil, fmt.Errorf("device has no control DP for channel %d", channel)
+}
+
+// HAService returns the cover service and data for a request.
+func HAService(r Request) (string, map[string]any) {
+	switch r.Action {
+	case Open:
+		return "open_cover", map[string]any{}
+	case Close:
+		return "close_cover", map[string]any{}
+	case Stop:
+		return "stop_cover", map[string]any{}
+	}
+	return "set_cover_position", map[string]any{"position": r.Position}
+}
@@ -0,0 +1,67 @@
+package cover
+
+import (
+	"reflect"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+)
+
+var curtainSpec = &cloud.Spec{Category: "cl", Functions: []cloud.SpecItem{
+	{Code: "control", Type: "Enum", Values: `{"range":["open","stop","close","continue"]}`},
+	{Code: "percent_control", Type: "Integer", Values: `{"unit":"%","min":0,"max":100,"scale":0,"step":1}`},
+}}
+
+func TestParseRequest(t *testing.T) {
+	r, err := ParseRequest([]string{"position", "40%"})
+	if err != nil || r != (Request{Action: Position, Position: 40}) {
+		t.Fatalf("expected position 40, got %+v (%v)", r, err)
+	}
+	for _, bad := range [][]string{nil, {"up"}, {"position"}, {"position", "140"}, {"open", "now"}} {
+		if _, err := ParseRequest(bad); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	cmds, err := Commands(curtainSpec, Request{Action: Close}, 1)
+	if err != nil || !reflect.DeepEqual(cmds, []map[string]any{{"code": "control", "value": "close"}}) {
+		t.Fatalf("expected control=close, got %v (%v)", cmds, err)
+	}
+	cmds, err = Commands(curtainSpec, Request{Action: Position, Position: 40}, 1)
+	if err != nil || !reflect.DeepEqual(cmds, []map[string]any{{"code": "percent_control", "value": 40}}) {
+		t.Fatalf("expected percent_control=40, got %v (%v)", cmds, err)
+	}
+	stepped := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "percent_control", Type: "Integer", Values: `{"unit":"%","min":0,"max":1000,"scale":1,"step":50}`},
+	}}
+	cmds, err = Commands(stepped, Request{Action: Position, Position: 43}, 1)
+	if err != nil || cmds[0]["value"] != 450 {
+		t.Fatalf("expected percent_control=450, got %v (%v)", cmds, err)
+	}
+	if _, err := Commands(curtainSpec, Request{Action: Open}, 2); err == nil {
+		t.Fatalf("expected error for missing channel 2")
+	}
+
+	legacy := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "mach_operate", Type: "Enum", Values: `{"range":["FZ","ZZ","STOP"]}`},
+	}}
+	cmds, err = Commands(legacy, Request{Action: Open}, 1)
+	if err != nil || cmds[0]["value"] != "FZ" {
+		t.Fatalf("expected mach_operate=FZ, got %v (%v)", cmds, err)
+	}
+	if _, err := Commands(legacy, Request{Action: Position, Position: 10}, 1); err == nil {
+		t.Fatalf("expected error without percent_control")
+	}
+}
+
+func TestHAService(t *testing.T) {
+	service, data := HAService(Request{Action: Position, Position: 25})
+	if service != "set_cover_position" || data["position"] != 25 {
+		t.Fatalf("expected set_cover_position 25, got %s %v", service, data)
+	}
+	if service, _ := HAService(Request{Action: Stop}); service != "stop_cover" {
+		t.Fatalf("expected stop_cover, got %s", service)
+	}
+}
@@ -0,0 +1,333 @@
+// Package energy turns meter data into per-period kWh and cost: hourly
+// samples from Tuya statistics, device report logs or Home Assistant
+// history, priced with a flat or time-of-use tariff.
+package energy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/units"
+)
+
+// Periods accepted by --period.
+const (
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// Groupings accepted by --by.
+const (
+	ByDevice = "device"
+	ByRoom   = "room"
+	ByTotal  = "total"
+)
+
+// Unassigned is the room of devices not listed under rooms in config.
+const Unassigned = "unassigned"
+
+// Sample is the energy used in the interval starting at Start: an hour, or
+// a whole day when only daily statistics are available.
+type Sample struct {
+	Start time.Time
+	KWh   float64
+}
+
+// Point is one recorded meter value.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// FromIncrements sums meter reports that each carry the energy used since
+// the previous one (Tuya add_ele) into hourly samples.
+func FromIncrements(points []Point) []Sample {
+	hours := map[time.Time]float64{}
+	for _, p := range points {
+		hours[p.Time.Truncate(time.Hour)] += p.Value
+	}
+	return sortedSamples(hours)
+}
+
+// FromCumulative turns readings of an ever-increasing meter (an HA
+// total_increasing sensor) into hourly samples. Each increase is booked in
+// the hour of the later reading; a drop is a meter reset, after which the
+// new reading counts in full.
+func FromCumulative(points []Point) []Sample {
+	points = append([]Point(nil), points...)
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	hours := map[time.Time]float64{}
+	for i := 1; i < len(points); i++ {
+		delta := points[i].Value - points[i-1].Value
+		if delta < 0 {
+			delta = points[i].Value
+		}
+		if delta > 0 {
+			hours[points[i].Time.Truncate(time.Hour)] += delta
+		}
+	}
+	return sortedSamples(hours)
+}
+
+func sortedSamples(m map[time.Time]float64) []Sample {
+	out := make([]Sample, 0, len(m))
+	for start, kwh := range m {
+		out = append(out, Sample{Start: start, KWh: kwh})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// ParsePeriod validates a --period value.
+func ParsePeriod(s string) (string, error) {
+	switch p := strings.ToLower(strings.TrimSpace(s)); p {
+	case "", Day, "daily":
+		return Day, nil
+	case Week, "weekly":
+		return Week, nil
+	case Month, "monthly":
+		return Month, nil
+	}
+	return "", fmt.Errorf("unknown period %q (want day, week or month)", s)
+}
+
+// ParseBy validates a --by value.
+func ParseBy(s string) (string, error) {
+	switch b := strings.ToLower(strings.TrimSpace(s)); b {
+	case "", ByDevice:
+		return ByDevice, nil
+	case ByRoom, ByTotal:
+		return b, nil
+	}
+	return "", fmt.Errorf("unknown grouping %q (want device, room or total)", s)
+}
+
+// Bucket labels the period t falls in: 2026-10-18, 2026-W42 or 2026-10.
+func Bucket(t time.Time, period string) string {
+	switch period {
+	case Week:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case Month:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// Window is the default report range ending with the period containing
+// now: the last 7 days, 4 ISO weeks or 3 months.
+func Window(period string, now time.Time) (from, to time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case Week:
+		offset := (int(today.Weekday()) + 6) % 7
+		monday := today.AddDate(0, 0, -offset)
+		return monday.AddDate(0, 0, -21), monday.AddDate(0, 0, 7)
+	case Month:
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return first.AddDate(0, -2, 0), first.AddDate(0, 1, 0)
+	}
+	return today.AddDate(0, 0, -6), today.AddDate(0, 0, 1)
+}
+
+// Tariff prices kWh by time of use.
+type Tariff struct {
+	Currency string
+	rate     float64
+	periods  []period
+}
+
+type period struct {
+	from, to int // minutes after midnight
+	days     map[time.Weekday]bool
+	rate     float64
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// NewTariff parses the tariff section of the config.
+func NewTariff(c config.Tariff) (*Tariff, error) {
+	t := &Tariff{Currency: c.Currency, rate: c.Rate}
+	if c.Rate < 0 {
+		return nil, fmt.Errorf("rate must not be negative")
+	}
+	for i, p := range c.Periods {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("periods.%d", i)
+		}
+		from, err := parseClock(p.From)
+		if err != nil {
+			return nil, fmt.Errorf("%s.from: %w", name, err)
+		}
+		to, err := parseClock(p.To)
+		if err != nil {
+			return nil, fmt.Errorf("%s.to: %w", name, err)
+		}
+		if from == to {
+			return nil, fmt.Errorf("%s: from and to are equal", name)
+		}
+		if p.Rate < 0 {
+			return nil, fmt.Errorf("%s.rate must not be negative", name)
+		}
+		out := period{from: from, to: to, rate: p.Rate}
+		for _, d := range p.Days {
+			day := strings.ToLower(strings.TrimSpace(d))
+			if len(day) > 3 {
+				day = day[:3]
+			}
+			wd, ok := weekdays[day]
+			if !ok {
+				return nil, fmt.Errorf("%s.days: unknown day %q", name, d)
+			}
+			if out.days == nil {
+				out.days = map[time.Weekday]bool{}
+			}
+			out.days[wd] = true
+		}
+		t.periods = append(t.periods, out)
+	}
+	return t, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Priced reports whether any rate is set.
+func (t *Tariff) Priced() bool {
+	if t.rate > 0 {
+		return true
+	}
+	for _, p := range t.periods {
+		if p.rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeOfUse reports whether the rate depends on the time of day, in which
+// case samples should be hourly.
+func (t *Tariff) TimeOfUse() bool {
+	return len(t.periods) > 0
+}
+
+// RateAt is the price per kWh at ts: the first matching period's rate, or
+// the base rate.
+func (t *Tariff) RateAt(ts time.Time) float64 {
+	minute := ts.Hour()*60 + ts.Minute()
+	for _, p := range t.periods {
+		if p.days != nil && !p.days[ts.Weekday()] {
+			continue
+		}
+		in := minute >= p.from && minute < p.to
+		if p.from > p.to {
+			in = minute >= p.from || minute < p.to
+		}
+		if in {
+			return p.rate
+		}
+	}
+	return t.rate
+}
+
+// Usage is the metered energy of one device.
+type Usage struct {
+	DeviceID string
+	Name     string
+	Room     string
+	Samples  []Sample
+}
+
+// Row is the energy and cost of one device, room or the whole house in one
+// period.
+type Row struct {
+	DeviceID string  `json:"deviceId,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Room     string  `json:"room,omitempty"`
+	Period   string  `json:"period"`
+	KWh      float64 `json:"kwh"`
+	Cost     float64 `json:"cost"`
+}
+
+// Options shape a report. Samples outside [From, To) are ignored.
+type Options struct {
+	Period string
+	By     string
+	From   time.Time
+	To     time.Time
+	Tariff *Tariff
+}
+
+// Report totals usage per period, grouped by device, room or not at all.
+// Rows are ordered by group, then period.
+func Report(usage []Usage, opts Options) []Row {
+	type key struct{ group, period string }
+	rows := map[key]*Row{}
+	var keys []key
+	for _, u := range usage {
+		room := u.Room
+		if room == "" {
+			room = Unassigned
+		}
+		for _, s := range u.Samples {
+			if s.Start.Before(opts.From) || !s.Start.Before(opts.To) {
+				continue
+			}
+			k := key{period: Bucket(s.Start, opts.Period)}
+			row := Row{Period: k.period}
+			switch opts.By {
+			case ByRoom:
+				k.group, row.Room = room, room
+			case ByTotal:
+			default:
+				k.group = u.DeviceID
+				row.DeviceID, row.Name, row.Room = u.DeviceID, u.Name, u.Room
+			}
+			r, ok := rows[k]
+			if !ok {
+				r = &row
+				rows[k] = r
+				keys = append(keys, k)
+			}
+			r.KWh += s.KWh
+			if opts.Tariff != nil {
+				r.Cost += s.KWh * opts.Tariff.RateAt(s.Start)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].period < keys[j].period
+	})
+	out := make([]Row, 0, len(keys))
+	for _, k := range keys {
+		r := *rows[k]
+		r.KWh, r.Cost = units.Round(r.KWh, 3), units.Round(r.Cost, 2)
+		out = append(out, r)
+	}
+	return out
+}
+
+// Totals sums the energy and cost of rows.
+func Totals(rows []Row) (kwh, cost float64) {
+	for _, r := range rows {
+		kwh += r.KWh
+		cost += r.Cost
+	}
+	return units.Round(kwh, 3), units.Round(cost, 2)
+}
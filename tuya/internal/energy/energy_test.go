@@ -0,0 +1,102 @@
+package energy
+
+import (
+	"testing"
+	"time"
+
+	"tuya-hub/internal/config"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestTimeOfUseRates(t *testing.T) {
+	tariff, err := NewTariff(config.Tariff{Rate: 0.30, Periods: []config.TariffPeriod{
+		{Name: "night", From: "22:00", To: "06:00", Rate: 0.10},
+		{Name: "peak", From: "17:00", To: "20:00", Days: []string{"mon", "Tuesday", "wed", "thu", "fri"}, Rate: 0.50},
+	}})
+	if err != nil {
+		t.Fatalf("tariff: %v", err)
+	}
+	cases := map[string]float64{
+		"2026-10-19 23:00": 0.10, // Monday night
+		"2026-10-20 05:59": 0.10,
+		"2026-10-19 17:30": 0.50, // Monday peak
+		"2026-10-18 17:30": 0.30, // Sunday: no peak
+		"2026-10-19 12:00": 0.30,
+	}
+	for ts, want := range cases {
+		if got := tariff.RateAt(at(ts)); got != want {
+			t.Fatalf("rate at %s: expected %v, got %v", ts, want, got)
+		}
+	}
+	if _, err := NewTariff(config.Tariff{Periods: []config.TariffPeriod{{From: "7am", To: "09:00"}}}); err == nil {
+		t.Fatalf("expected invalid time error")
+	}
+	if _, err := NewTariff(config.Tariff{Periods: []config.TariffPeriod{{From: "07:00", To: "09:00", Days: []string{"funday"}}}}); err == nil {
+		t.Fatalf("expected unknown day error")
+	}
+}
+
+func TestFromCumulativeHandlesReset(t *testing.T) {
+	samples := FromCumulative([]Point{
+		{Time: at("2026-10-18 10:05"), Value: 100},
+		{Time: at("2026-10-18 10:50"), Value: 100.5},
+		{Time: at("2026-10-18 11:10"), Value: 101.25},
+		{Time: at("2026-10-18 11:40"), Value: 0.25}, // meter reset
+	})
+	if len(samples) != 2 || samples[0].KWh != 0.5 || samples[1].KWh != 1 {
+		t.Fatalf("expected 0.5 and 1 kWh, got %+v", samples)
+	}
+}
+
+func TestReportGroupsAndPrices(t *testing.T) {
+	tariff, _ := NewTariff(config.Tariff{Rate: 0.2, Periods: []config.TariffPeriod{{From: "00:00", To: "06:00", Rate: 0.1}}})
+	usage := []Usage{
+		{DeviceID: "plug1", Name: "Kettle", Room: "kitchen", Samples: FromIncrements([]Point{
+			{Time: at("2026-10-11 03:10"), Value: 1},
+			{Time: at("2026-10-13 12:00"), Value: 2},
+			{Time: at("2026-10-20 12:00"), Value: 4}, // outside the window
+		})},
+		{DeviceID: "plug2", Name: "Heater", Samples: []Sample{{Start: at("2026-10-13 00:00"), KWh: 3}}},
+		{DeviceID: "plug3", Name: "Fridge", Room: "kitchen", Samples: []Sample{{Start: at("2026-10-13 08:00"), KWh: 0.5}}},
+	}
+	opts := Options{Period: Week, By: ByRoom, From: at("2026-10-05 00:00"), To: at("2026-10-19 00:00"), Tariff: tariff}
+	rows := Report(usage, opts)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", rows)
+	}
+	want := []Row{
+		{Room: "kitchen", Period: "2026-W41", KWh: 1, Cost: 0.1},
+		{Room: "kitchen", Period: "2026-W42", KWh: 2.5, Cost: 0.5},
+		{Room: Unassigned, Period: "2026-W42", KWh: 3, Cost: 0.3},
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Fatalf("row %d: expected %+v, got %+v", i, want[i], rows[i])
+		}
+	}
+	if kwh, cost := Totals(rows); kwh != 6.5 || cost != 0.9 {
+		t.Fatalf("expected totals 6.5 kWh / 0.9, got %v / %v", kwh, cost)
+	}
+}
+
+func TestBucketsAndWindow(t *testing.T) {
+	now := at("2026-10-18 15:00") // a Sunday
+	if got := Bucket(now, Week); got != "2026-W42" {
+		t.Fatalf("expected 2026-W42, got %s", got)
+	}
+	from, to := Window(Week, now)
+	if !from.Equal(at("2026-09-21 00:00")) || !to.Equal(at("2026-10-19 00:00")) {
+		t.Fatalf("unexpected week window %s – %s", from, to)
+	}
+	from, to = Window(Month, now)
+	if !from.Equal(at("2026-08-01 00:00")) || !to.Equal(at("2026-11-01 00:00")) {
+		t.Fatalf("unexpected month window %s – %s", from, to)
+	}
+}
@@ -0,0 +1,149 @@
+// Package fault sorts errors into a small taxonomy with stable exit codes,
+// so scripts and agents can branch on the kind of failure instead of its
+// wording.
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// Kind names a class of failure.
+type Kind string
+
+const (
+	// Internal covers anything not classified below.
+	Internal Kind = "internal"
+	// Usage is a bad or missing flag or argument.
+	Usage Kind = "usage"
+	// Config is a missing, unreadable or invalid config file or secret.
+	Config Kind = "config"
+	// Auth is rejected credentials: a bad key or signature, an expired
+	// token, a skewed clock.
+	Auth Kind = "auth"
+	// Permission is a write refused by the safety policy or an API the
+	// project is not authorized for.
+	Permission Kind = "permission"
+	// NotFound is an unknown device, entity, DP code, schedule or path.
+	NotFound Kind = "not-found"
+	// Offline is a device that is known but not reachable.
+	Offline Kind = "offline"
+	// Validation is a value or command the device or API rejects.
+	Validation Kind = "validation"
+	// RateLimit is a request throttled by the API.
+	RateLimit Kind = "rate-limit"
+	// Network is a failure to reach the backend at all.
+	Network Kind = "network"
+	// Timeout is a device that accepted a command but did not report the
+	// requested state in time.
+	Timeout Kind = "timeout"
+)
+
+// exitCodes are part of the CLI contract; do not renumber them.
+var exitCodes = map[Kind]int{
+	Internal:   1,
+	Usage:      2,
+	Config:     3,
+	Auth:       4,
+	Permission: 5,
+	NotFound:   6,
+	Offline:    7,
+	Validation: 8,
+	RateLimit:  9,
+	Network:    10,
+	Timeout:    11,
+}
+
+// ExitCode is the process exit status for errors of kind k.
+func (k Kind) ExitCode() int {
+	if code, ok := exitCodes[k]; ok {
+		return code
+	}
+	return 1
+}
+
+// Error is a classified error. Hint suggests a fix; Details carries
+// structured context such as a safety refusal or an API error code.
+type Error struct {
+	Kind    Kind   `json:"kind"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+	Details any    `json:"details,omitempty"`
+	Err     error  `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithHint sets the hint and returns e for chaining.
+func (e *Error) WithHint(hint string) *Error {
+	e.Hint = hint
+	return e
+}
+
+// New formats a message like fmt.Errorf, including %w wrapping.
+func New(kind Kind, format string, args ...any) *Error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Kind: kind, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Wrap classifies err as kind. It returns nil for a nil err.
+func Wrap(kind Kind, err error) *Error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Message: err.Error(), Err: err}
+}
+
+// As returns the classified error in err's chain. Errors that were never
+// classified are Network when they come from the transport and Internal
+// otherwise. The message is always err's own, so context added by wrapping
+// is kept.
+func As(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	out := &Error{Kind: Internal, Message: err.Error(), Err: err}
+	var fe *Error
+	if errors.As(err, &fe) {
+		out.Kind, out.Hint, out.Details = fe.Kind, fe.Hint, fe.Details
+		return out
+	}
+	if IsNetwork(err) {
+		out.Kind = Network
+		out.Hint = "check the backend URL and that the host is reachable"
+	}
+	return out
+}
+
+// IsNetwork reports whether err is a transport failure: DNS, refused or
+// reset connections, timeouts.
+func IsNetwork(err error) bool {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &dnsErr), errors.As(err, &opErr), errors.As(err, &netErr):
+		return true
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET):
+		return true
+	case errors.As(err, &urlErr):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	seen := map[int]Kind{}
+	for kind, code := range exitCodes {
+		if other, ok := seen[code]; ok {
+			t.Fatalf("%s and %s share exit code %d", kind, other, code)
+		}
+		seen[code] = kind
+	}
+	if Usage.ExitCode() != 2 || Network.ExitCode() != 10 || Timeout.ExitCode() != 11 || Kind("bogus").ExitCode() != 1 {
+		t.Fatalf("unexpected exit codes")
+	}
+}
+
+func TestNewWrapsAndAsKeepsContext(t *testing.T) {
+	base := errors.New("boom")
+	err := New(Config, "read config: %w", base)
+	if !errors.Is(err, base) || err.Error() != "read config: boom" {
+		t.Fatalf("expected wrapped error, got %v", err)
+	}
+
+	wrapped := fmt.Errorf("device abc: %w", New(NotFound, "not found").WithHint("run discover"))
+	fe := As(wrapped)
+	if fe.Kind != NotFound || fe.Message != "device abc: not found" || fe.Hint != "run discover" {
+		t.Fatalf("unexpected classification: %+v", fe)
+	}
+}
+
+func TestAsNetwork(t *testing.T) {
+	err := fmt.Errorf("get states: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+	if fe := As(err); fe.Kind != Network {
+		t.Fatalf("expected network, got %s", fe.Kind)
+	}
+	if fe := As(errors.New("something else")); fe.Kind != Internal {
+		t.Fatalf("expected internal, got %s", fe.Kind)
+	}
+	if As(nil) != nil {
+		t.Fatalf("expected nil for nil error")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -23,6 +24,16 @@ type State struct {
 	Attributes map[string]any `json:"attributes"`
 }
 
+// StatusError is a non-2xx response from Home Assistant.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ha api error %d: %s", e.Code, e.Body)
+}
+
 func New(baseURL, token string) *Client {
 	return &Client{
 		baseURL: strings.TrimRight(baseURL, "/"),
@@ -58,11 +69,56 @@ func (c *Client) do(method, path string, body any) ([]byte, error) {
 		return nil, err
 	}
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("ha api error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		return nil, &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(data))}
 	}
 	return data, nil
 }
 
+// Raw performs an authenticated request against any HA REST path and returns
+// the response body unchanged. path may carry a query string.
+func (c *Client) Raw(method, path string, body json.RawMessage) ([]byte, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if body == nil {
+		return c.do(method, path, nil)
+	}
+	return c.do(method, path, body)
+}
+
+// Ping checks that the API is reachable and the token is accepted.
+func (c *Client) Ping() (string, error) {
+	data, err := c.do(http.MethodGet, "/api/", nil)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", err
+	}
+	return out.Message, nil
+}
+
+// TemperatureUnit returns the unit Home Assistant reports and takes
+// temperatures in (unit_system.temperature in /api/config, e.g. "°C").
+func (c *Client) TemperatureUnit() (string, error) {
+	data, err := c.do(http.MethodGet, "/api/config", nil)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		UnitSystem struct {
+			Temperature string `json:"temperature"`
+		} `json:"unit_system"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", err
+	}
+	return out.UnitSystem.Temperature, nil
+}
+
 func (c *Client) States() ([]State, error) {
 	data, err := c.do(http.MethodGet, "/api/states", nil)
 	if err != nil {
@@ -90,6 +146,49 @@ func (c *Client) State(entityID string) (*State, error) {
 	return &out, nil
 }
 
+// HistoryState is one recorded state change of an entity.
+type HistoryState struct {
+	EntityID    string    `json:"entity_id"`
+	State       string    `json:"state"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+// History returns the recorded states of entityIDs between start and end,
+// keyed by entity. The first state of each entity is the one in effect at
+// start.
+func (c *Client) History(entityIDs []string, start, end time.Time) (map[string][]HistoryState, error) {
+	if len(entityIDs) == 0 {
+		return map[string][]HistoryState{}, nil
+	}
+	query := url.Values{
+		"filter_entity_id": {strings.Join(entityIDs, ",")},
+		"end_time":         {end.UTC().Format(time.RFC3339)},
+	}
+	path := "/api/history/period/" + url.PathEscape(start.UTC().Format(time.RFC3339)) +
+		"?" + query.Encode() + "&minimal_response&no_attributes"
+	data, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var series [][]HistoryState
+	if err := json.Unmarshal(data, &series); err != nil {
+		return nil, err
+	}
+	out := make(map[string][]HistoryState, len(series))
+	for _, states := range series {
+		if len(states) == 0 {
+			continue
+		}
+		// minimal_response names the entity on the first state only.
+		id := states[0].EntityID
+		for i := range states {
+			states[i].EntityID = id
+		}
+		out[id] = states
+	}
+	return out, nil
+}
+
 func (c *Client) CallService(domain, service string, payload map[string]any) (map[string]any, error) {
 	if domain == "" || service == "" {
 		return nil, errors.New("domain and service required")
@@ -111,3 +210,53 @@ func DomainFromEntity(entityID string) string {
 	}
 	return ""
 }
+
+// targetKeys are the service data keys that select whole groups of entities
+// rather than naming them.
+var targetKeys = []string{"area_id", "device_id", "floor_id", "label_id"}
+
+// ServiceTargets returns the entities a service call names in entity_id,
+// which Home Assistant accepts as a string, a comma-separated string or a
+// list. Targets that cannot be expanded without asking Home Assistant
+// (entity_id "all", area_id, device_id, ...) are returned as key=value in
+// other.
+func ServiceTargets(data map[string]any) (entities, other []string) {
+	for _, v := range listValues(data["entity_id"]) {
+		if strings.EqualFold(v, "all") {
+			other = append(other, "entity_id="+v)
+			continue
+		}
+		entities = append(entities, v)
+	}
+	for _, key := range targetKeys {
+		for _, v := range listValues(data[key]) {
+			other = append(other, key+"="+v)
+		}
+	}
+	return entities, other
+}
+
+func listValues(v any) []string {
+	var raw []string
+	switch v := v.(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []string:
+		raw = v
+	case []any:
+		for _, item := range v {
+			raw = append(raw, fmt.Sprint(item))
+		}
+	case nil:
+		return nil
+	default:
+		raw = []string{fmt.Sprint(v)}
+	}
+	var out []string
+	for _, s := range raw {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
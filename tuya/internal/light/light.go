@@ -0,0 +1,389 @@
+// Package light turns human light settings (hex, RGB or named colours,
+// kelvin, brightness percent, scene names) into Tuya DP commands and Home
+// Assistant light.turn_on data.
+package light
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"tuya-hub/internal/cloud"
+)
+
+// RGB is a colour with 0-255 channels.
+type RGB struct {
+	R, G, B int
+}
+
+// named is the CSS basic palette plus a few common light colours.
+var named = map[string]RGB{
+	"white":     {255, 255, 255},
+	"red":       {255, 0, 0},
+	"green":     {0, 255, 0},
+	"blue":      {0, 0, 255},
+	"yellow":    {255, 255, 0},
+	"cyan":      {0, 255, 255},
+	"magenta":   {255, 0, 255},
+	"orange":    {255, 136, 0},
+	"amber":     {255, 191, 0},
+	"purple":    {128, 0, 128},
+	"violet":    {238, 130, 238},
+	"pink":      {255, 105, 180},
+	"lime":      {50, 205, 50},
+	"teal":      {0, 128, 128},
+	"turquoise": {64, 224, 208},
+	"gold":      {255, 215, 0},
+	"coral":     {255, 127, 80},
+	"indigo":    {75, 0, 130},
+}
+
+// ParseColor reads #rrggbb, #rgb, rrggbb, rgb(r,g,b), r,g,b or a colour
+// name.
+func ParseColor(s string) (RGB, error) {
+	in := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := named[in]; ok {
+		return c, nil
+	}
+	if strings.HasPrefix(in, "rgb(") && strings.HasSuffix(in, ")") {
+		in = in[4 : len(in)-1]
+	}
+	if parts := strings.Split(in, ","); len(parts) == 3 {
+		var ch [3]int
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || n < 0 || n > 255 {
+				return RGB{}, fmt.Errorf("invalid colour %q: channels are 0-255", s)
+			}
+			ch[i] = n
+		}
+		return RGB{ch[0], ch[1], ch[2]}, nil
+	}
+	hex := strings.TrimPrefix(in, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		if n, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return RGB{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}, nil
+		}
+	}
+	return RGB{}, fmt.Errorf("invalid colour %q (want #rrggbb, r,g,b or a name such as orange)", s)
+}
+
+// HSV returns hue in degrees (0-360) and saturation and value as 0-1.
+func (c RGB) HSV() (h, s, v float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	d := max - min
+	v = max
+	if max > 0 {
+		s = d / max
+	}
+	switch {
+	case d == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/d, 6)
+	case max == g:
+		h = 60 * ((b-r)/d + 2)
+	default:
+		h = 60 * ((r-g)/d + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// Tuya's white channel spans this colour temperature range.
+const (
+	MinKelvin = 2700
+	MaxKelvin = 6500
+)
+
+var kelvinNames = map[string]int{
+	"warm":     2700,
+	"soft":     3000,
+	"neutral":  4000,
+	"cool":     5000,
+	"daylight": 6500,
+}
+
+// ParseKelvin reads 2700K, 2700 or warm/soft/neutral/cool/daylight.
+func ParseKelvin(s string) (int, error) {
+	in := strings.ToLower(strings.TrimSpace(s))
+	if k, ok := kelvinNames[in]; ok {
+		return k, nil
+	}
+	k, err := strconv.Atoi(strings.TrimSuffix(in, "k"))
+	if err != nil || k < 1000 || k > 10000 {
+		return 0, fmt.Errorf("invalid colour temperature %q (want e.g. 2700K or warm)", s)
+	}
+	return k, nil
+}
+
+// Request is what to do with a light. Nil fields are left alone.
+type Request struct {
+	Off        bool
+	Color      *RGB
+	Brightness *int // percent, 1-100
+	Kelvin     int
+	Scene      string
+}
+
+// Validate rejects conflicting settings.
+func (r Request) Validate() error {
+	switch {
+	case r.Off && (r.Color != nil || r.Brightness != nil || r.Kelvin != 0 || r.Scene != ""):
+		return fmt.Errorf("--off cannot be combined with other settings")
+	case r.Color != nil && r.Kelvin != 0:
+		return fmt.Errorf("--color and --ct are exclusive")
+	case r.Scene != "" && (r.Color != nil || r.Kelvin != 0 || r.Brightness != nil):
+		return fmt.Errorf("--scene cannot be combined with --color, --ct or --brightness")
+	case r.Brightness != nil && (*r.Brightness < 1 || *r.Brightness > 100):
+		return fmt.Errorf("brightness must be 1-100")
+	}
+	return nil
+}
+
+// HAService returns the light service and data for Home Assistant.
+func (r Request) HAService() (string, map[string]any) {
+	if r.Off {
+		return "turn_off", map[string]any{}
+	}
+	data := map[string]any{}
+	if r.Color != nil {
+		data["rgb_color"] = []int{r.Color.R, r.Color.G, r.Color.B}
+	}
+	if r.Brightness != nil {
+		data["brightness_pct"] = *r.Brightness
+	}
+	if r.Kelvin != 0 {
+		data["color_temp_kelvin"] = r.Kelvin
+	}
+	if r.Scene != "" {
+		data["effect"] = r.Scene
+	}
+	return "turn_on", data
+}
+
+// codes are the DPs of one Tuya light generation.
+type codes struct {
+	bright, temp, colour, scene string
+	// colourMax is the default s/v maximum when the spec has no ranges.
+	colourMax float64
+}
+
+var (
+	v2 = codes{bright: "bright_value_v2", temp: "temp_value_v2", colour: "colour_data_v2", scene: "scene_data_v2", colourMax: 1000}
+	v1 = codes{bright: "bright_value", temp: "temp_value", colour: "colour_data", scene: "scene_data", colourMax: 255}
+)
+
+// span is an integer DP range.
+type span struct{ min, max float64 }
+
+func (s span) at(fraction float64) int {
+	fraction = math.Max(0, math.Min(1, fraction))
+	return int(math.Round(s.min + fraction*(s.max-s.min)))
+}
+
+// Commands builds one SendCommands batch for a device from its spec,
+// choosing between the v2 (colour_data_v2, 0-1000) and v1 (colour_data,
+// 0-255) DP sets.
+func Commands(spec *cloud.Spec, r Request) ([]map[string]any, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("device spec unavailable")
+	}
+	set := v1
+	for _, code := range []string{v2.colour, v2.bright, v2.temp} {
+		if _, ok := spec.Function(code); ok {
+			set = v2
+			break
+		}
+	}
+	var cmds []map[string]any
+	add := func(code string, value any) {
+		cmds = append(cmds, map[string]any{"code": code, "value": value})
+	}
+	need := func(code string) (cloud.SpecItem, error) {
+		item, ok := spec.Function(code)
+		if !ok {
+			return item, fmt.Errorf("device has no %s DP", code)
+		}
+		return item, nil
+	}
+	mode := func(m string) {
+		if item, ok := spec.Function("work_mode"); ok {
+			if values, err := item.Parsed(); err != nil || len(values.Range) == 0 || contains(values.Range, m) {
+				add("work_mode", m)
+			}
+		}
+	}
+
+	if _, ok := spec.Function("switch_led"); ok {
+		add("switch_led", !r.Off)
+	} else if r.Off {
+		return nil, fmt.Errorf("device has no switch_led DP")
+	}
+	if r.Off {
+		return cmds, nil
+	}
+
+	switch {
+	case r.Color != nil:
+		item, err := need(set.colour)
+		if err != nil {
+			return nil, err
+		}
+		hr, sr, vr := colourSpans(item, set.colourMax)
+		h, s, v := r.Color.HSV()
+		if r.Brightness != nil {
+			v = float64(*r.Brightness) / 100
+		}
+		mode("colour")
+		add(set.colour, map[string]int{"h": hr.at(h / 360), "s": sr.at(s), "v": vr.at(v)})
+		return cmds, nil
+	case r.Scene != "":
+		if set != v2 {
+			return nil, fmt.Errorf("scenes need a scene_data_v2 light; send scene_data with tuya set")
+		}
+		if _, err := need(set.scene); err != nil {
+			return nil, err
+		}
+		scene, err := sceneData(r.Scene)
+		if err != nil {
+			return nil, err
+		}
+		mode("scene")
+		add(set.scene, scene)
+		return cmds, nil
+	}
+
+	if r.Kelvin != 0 {
+		item, err := need(set.temp)
+		if err != nil {
+			return nil, err
+		}
+		k := math.Max(MinKelvin, math.Min(MaxKelvin, float64(r.Kelvin)))
+		mode("white")
+		add(set.temp, intSpan(item, set.colourMax).at((k-MinKelvin)/(MaxKelvin-MinKelvin)))
+	}
+	if r.Brightness != nil {
+		item, err := need(set.bright)
+		if err != nil {
+			return nil, err
+		}
+		if r.Kelvin == 0 {
+			mode("white")
+		}
+		// 1% is the lowest level the bulb has, not off.
+		add(set.bright, intSpan(item, set.colourMax).at(float64(*r.Brightness-1)/99))
+	}
+	return cmds, nil
+}
+
+func intSpan(item cloud.SpecItem, max float64) span {
+	out := span{0, max}
+	if values, err := item.Parsed(); err == nil {
+		if values.Min != nil {
+			out.min = *values.Min
+		}
+		if values.Max != nil {
+			out.max = *values.Max
+		}
+	}
+	return out
+}
+
+// colourSpans reads the h/s/v ranges of a colour_data spec, e.g.
+// {"h":{"min":0,"max":360},"s":{"min":0,"max":1000},"v":{"min":0,"max":1000}}.
+func colourSpans(item cloud.SpecItem, max float64) (h, s, v span) {
+	h, s, v = span{0, 360}, span{0, max}, span{0, max}
+	var ranges map[string]struct {
+		Min *float64 `json:"min"`
+		Max *float64 `json:"max"`
+	}
+	if json.Unmarshal([]byte(item.Values), &ranges) != nil {
+		return h, s, v
+	}
+	for key, dst := range map[string]*span{"h": &h, "s": &s, "v": &v} {
+		if r, ok := ranges[key]; ok && r.Min != nil && r.Max != nil {
+			*dst = span{*r.Min, *r.Max}
+		}
+	}
+	return h, s, v
+}
+
+// scenes are Tuya's built-in v2 scenes, each as one static unit.
+var scenes = map[string]struct {
+	num                 int
+	h, s, v, bright, ct int
+}{
+	"night":    {num: 1, h: 0, s: 0, v: 0, bright: 200, ct: 0},
+	"read":     {num: 2, h: 0, s: 0, v: 0, bright: 1000, ct: 500},
+	"working":  {num: 3, h: 0, s: 0, v: 0, bright: 1000, ct: 1000},
+	"leisure":  {num: 4, h: 0, s: 0, v: 0, bright: 500, ct: 500},
+	"soft":     {num: 5, h: 120, s: 1000, v: 1000},
+	"rainbow":  {num: 6, h: 0, s: 1000, v: 1000},
+	"shine":    {num: 7, h: 0, s: 1000, v: 1000},
+	"gorgeous": {num: 8, h: 0, s: 1000, v: 1000},
+}
+
+// sceneData returns scene_data_v2 for a built-in scene name or a raw JSON
+// object.
+func sceneData(name string) (any, error) {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "{") {
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(name), &raw); err != nil {
+			return nil, fmt.Errorf("scene: %w", err)
+		}
+		return raw, nil
+	}
+	sc, ok := scenes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown scene %q (want %s, or scene_data_v2 JSON)", name, strings.Join(SceneNames(), ", "))
+	}
+	mode := "static"
+	if sc.num >= 6 {
+		mode = "jump"
+	}
+	return map[string]any{
+		"scene_num": sc.num,
+		"scene_units": []map[string]any{{
+			"unit_change_mode":       mode,
+			"unit_switch_duration":   40,
+			"unit_gradient_duration": 40,
+			"h":                      sc.h,
+			"s":                      sc.s,
+			"v":                      sc.v,
+			"bright":                 sc.bright,
+			"temperature":            sc.ct,
+		}},
+	}, nil
+}
+
+// SceneNames lists the built-in scene names in scene number order.
+func SceneNames() []string {
+	out := make([]string, len(scenes))
+	for name, sc := range scenes {
+		out[sc.num-1] = name
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package light
+
+import (
+	"reflect"
+	"testing"
+
+	"tuya-hub/internal/cloud"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := map[string]RGB{
+		"#ff8800":        {255, 136, 0},
+		"F80":            {255, 136, 0},
+		"rgb(10, 20,30)": {10, 20, 30},
+		"0,0,255":        {0, 0, 255},
+		"Orange":         {255, 136, 0},
+	}
+	for in, want := range cases {
+		got, err := ParseColor(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseColor(%q): expected %v, got %v (%v)", in, want, got, err)
+		}
+	}
+	for _, bad := range []string{"#ff88", "256,0,0", "chartreuse-ish"} {
+		if _, err := ParseColor(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+	if k, err := ParseKelvin("2700K"); err != nil || k != 2700 {
+		t.Fatalf("expected 2700, got %d (%v)", k, err)
+	}
+	if k, _ := ParseKelvin("daylight"); k != 6500 {
+		t.Fatalf("expected 6500, got %d", k)
+	}
+}
+
+var v2Spec = &cloud.Spec{Functions: []cloud.SpecItem{
+	{Code: "switch_led", Type: "Boolean", Values: "{}"},
+	{Code: "work_mode", Type: "Enum", Values: `{"range":["white","colour","scene","music"]}`},
+	{Code: "bright_value_v2", Type: "Integer", Values: `{"min":10,"max":1000,"scale":0,"step":1}`},
+	{Code: "temp_value_v2", Type: "Integer", Values: `{"min":0,"max":1000,"scale":0,"step":1}`},
+	{Code: "colour_data_v2", Type: "Json", Values: `{"h":{"min":0,"max":360},"s":{"min":0,"max":1000},"v":{"min":0,"max":1000}}`},
+	{Code: "scene_data_v2", Type: "Json", Values: "{}"},
+}}
+
+func TestCommandsV2(t *testing.T) {
+	orange := RGB{255, 136, 0}
+	bright := 60
+	cmds, err := Commands(v2Spec, Request{Color: &orange, Brightness: &bright})
+	if err != nil {
+		t.Fatalf("commands: %v", err)
+	}
+	want := []map[string]any{
+		{"code": "switch_led", "value": true},
+		{"code": "work_mode", "value": "colour"},
+		{"code": "colour_data_v2", "value": map[string]int{"h": 32, "s": 1000, "v": 600}},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("expected %v, got %v", want, cmds)
+	}
+
+	full := 100
+	cmds, err = Commands(v2Spec, Request{Kelvin: 4600, Brightness: &full})
+	if err != nil {
+		t.Fatalf("commands: %v", err)
+	}
+	want = []map[string]any{
+		{"code": "switch_led", "value": true},
+		{"code": "work_mode", "value": "white"},
+		{"code": "temp_value_v2", "value": 500},
+		{"code": "bright_value_v2", "value": 1000},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("expected %v, got %v", want, cmds)
+	}
+}
+
+func TestCommandsV1AndErrors(t *testing.T) {
+	spec := &cloud.Spec{Functions: []cloud.SpecItem{
+		{Code: "switch_led", Type: "Boolean"},
+		{Code: "colour_data", Type: "Json", Values: `{"h":{"min":0,"max":360},"s":{"min":0,"max":255},"v":{"min":0,"max":255}}`},
+	}}
+	blue := RGB{0, 0, 255}
+	cmds, err := Commands(spec, Request{Color: &blue})
+	if err != nil {
+		t.Fatalf("commands: %v", err)
+	}
+	if got := cmds[1]["value"]; !reflect.DeepEqual(got, map[string]int{"h": 240, "s": 255, "v": 255}) {
+		t.Fatalf("unexpected colour_data %v", got)
+	}
+	if _, err := Commands(spec, Request{Kelvin: 3000}); err == nil {
+		t.Fatalf("expected missing temp_value error")
+	}
+	if _, err := Commands(spec, Request{Scene: "night"}); err == nil {
+		t.Fatalf("expected v1 scene error")
+	}
+	if _, err := Commands(v2Spec, Request{Color: &blue, Kelvin: 3000}); err == nil {
+		t.Fatalf("expected conflicting settings error")
+	}
+	service, data := Request{Color: &blue, Kelvin: 0}.HAService()
+	if service != "turn_on" || !reflect.DeepEqual(data["rgb_color"], []int{0, 0, 255}) {
+		t.Fatalf("unexpected HA call %s %v", service, data)
+	}
+}
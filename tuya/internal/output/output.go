@@ -0,0 +1,374 @@
+// Package output renders command results in the formats every command
+// shares: aligned tables, JSON and YAML envelopes, NDJSON, CSV/TSV and Go
+// templates.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"tuya-hub/internal/util"
+)
+
+// Formats accepted by --format. Anything containing "{{" is a template.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatYAML     = "yaml"
+	FormatTemplate = "template"
+)
+
+// Formats lists the named formats in the order help text shows them.
+var Formats = []string{FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatTSV, FormatYAML, FormatTemplate}
+
+// Envelope wraps results in JSON and YAML output so scripts can rely on one
+// shape regardless of the command. Failures set OK to false and Error
+// instead of Data.
+type Envelope struct {
+	OK      bool           `json:"ok"`
+	Command string         `json:"command"`
+	Data    any            `json:"data,omitempty"`
+	Error   any            `json:"error,omitempty"`
+	Meta    map[string]any `json:"meta,omitempty"`
+}
+
+// Column is one field of a list result. Name is the header and the key used
+// by --columns and --sort.
+type Column[T any] struct {
+	Name  string
+	Value func(T) any
+}
+
+// Printer holds the output flags of one command invocation.
+type Printer struct {
+	W       io.Writer
+	Command string
+	// Format is a named format or a Go template such as '{{.Name}}: {{.Value}}'.
+	Format string
+	// Columns selects and orders table, CSV and TSV columns.
+	Columns []string
+	// NoHeader drops the header row of tables, CSV and TSV.
+	NoHeader bool
+	// Sort orders list results by a column; a leading "-" reverses it.
+	Sort string
+	// Meta is extra context attached to the envelope, e.g. paging totals.
+	Meta map[string]any
+}
+
+// Kind resolves Format to one of the named formats.
+func (p *Printer) Kind() (string, error) {
+	f := strings.TrimSpace(p.Format)
+	if f == "" {
+		return FormatTable, nil
+	}
+	if strings.Contains(f, "{{") {
+		return FormatTemplate, nil
+	}
+	f = strings.ToLower(f)
+	switch f {
+	case FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatTSV, FormatYAML:
+		return f, nil
+	case FormatTemplate:
+		return "", fmt.Errorf("--format template needs a template, e.g. --format '{{.Name}}'")
+	}
+	return "", fmt.Errorf("unknown format %q (want %s or a Go template)", p.Format, strings.Join(Formats[:len(Formats)-1], "|"))
+}
+
+// IsTable reports whether output is for humans, so commands can add notes
+// that would corrupt machine-readable formats.
+func (p *Printer) IsTable() bool {
+	kind, err := p.Kind()
+	return err == nil && kind == FormatTable
+}
+
+// Structured reports whether output is an envelope format (JSON, NDJSON or
+// YAML) that errors should be reported in too.
+func (p *Printer) Structured() bool {
+	kind, err := p.Kind()
+	return err == nil && (kind == FormatJSON || kind == FormatNDJSON || kind == FormatYAML)
+}
+
+// Fail prints a failure envelope carrying e. It is only meaningful for
+// Structured output.
+func (p *Printer) Fail(e any) error {
+	env := Envelope{Command: p.Command, Error: e}
+	kind, _ := p.Kind()
+	switch kind {
+	case FormatYAML:
+		return writeYAML(p.W, env)
+	case FormatNDJSON:
+		return writeLine(p.W, env)
+	}
+	return writeIndented(p.W, env)
+}
+
+// List renders items. Tables align columns to their widest cell instead of
+// truncating.
+func List[T any](p *Printer, items []T, cols []Column[T]) error {
+	kind, err := p.Kind()
+	if err != nil {
+		return err
+	}
+	items, err = sortItems(p.Sort, items, cols)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case FormatJSON, FormatYAML:
+		if items == nil {
+			items = []T{}
+		}
+		return p.envelope(kind, items)
+	case FormatNDJSON:
+		for _, item := range items {
+			if err := writeLine(p.W, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTemplate:
+		tmpl, err := parseTemplate(p.Format)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := execTemplate(p.W, tmpl, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	selected, err := selectColumns(p.Columns, cols)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(items)+1)
+	if !p.NoHeader {
+		header := make([]string, len(selected))
+		for i, c := range selected {
+			header[i] = strings.ToUpper(c.Name)
+		}
+		rows = append(rows, header)
+	}
+	for _, item := range items {
+		row := make([]string, len(selected))
+		for i, c := range selected {
+			row[i] = Cell(c.Value(item))
+		}
+		rows = append(rows, row)
+	}
+	switch kind {
+	case FormatCSV, FormatTSV:
+		w := csv.NewWriter(p.W)
+		if kind == FormatTSV {
+			w.Comma = '\t'
+		}
+		w.WriteAll(rows)
+		return w.Error()
+	}
+	return writeTable(p.W, rows)
+}
+
+// Object renders a single result. text prints the human form used by the
+// table format; CSV and TSV need rows, so they are rejected.
+func (p *Printer) Object(v any, text func(io.Writer)) error {
+	kind, err := p.Kind()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case FormatJSON, FormatYAML:
+		return p.envelope(kind, v)
+	case FormatNDJSON:
+		return writeLine(p.W, v)
+	case FormatTemplate:
+		tmpl, err := parseTemplate(p.Format)
+		if err != nil {
+			return err
+		}
+		return execTemplate(p.W, tmpl, v)
+	case FormatCSV, FormatTSV:
+		return fmt.Errorf("--format %s is not supported by %s", kind, p.Command)
+	}
+	text(p.W)
+	return nil
+}
+
+func (p *Printer) envelope(kind string, data any) error {
+	env := Envelope{OK: true, Command: p.Command, Data: data, Meta: p.Meta}
+	if kind == FormatYAML {
+		return writeYAML(p.W, env)
+	}
+	return writeIndented(p.W, env)
+}
+
+func writeIndented(w io.Writer, v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+func writeLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// Cell formats a value for a table or CSV cell. Structured values are
+// printed as compact JSON.
+func Cell(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case fmt.Stringer:
+		return t.String()
+	case map[string]any, []any:
+		data, err := json.Marshal(t)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func writeTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", "")
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = clean.Replace(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func findColumn[T any](name string, cols []Column[T]) (Column[T], bool) {
+	name = strings.TrimSpace(name)
+	for _, c := range cols {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Column[T]{}, false
+}
+
+func columnNames[T any](cols []Column[T]) string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func selectColumns[T any](names []string, cols []Column[T]) ([]Column[T], error) {
+	if len(names) == 0 {
+		return cols, nil
+	}
+	out := make([]Column[T], 0, len(names))
+	for _, name := range names {
+		c, ok := findColumn(name, cols)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, columnNames(cols))
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func sortItems[T any](key string, items []T, cols []Column[T]) ([]T, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return items, nil
+	}
+	desc := strings.HasPrefix(key, "-")
+	c, ok := findColumn(strings.TrimPrefix(key, "-"), cols)
+	if !ok {
+		return nil, fmt.Errorf("unknown sort column %q (available: %s)", strings.TrimPrefix(key, "-"), columnNames(cols))
+	}
+	sorted := append([]T(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := c.Value(sorted[i]), c.Value(sorted[j])
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return sorted, nil
+}
+
+// less compares numerically when both values are numbers (or numeric
+// strings, as Home Assistant reports states) and as text otherwise.
+func less(a, b any) bool {
+	fa, okA := number(a)
+	fb, okB := number(b)
+	if okA && okB {
+		return fa < fb
+	}
+	return Cell(a) < Cell(b)
+}
+
+func number(v any) (float64, bool) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return util.Number(v)
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+}
+
+// parseTemplate accepts \t and \n escapes so templates can be written on a
+// shell command line.
+func parseTemplate(text string) (*template.Template, error) {
+	text = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(text)
+	tmpl, err := template.New("format").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func execTemplate(w io.Writer, tmpl *template.Template, v any) error {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, v); err != nil {
+		return fmt.Errorf("--format template: %w", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
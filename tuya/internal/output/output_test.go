@@ -0,0 +1,128 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type reading struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+var readings = []reading{
+	{Name: "a very long sensor name that must not be cut", Value: 21.5},
+	{Name: "attic", Value: 9},
+	{Name: "basement", Value: 14.25},
+}
+
+var readingColumns = []Column[reading]{
+	{Name: "name", Value: func(r reading) any { return r.Name }},
+	{Name: "value", Value: func(r reading) any { return r.Value }},
+}
+
+func render(t *testing.T, p Printer) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p.W = &buf
+	p.Command = "poll"
+	if err := List(&p, readings, readingColumns); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	return buf.String()
+}
+
+func TestTableAutoWidth(t *testing.T) {
+	out := render(t, Printer{})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got %q", out)
+	}
+	if !strings.HasPrefix(lines[1], readings[0].Name+"  21.5") {
+		t.Fatalf("expected untruncated name, got %q", lines[1])
+	}
+	if strings.Index(lines[0], "VALUE") != strings.Index(lines[2], "9") {
+		t.Fatalf("expected aligned columns, got %q", out)
+	}
+}
+
+func TestSortColumnsNoHeader(t *testing.T) {
+	out := render(t, Printer{Format: "csv", Sort: "-value", Columns: []string{"VALUE", "name"}, NoHeader: true})
+	want := "21.5,a very long sensor name that must not be cut\n14.25,basement\n9,attic\n"
+	if out != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+	out = render(t, Printer{Format: "tsv", Sort: "name", Columns: []string{"name"}})
+	if out != "NAME\na very long sensor name that must not be cut\nattic\nbasement\n" {
+		t.Fatalf("unexpected tsv: %q", out)
+	}
+}
+
+func TestUnknownColumn(t *testing.T) {
+	p := Printer{W: &bytes.Buffer{}, Columns: []string{"unit"}}
+	if err := List(&p, readings, readingColumns); err == nil || !strings.Contains(err.Error(), "available: name, value") {
+		t.Fatalf("expected unknown column error, got %v", err)
+	}
+	p = Printer{W: &bytes.Buffer{}, Format: "xml"}
+	if _, err := p.Kind(); err == nil {
+		t.Fatalf("expected unknown format error")
+	}
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	out := render(t, Printer{Format: "json", Meta: map[string]any{"total": 3}})
+	var env struct {
+		OK      bool
+		Command string
+		Data    []reading
+		Meta    map[string]int
+	}
+	if err := json.Unmarshal([]byte(out), &env); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !env.OK || env.Command != "poll" || len(env.Data) != 3 || env.Meta["total"] != 3 {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+
+	var buf bytes.Buffer
+	p := Printer{W: &buf, Format: "json", Command: "poll"}
+	if err := List(&p, []reading(nil), readingColumns); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"data": []`) {
+		t.Fatalf("expected empty list, got %s", buf.String())
+	}
+}
+
+func TestNDJSONAndTemplate(t *testing.T) {
+	out := render(t, Printer{Format: "ndjson", Sort: "value"})
+	if !strings.HasPrefix(out, `{"name":"attic","value":9}`+"\n") || strings.Count(out, "\n") != 3 {
+		t.Fatalf("unexpected ndjson: %q", out)
+	}
+	out = render(t, Printer{Format: `{{.Name}}:\t{{.Value}}`, Sort: "name"})
+	if !strings.HasPrefix(out, readings[0].Name+":\t21.5\nattic:\t9\n") {
+		t.Fatalf("unexpected template output: %q", out)
+	}
+}
+
+func TestYAMLKeepsOrderAndNumbers(t *testing.T) {
+	var buf bytes.Buffer
+	p := Printer{W: &buf, Format: "yaml", Command: "get"}
+	err := p.Object(map[string]any{"time": int64(1700000000123), "on": "true", "id": "007"}, nil)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "ok: true\ncommand: get\ndata:\n  id: \"007\"\n  on: \"true\"\n  time: 1700000000123\n"
+	if buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestObjectRejectsCSV(t *testing.T) {
+	p := Printer{W: &bytes.Buffer{}, Format: "csv", Command: "set"}
+	if err := p.Object(true, nil); err == nil {
+		t.Fatalf("expected csv to be rejected")
+	}
+}
@@ -0,0 +1,162 @@
+// Package plan describes batches of writes: which devices a step targets
+// (an id, or a selector that fans out by name, room, category or group)
+// and what to send them. tuya apply reads a plan from YAML; set builds a
+// one-step plan from its flags.
+package plan
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConcurrency is how many targets are written at once.
+const DefaultConcurrency = 4
+
+// Selector picks targets. ID names one device or entity (or alias); the
+// other fields fan out and are combined with AND.
+type Selector struct {
+	ID       string `yaml:"id,omitempty" json:"id,omitempty"`
+	Filter   string `yaml:"filter,omitempty" json:"filter,omitempty"`
+	Room     string `yaml:"room,omitempty" json:"room,omitempty"`
+	Category string `yaml:"category,omitempty" json:"category,omitempty"`
+	Group    string `yaml:"group,omitempty" json:"group,omitempty"`
+}
+
+// FanOut reports whether the selector can match more than one target.
+func (s Selector) FanOut() bool {
+	return s.Filter != "" || s.Room != "" || s.Category != "" || s.Group != ""
+}
+
+// Empty reports whether nothing is selected.
+func (s Selector) Empty() bool {
+	return s.ID == "" && !s.FanOut()
+}
+
+// Command is one DP write.
+type Command struct {
+	Code  string `yaml:"code" json:"code"`
+	Value any    `yaml:"value" json:"value"`
+}
+
+// Step is one write applied to every target its selector matches. Cloud
+// steps send Commands; Home Assistant steps set State (on|off) or call
+// Service with Data, the target's entity_id added.
+type Step struct {
+	Name     string `yaml:"name,omitempty"`
+	Selector `yaml:",inline"`
+	Commands []Command      `yaml:"commands,omitempty"`
+	State    string         `yaml:"state,omitempty"`
+	Service  string         `yaml:"service,omitempty"`
+	Data     map[string]any `yaml:"data,omitempty"`
+}
+
+// Label names the step in messages: its name, or its position.
+func (s Step) Label(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// Validate checks that the step has a target and exactly one kind of write.
+func (s Step) Validate() error {
+	if s.Empty() {
+		return fmt.Errorf("no target: set id, filter, room, category or group")
+	}
+	if s.ID != "" && s.FanOut() {
+		return fmt.Errorf("id cannot be combined with filter, room, category or group")
+	}
+	writes := 0
+	for _, set := range []bool{len(s.Commands) > 0, s.State != "", s.Service != ""} {
+		if set {
+			writes++
+		}
+	}
+	if writes != 1 {
+		return fmt.Errorf("set exactly one of commands, state or service")
+	}
+	for _, c := range s.Commands {
+		if strings.TrimSpace(c.Code) == "" {
+			return fmt.Errorf("command without code")
+		}
+		if c.Value == nil {
+			return fmt.Errorf("command %s has no value", c.Code)
+		}
+	}
+	if st := strings.ToLower(s.State); st != "" && st != "on" && st != "off" {
+		return fmt.Errorf("state must be on or off, got %q", s.State)
+	}
+	if s.Service != "" && !strings.Contains(s.Service, ".") {
+		return fmt.Errorf("service must be domain.service, got %q", s.Service)
+	}
+	return nil
+}
+
+// Plan is a list of steps run in order; the targets of each step are
+// written concurrently, at most Concurrency at a time.
+type Plan struct {
+	Concurrency int    `yaml:"concurrency,omitempty"`
+	Steps       []Step `yaml:"steps"`
+}
+
+// Load reads a plan from a YAML file, or stdin for "-".
+func Load(path string) (*Plan, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse reads and validates a plan.
+func Parse(data []byte) (*Plan, error) {
+	var p Plan
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse plan: %w", err)
+	}
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("plan has no steps")
+	}
+	for i, s := range p.Steps {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Label(i), err)
+		}
+	}
+	if p.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency must be positive")
+	}
+	if p.Concurrency == 0 {
+		p.Concurrency = DefaultConcurrency
+	}
+	return &p, nil
+}
+
+// Run calls do for every index in [0, n) with at most concurrency calls in
+// flight, and returns when all have finished.
+func Run(n, concurrency int, do func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			do(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+steps:
+  - name: party
+    room: lounge
+    commands:
+      - {code: switch_led, value: true}
+      - {code: colour_data_v2, value: {h: 300, s: 1000, v: 1000}}
+  - group: heaters
+    state: off
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if p.Concurrency != DefaultConcurrency || len(p.Steps) != 2 {
+		t.Fatalf("unexpected plan %+v", p)
+	}
+	if s := p.Steps[0]; s.Room != "lounge" || len(s.Commands) != 2 || s.Commands[0].Value != true {
+		t.Fatalf("unexpected first step %+v", s)
+	}
+	if p.Steps[1].Label(1) != "step 2" || !p.Steps[1].FanOut() {
+		t.Fatalf("unexpected second step %+v", p.Steps[1])
+	}
+
+	bad := map[string]string{
+		"no steps":      `concurrency: 2`,
+		"no target":     "steps:\n  - state: on\n",
+		"two writes":    "steps:\n  - id: x\n    state: on\n    service: light.turn_on\n",
+		"id and filter": "steps:\n  - id: x\n    filter: lamp\n    state: on\n",
+		"bad state":     "steps:\n  - id: x\n    state: dim\n",
+		"no value":      "steps:\n  - id: x\n    commands: [{code: switch_1}]\n",
+	}
+	for name, src := range bad {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var inFlight, peak int32
+	var mu sync.Mutex
+	done := map[int]bool{}
+	Run(10, 3, func(i int) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		mu.Lock()
+		done[i] = true
+		mu.Unlock()
+	})
+	if len(done) != 10 {
+		t.Fatalf("expected 10 calls, got %d", len(done))
+	}
+	if peak > 3 {
+		t.Fatalf("expected at most 3 in flight, got %d", peak)
+	}
+}
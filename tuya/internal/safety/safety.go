@@ -0,0 +1,215 @@
+package safety
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"tuya-hub/internal/config"
+)
+
+// Action describes a write the CLI is about to perform. A service call that
+// names several entities lists them in Entities; targets it selects without
+// naming entities (area_id=..., device_id=...) go in Scopes.
+type Action struct {
+	Kind       string   `json:"kind"`
+	Entity     string   `json:"entity,omitempty"`
+	Entities   []string `json:"entities,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	DeviceID   string   `json:"deviceId,omitempty"`
+	DeviceName string   `json:"deviceName,omitempty"`
+	Codes      []string `json:"codes,omitempty"`
+	Service    string   `json:"service,omitempty"`
+}
+
+func (a Action) Target() string {
+	entity := strings.Join(append(a.entities(), a.Scopes...), ",")
+	switch {
+	case a.Service != "" && entity != "":
+		return a.Service + " " + entity
+	case a.Service != "":
+		return a.Service
+	case entity != "":
+		return entity
+	case a.DeviceName != "":
+		return fmt.Sprintf("%s (%s)", a.DeviceName, a.DeviceID)
+	}
+	return a.DeviceID
+}
+
+// Refusal is returned when the policy blocks an action. NeedsConfirm marks
+// actions that are allowed only after explicit confirmation (--yes).
+type Refusal struct {
+	Action       Action `json:"action"`
+	Rule         string `json:"rule"`
+	Reason       string `json:"reason"`
+	Hint         string `json:"hint,omitempty"`
+	NeedsConfirm bool   `json:"needsConfirm,omitempty"`
+}
+
+// entities returns every entity the action names.
+func (a Action) entities() []string {
+	if a.Entity == "" {
+		return a.Entities
+	}
+	return append([]string{a.Entity}, a.Entities...)
+}
+
+func (r *Refusal) Error() string {
+	msg := fmt.Sprintf("refused %s %s: %s (%s)", r.Action.Kind, r.Action.Target(), r.Reason, r.Rule)
+	if r.Hint != "" {
+		msg += "; " + r.Hint
+	}
+	return msg
+}
+
+// dangerousServices require confirmation even when no safety section exists.
+var dangerousServices = []string{
+	"homeassistant.restart",
+	"homeassistant.stop",
+	"homeassistant.reload_all",
+	"hassio.host_*",
+	"hassio.addon_stop",
+	"hassio.backup_*",
+	"recorder.purge*",
+}
+
+type Policy struct {
+	cfg config.Safety
+}
+
+func New(cfg config.Safety) *Policy {
+	return &Policy{cfg: cfg}
+}
+
+func (p *Policy) ReadOnly() bool {
+	return p.cfg.ReadOnly
+}
+
+// Check returns nil when the action may proceed, or a *Refusal.
+func (p *Policy) Check(a Action) error {
+	if p.cfg.ReadOnly {
+		return &Refusal{Action: a, Rule: "safety.readOnly", Reason: "config is read-only", Hint: "remove safety.readOnly to allow writes"}
+	}
+
+	deny := p.cfg.Deny
+	if pat, ok := matchFirst(deny.Entities, a.entities()...); ok {
+		return denied(a, "safety.deny.entities", pat)
+	}
+	if len(deny.Entities) > 0 && len(a.Scopes) > 0 {
+		return &Refusal{
+			Action: a,
+			Rule:   "safety.deny.entities",
+			Reason: "the call targets " + strings.Join(a.Scopes, ",") + ", which cannot be checked against the deny list",
+			Hint:   "name the entities in entity_id instead",
+		}
+	}
+	if pat, ok := matchFirst(deny.Devices, a.DeviceID, a.DeviceName); ok {
+		return denied(a, "safety.deny.devices", pat)
+	}
+	for _, code := range a.Codes {
+		if pat, ok := matchFirst(deny.Codes, code); ok {
+			return denied(a, "safety.deny.codes", pat)
+		}
+	}
+	if pat, ok := matchFirst(deny.Services, a.Service); ok {
+		return denied(a, "safety.deny.services", pat)
+	}
+
+	if p.allowed(a) {
+		return nil
+	}
+
+	if len(p.cfg.Allow.Entities) > 0 && len(a.Scopes) > 0 {
+		return &Refusal{
+			Action:       a,
+			Rule:         "safety.allow.entities",
+			Reason:       "the call targets " + strings.Join(a.Scopes, ",") + ", which cannot be checked against the allow list",
+			Hint:         "pass --yes to confirm, or name the entities in entity_id",
+			NeedsConfirm: true,
+		}
+	}
+
+	if pat, ok := matchFirst(dangerousServices, a.Service); ok {
+		return &Refusal{
+			Action:       a,
+			Rule:         "builtin:" + pat,
+			Reason:       "service is denied by default",
+			Hint:         "pass --yes to confirm, or add it to safety.allow.services",
+			NeedsConfirm: true,
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(p.cfg.Default)) {
+	case "", "allow":
+		return nil
+	case "confirm":
+		return &Refusal{
+			Action:       a,
+			Rule:         "safety.default=confirm",
+			Reason:       "target is not in safety.allow",
+			Hint:         "pass --yes to confirm, or add it to safety.allow",
+			NeedsConfirm: true,
+		}
+	default:
+		return &Refusal{
+			Action: a,
+			Rule:   "safety.default=" + p.cfg.Default,
+			Reason: "target is not in safety.allow",
+			Hint:   "add it to safety.allow",
+		}
+	}
+}
+
+// allowed reports whether a configured allow list covers the action: all
+// of its entities, its device, its service or all of its codes match. Empty
+// lists are not consulted.
+func (p *Policy) allowed(a Action) bool {
+	allow := p.cfg.Allow
+	if entities := a.entities(); len(entities) > 0 && len(a.Scopes) == 0 && matchAll(allow.Entities, entities) {
+		return true
+	}
+	if _, ok := matchFirst(allow.Devices, a.DeviceID, a.DeviceName); ok {
+		return true
+	}
+	if _, ok := matchFirst(allow.Services, a.Service); ok {
+		return true
+	}
+	return len(a.Codes) > 0 && matchAll(allow.Codes, a.Codes)
+}
+
+// matchAll reports whether every value matches one of patterns.
+func matchAll(patterns, values []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := matchFirst(patterns, v); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func denied(a Action, rule, pattern string) *Refusal {
+	return &Refusal{
+		Action: a,
+		Rule:   rule + ": " + pattern,
+		Reason: "target is on the deny list",
+		Hint:   "remove the pattern from " + rule + " to allow it",
+	}
+}
+
+func matchFirst(patterns []string, values ...string) (string, bool) {
+	for _, p := range patterns {
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if ok, _ := path.Match(p, v); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
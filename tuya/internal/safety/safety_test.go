@@ -0,0 +1,105 @@
+package safety
+
+import (
+	"errors"
+	"testing"
+
+	"tuya-hub/internal/config"
+)
+
+func TestDefaultPolicyAllowsExceptDangerous(t *testing.T) {
+	p := New(config.Safety{})
+	if err := p.Check(Action{Kind: "set", Entity: "switch.patio", Service: "switch.turn_on"}); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+	err := p.Check(Action{Kind: "call", Service: "homeassistant.restart"})
+	var r *Refusal
+	if !errors.As(err, &r) || !r.NeedsConfirm {
+		t.Fatalf("expected confirmation refusal, got %v", err)
+	}
+}
+
+func TestDenyBeatsAllow(t *testing.T) {
+	p := New(config.Safety{
+		Allow: config.SafetyRules{Devices: []string{"*"}},
+		Deny:  config.SafetyRules{Devices: []string{"Fridge*"}, Codes: []string{"child_lock"}},
+	})
+	err := p.Check(Action{Kind: "command", DeviceID: "abc", DeviceName: "Fridge plug", Codes: []string{"switch_1"}})
+	var r *Refusal
+	if !errors.As(err, &r) || r.NeedsConfirm || r.Rule != "safety.deny.devices: Fridge*" {
+		t.Fatalf("expected hard deny, got %v", err)
+	}
+	if err := p.Check(Action{Kind: "command", DeviceID: "abc", Codes: []string{"child_lock"}}); err == nil {
+		t.Fatalf("expected code deny")
+	}
+	if err := p.Check(Action{Kind: "command", DeviceID: "abc", Codes: []string{"switch_1"}}); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+}
+
+func TestDefaultConfirmAndDeny(t *testing.T) {
+	p := New(config.Safety{Default: "confirm", Allow: config.SafetyRules{Entities: []string{"light.*"}}})
+	if err := p.Check(Action{Kind: "set", Entity: "light.patio", Service: "light.turn_on"}); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+	var r *Refusal
+	if err := p.Check(Action{Kind: "set", Entity: "switch.heater", Service: "switch.turn_on"}); !errors.As(err, &r) || !r.NeedsConfirm {
+		t.Fatalf("expected confirm, got %v", err)
+	}
+
+	p = New(config.Safety{Default: "deny"})
+	if err := p.Check(Action{Kind: "set", Entity: "switch.heater"}); !errors.As(err, &r) || r.NeedsConfirm {
+		t.Fatalf("expected hard deny, got %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	p := New(config.Safety{ReadOnly: true, Allow: config.SafetyRules{Entities: []string{"*"}}})
+	if err := p.Check(Action{Kind: "set", Entity: "light.patio"}); err == nil {
+		t.Fatalf("expected read-only refusal")
+	}
+}
+
+func TestServiceCallTargets(t *testing.T) {
+	p := New(config.Safety{Deny: config.SafetyRules{Entities: []string{"switch.fridge*"}}})
+	var r *Refusal
+	err := p.Check(Action{Kind: "call", Service: "switch.turn_off", Entities: []string{"switch.patio", "switch.fridge"}})
+	if !errors.As(err, &r) || r.NeedsConfirm || r.Rule != "safety.deny.entities: switch.fridge*" {
+		t.Fatalf("expected the listed fridge to be denied, got %v", err)
+	}
+	err = p.Check(Action{Kind: "call", Service: "switch.turn_off", Scopes: []string{"area_id=kitchen"}})
+	if !errors.As(err, &r) || r.NeedsConfirm {
+		t.Fatalf("expected an area target to be refused under entity deny rules, got %v", err)
+	}
+
+	p = New(config.Safety{Allow: config.SafetyRules{Entities: []string{"light.*"}}})
+	err = p.Check(Action{Kind: "call", Service: "light.turn_on", Scopes: []string{"device_id=abc"}})
+	if !errors.As(err, &r) || !r.NeedsConfirm {
+		t.Fatalf("expected a device target to need confirmation under entity allow rules, got %v", err)
+	}
+	if err := New(config.Safety{}).Check(Action{Kind: "call", Service: "light.turn_on", Scopes: []string{"area_id=lounge"}}); err != nil {
+		t.Fatalf("expected area targets to pass without entity rules, got %v", err)
+	}
+}
+
+func TestAnyAllowListIsEnough(t *testing.T) {
+	cases := []struct {
+		name  string
+		allow config.SafetyRules
+		a     Action
+		ok    bool
+	}{
+		{"service", config.SafetyRules{Services: []string{"light.*"}}, Action{Kind: "set", Entity: "light.patio", Service: "light.turn_on"}, true},
+		{"device name", config.SafetyRules{Devices: []string{"Desk*"}}, Action{Kind: "set", DeviceID: "abc", DeviceName: "Desk lamp", Codes: []string{"switch_led"}}, true},
+		{"codes", config.SafetyRules{Codes: []string{"bright_value*", "switch_led"}}, Action{Kind: "set", DeviceID: "abc", Codes: []string{"switch_led", "bright_value_v2"}}, true},
+		{"one code outside", config.SafetyRules{Codes: []string{"switch_led"}}, Action{Kind: "set", DeviceID: "abc", Codes: []string{"switch_led", "child_lock"}}, false},
+		{"every entity", config.SafetyRules{Entities: []string{"light.*"}}, Action{Kind: "call", Service: "light.turn_on", Entities: []string{"light.a", "switch.b"}}, false},
+		{"other entity", config.SafetyRules{Entities: []string{"light.*"}}, Action{Kind: "set", Entity: "switch.heater", Service: "switch.turn_on"}, false},
+	}
+	for _, c := range cases {
+		err := New(config.Safety{Default: "deny", Allow: c.allow}).Check(c.a)
+		if (err == nil) != c.ok {
+			t.Fatalf("%s: expected allowed=%v, got %v", c.name, c.ok, err)
+		}
+	}
+}
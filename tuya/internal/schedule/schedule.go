@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed schedule expression: either a cron expression or a solar
+// event ("sunrise", "sunset-30m", "sunrise+1h15m").
+type Spec struct {
+	Expr string
+
+	cron   *Cron
+	solar  string
+	offset time.Duration
+}
+
+// Location is the observer position used for solar schedules.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Set       bool
+}
+
+func Parse(expr string) (*Spec, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("empty schedule")
+	}
+	lower := strings.ToLower(expr)
+	for _, event := range []string{"sunrise", "sunset"} {
+		if !strings.HasPrefix(lower, event) {
+			continue
+		}
+		spec := &Spec{Expr: expr, solar: event}
+		rest := strings.TrimSpace(lower[len(event):])
+		if rest == "" {
+			return spec, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			return nil, fmt.Errorf("invalid solar offset %q (use e.g. sunset-30m)", expr)
+		}
+		d, err := time.ParseDuration(strings.TrimPrefix(rest, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid solar offset %q: %w", expr, err)
+		}
+		spec.offset = d
+		return spec, nil
+	}
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{Expr: expr, cron: c}, nil
+}
+
+func (s *Spec) IsSolar() bool {
+	return s.solar != ""
+}
+
+// Next returns the first occurrence strictly after t, in t's location.
+func (s *Spec) Next(t time.Time, loc Location) (time.Time, error) {
+	if s.cron != nil {
+		next, ok := s.cron.Next(t)
+		if !ok {
+			return time.Time{}, fmt.Errorf("schedule %q never fires", s.Expr)
+		}
+		return next, nil
+	}
+	if !loc.Set {
+		return time.Time{}, errors.New("solar schedules need location.latitude/longitude in config")
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day()-1, 12, 0, 0, 0, t.Location())
+	for i := 0; i < 370; i++ {
+		event, ok := SunEvent(day.AddDate(0, 0, i), loc.Latitude, loc.Longitude, s.solar == "sunrise")
+		if !ok {
+			continue
+		}
+		event = event.Add(s.offset)
+		if event.After(t) {
+			return event, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no %s within a year at this location", s.solar)
+}
+
+// Between lists the occurrences in (from, to], capped at max entries.
+func (s *Spec) Between(from, to time.Time, loc Location, max int) ([]time.Time, error) {
+	var out []time.Time
+	cur := from
+	for len(out) < max {
+		next, err := s.Next(cur, loc)
+		if err != nil {
+			return out, err
+		}
+		if next.After(to) {
+			break
+		}
+		out = append(out, next)
+		cur = next
+	}
+	return out, nil
+}
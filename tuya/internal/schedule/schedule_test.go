@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	spec, err := Parse("30 7 * * 1-5")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	// Saturday 2024-06-22 10:00 -> Monday 07:30.
+	next, err := spec.Next(time.Date(2024, 6, 22, 10, 0, 0, 0, loc), Location{})
+	if err != nil {
+		t.Fatalf("next failed: %v", err)
+	}
+	want := time.Date(2024, 6, 24, 7, 30, 0, 0, loc)
+	if !next.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, next)
+	}
+}
+
+func TestCronSteps(t *testing.T) {
+	spec, err := Parse("*/15 * * * *")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	next, _ := spec.Next(time.Date(2024, 1, 1, 10, 16, 0, 0, time.UTC), Location{})
+	if next.Minute() != 30 {
+		t.Fatalf("expected :30, got %v", next)
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"* * *", "61 * * * *", "a b c d e", "sunset+x"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestSunEventAmsterdam(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*3600)
+	day := time.Date(2024, 6, 21, 12, 0, 0, 0, cest)
+	rise, ok := SunEvent(day, 52.37, 4.90, true)
+	if !ok {
+		t.Fatalf("expected sunrise")
+	}
+	set, ok := SunEvent(day, 52.37, 4.90, false)
+	if !ok {
+		t.Fatalf("expected sunset")
+	}
+	assertNear(t, rise, time.Date(2024, 6, 21, 5, 18, 0, 0, cest))
+	assertNear(t, set, time.Date(2024, 6, 21, 22, 6, 0, 0, cest))
+}
+
+func TestSolarOffset(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*3600)
+	spec, err := Parse("sunset-30m")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	loc := Location{Latitude: 52.37, Longitude: 4.90, Set: true}
+	next, err := spec.Next(time.Date(2024, 6, 21, 23, 0, 0, 0, cest), loc)
+	if err != nil {
+		t.Fatalf("next failed: %v", err)
+	}
+	assertNear(t, next, time.Date(2024, 6, 22, 21, 36, 0, 0, cest))
+
+	if _, err := spec.Next(time.Now(), Location{}); err == nil {
+		t.Fatalf("expected error without location")
+	}
+}
+
+func TestPolarNight(t *testing.T) {
+	if _, ok := SunEvent(time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC), 78.22, 15.65, true); ok {
+		t.Fatalf("expected no sunrise in Svalbard polar night")
+	}
+}
+
+func assertNear(t *testing.T, got, want time.Time) {
+	t.Helper()
+	diff := got.Sub(want)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > 3*time.Minute {
+		t.Fatalf("expected ~%v, got %v", want, got)
+	}
+}
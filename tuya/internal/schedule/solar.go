@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"math"
+	"time"
+)
+
+// zenithOfficial is the sun's zenith angle at sunrise/sunset, accounting for
+// atmospheric refraction and the solar disc radius.
+const zenithOfficial = 90.833
+
+// SunEvent returns sunrise (rising=true) or sunset for the calendar date of day
+// in day's location, at the given latitude/longitude in degrees. ok is false
+// when the sun does not rise or set on that date (polar day/night).
+func SunEvent(day time.Time, lat, lon float64, rising bool) (time.Time, bool) {
+	loc := day.Location()
+	y, m, d := day.Date()
+	n := float64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).YearDay())
+
+	lngHour := lon / 15
+	var t float64
+	if rising {
+		t = n + (6-lngHour)/24
+	} else {
+		t = n + (18-lngHour)/24
+	}
+
+	meanAnomaly := 0.9856*t - 3.289
+	trueLong := normalizeDegrees(meanAnomaly + 1.916*sinDeg(meanAnomaly) + 0.020*sinDeg(2*meanAnomaly) + 282.634)
+
+	ra := normalizeDegrees(radToDeg(math.Atan(0.91764 * tanDeg(trueLong))))
+	ra += math.Floor(trueLong/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	sinDec := 0.39782 * sinDeg(trueLong)
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	cosH := (cosDeg(zenithOfficial) - sinDec*sinDeg(lat)) / (cosDec * cosDeg(lat))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+	var h float64
+	if rising {
+		h = 360 - radToDeg(math.Acos(cosH))
+	} else {
+		h = radToDeg(math.Acos(cosH))
+	}
+	h /= 15
+
+	localMean := h + ra - 0.06571*t - 6.622
+	ut := math.Mod(localMean-lngHour, 24)
+	if ut < 0 {
+		ut += 24
+	}
+
+	event := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(time.Duration(ut * float64(time.Hour))).In(loc)
+	// The UTC calculation can land on the neighbouring local date; shift it
+	// back onto the requested day.
+	ey, em, ed := event.Date()
+	want := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	got := time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC)
+	if got.After(want) {
+		event = event.Add(-24 * time.Hour)
+	} else if got.Before(want) {
+		event = event.Add(24 * time.Hour)
+	}
+	return event.Truncate(time.Second), true
+}
+
+func sinDeg(d float64) float64   { return math.Sin(d * math.Pi / 180) }
+func cosDeg(d float64) float64   { return math.Cos(d * math.Pi / 180) }
+func tanDeg(d float64) float64   { return math.Tan(d * math.Pi / 180) }
+func radToDeg(r float64) float64 { return r * 180 / math.Pi }
+
+func normalizeDegrees(d float64) float64 {
+	d = math.Mod(d, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d
+}
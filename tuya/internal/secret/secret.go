@@ -0,0 +1,115 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Reference prefixes understood by Resolve. Any other value is plaintext.
+const (
+	PrefixEnv   = "env:"
+	PrefixFile  = "file:"
+	PrefixCmd   = "cmd:"
+	PrefixVault = "vault:"
+)
+
+func IsRef(v string) bool {
+	v = strings.TrimSpace(v)
+	for _, p := range []string{PrefixEnv, PrefixFile, PrefixCmd, PrefixVault} {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver turns secret references into values. The vault is opened lazily,
+// at most once, on the first vault: reference.
+type Resolver struct {
+	VaultPath  string
+	Passphrase func() (string, error)
+
+	once     sync.Once
+	vault    map[string]string
+	vaultErr error
+}
+
+func (r *Resolver) Resolve(v string) (string, error) {
+	trimmed := strings.TrimSpace(v)
+	switch {
+	case strings.HasPrefix(trimmed, PrefixEnv):
+		name := strings.TrimSpace(strings.TrimPrefix(trimmed, PrefixEnv))
+		val, ok := os.LookupEnv(name)
+		if !ok || strings.TrimSpace(val) == "" {
+			return "", fmt.Errorf("secret %s: environment variable %s is not set", trimmed, name)
+		}
+		return strings.TrimSpace(val), nil
+	case strings.HasPrefix(trimmed, PrefixFile):
+		path := expandHome(strings.TrimSpace(strings.TrimPrefix(trimmed, PrefixFile)))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", trimmed, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(trimmed, PrefixCmd):
+		command := strings.TrimSpace(strings.TrimPrefix(trimmed, PrefixCmd))
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return "", fmt.Errorf("secret %s: %s", trimmed, msg)
+		}
+		// Password managers print the secret on the first line.
+		line, _, _ := strings.Cut(string(out), "\n")
+		return strings.TrimSpace(line), nil
+	case strings.HasPrefix(trimmed, PrefixVault):
+		key := strings.TrimSpace(strings.TrimPrefix(trimmed, PrefixVault))
+		vault, err := r.openVault()
+		if err != nil {
+			return "", err
+		}
+		val, ok := vault[key]
+		if !ok {
+			return "", fmt.Errorf("secret %s: key not in vault %s", trimmed, r.VaultPath)
+		}
+		return val, nil
+	}
+	return v, nil
+}
+
+func (r *Resolver) openVault() (map[string]string, error) {
+	r.once.Do(func() {
+		if r.Passphrase == nil {
+			r.vaultErr = errors.New("vault passphrase unavailable (set TUYA_VAULT_PASSPHRASE)")
+			return
+		}
+		pass, err := r.Passphrase()
+		if err != nil {
+			r.vaultErr = err
+			return
+		}
+		r.vault, r.vaultErr = OpenVault(r.VaultPath, pass)
+	})
+	return r.vault, r.vaultErr
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
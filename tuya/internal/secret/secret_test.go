@@ -0,0 +1,65 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveRefs(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "key")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	t.Setenv("TUYA_TEST_SECRET", "from-env")
+
+	r := &Resolver{}
+	cases := map[string]string{
+		"plain":                 "plain",
+		"env:TUYA_TEST_SECRET":  "from-env",
+		"file:" + file:          "from-file",
+		"cmd:printf 'a\\nb\\n'": "a",
+	}
+	for in, want := range cases {
+		got, err := r.Resolve(in)
+		if err != nil {
+			t.Fatalf("resolve %q failed: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("resolve %q: expected %q, got %q", in, want, got)
+		}
+	}
+
+	if _, err := r.Resolve("env:TUYA_TEST_MISSING"); err == nil {
+		t.Fatalf("expected error for unset env var")
+	}
+	if !IsRef("vault:cloud.accessKey") || IsRef("abc") {
+		t.Fatalf("IsRef mismatch")
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	if err := SaveVault(path, "hunter2", map[string]string{"cloud.accessKey": "k"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600, got %v", info.Mode().Perm())
+	}
+
+	r := &Resolver{VaultPath: path, Passphrase: func() (string, error) { return "hunter2", nil }}
+	got, err := r.Resolve("vault:cloud.accessKey")
+	if err != nil || got != "k" {
+		t.Fatalf("expected k, got %q (%v)", got, err)
+	}
+
+	if _, err := OpenVault(path, "wrong"); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+}
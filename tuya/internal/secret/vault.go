@@ -0,0 +1,117 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Vault files hold a JSON map of secrets encrypted with AES-256-GCM under a
+// key derived from the passphrase with scrypt.
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrBadPassphrase = errors.New("vault: wrong passphrase or corrupted file")
+
+// OpenVault decrypts the vault at path. A missing file is an empty vault.
+func OpenVault(path, passphrase string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	var vf vaultFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		return nil, fmt.Errorf("vault %s: %w", path, err)
+	}
+	if vf.KDF != "scrypt" {
+		return nil, fmt.Errorf("vault %s: unsupported kdf %q", path, vf.KDF)
+	}
+	gcm, err := vaultCipher(passphrase, vf.Salt, vf.N, vf.R, vf.P)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, vf.Nonce, vf.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	out := map[string]string{}
+	if err := json.Unmarshal(plain, &out); err != nil {
+		return nil, fmt.Errorf("vault %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// SaveVault encrypts secrets with a fresh salt and nonce and writes the vault
+// atomically with 0600 permissions.
+func SaveVault(path, passphrase string, secrets map[string]string) error {
+	if passphrase == "" {
+		return errors.New("vault passphrase must not be empty")
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	vf := vaultFile{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP}
+	vf.Salt = make([]byte, 16)
+	if _, err := rand.Read(vf.Salt); err != nil {
+		return err
+	}
+	gcm, err := vaultCipher(passphrase, vf.Salt, vf.N, vf.R, vf.P)
+	if err != nil {
+		return err
+	}
+	vf.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(vf.Nonce); err != nil {
+		return err
+	}
+	vf.Ciphertext = gcm.Seal(nil, vf.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(vf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func vaultCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
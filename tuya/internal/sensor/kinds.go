@@ -0,0 +1,248 @@
+// Package sensor maps Home Assistant device classes and Tuya DP codes to
+// sensor kinds (temperature, battery, power, ...) so poll can find readings
+// on either backend.
+package sensor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"tuya-hub/internal/config"
+)
+
+// All selects every registered kind.
+const All = "all"
+
+// Kind describes how to recognize one kind of reading.
+type Kind struct {
+	Name string `json:"name"`
+	// Unit is the canonical unit of the kind; empty for binary sensors.
+	Unit string `json:"unit,omitempty"`
+	// DeviceClasses are Home Assistant device_class values.
+	DeviceClasses []string `json:"deviceClasses,omitempty"`
+	// Units identify HA entities without a device_class. Ambiguous units
+	// such as % are left out so a battery is never taken for humidity.
+	Units []string `json:"units,omitempty"`
+	// Codes are Tuya DP codes; * globs are allowed.
+	Codes []string `json:"codes,omitempty"`
+	// Categories, when set, limits code matches to devices of these Tuya
+	// categories.
+	Categories []string `json:"categories,omitempty"`
+}
+
+// Builtin lists the kinds known without configuration.
+var Builtin = []Kind{
+	{Name: "temperature", Unit: "°C", DeviceClasses: []string{"temperature"}, Units: []string{"°C", "°F", "K"},
+		Codes: []string{"va_temperature", "temp_current", "temp_current_f", "temp_indoor", "temp_indoor_f", "temp_current_external", "temp_current_external_f", "temperature"}},
+	{Name: "humidity", Unit: "%", DeviceClasses: []string{"humidity"},
+		Codes: []string{"va_humidity", "humidity_value", "humidity_indoor", "humidity_current", "humidity"}},
+	{Name: "battery", Unit: "%", DeviceClasses: []string{"battery"},
+		Codes: []string{"battery_percentage", "va_battery", "battery", "battery_value", "residual_electricity"}},
+	// battery_state is a low/middle/high enum, not a percentage.
+	{Name: "battery_state", Codes: []string{"battery_state"}},
+	{Name: "power", Unit: "W", DeviceClasses: []string{"power"}, Units: []string{"W", "kW"},
+		Codes: []string{"cur_power", "power", "phase_a_power"}},
+	{Name: "energy", Unit: "kWh", DeviceClasses: []string{"energy"}, Units: []string{"Wh", "kWh"},
+		Codes: []string{"add_ele", "total_forward_energy", "forward_energy_total"}},
+	{Name: "voltage", Unit: "V", DeviceClasses: []string{"voltage"}, Units: []string{"V", "mV"},
+		Codes: []string{"cur_voltage", "voltage"}},
+	{Name: "current", Unit: "A", DeviceClasses: []string{"current"}, Units: []string{"A", "mA"},
+		Codes: []string{"cur_current", "current"}},
+	{Name: "co2", Unit: "ppm", DeviceClasses: []string{"carbon_dioxide"}, Units: []string{"ppm"},
+		Codes: []string{"co2_value", "co2"}},
+	{Name: "pm2.5", Unit: "µg/m³", DeviceClasses: []string{"pm25"},
+		Codes: []string{"pm25_value", "pm25", "pm2_5"}},
+	{Name: "voc", Unit: "ppm", DeviceClasses: []string{"volatile_organic_compounds", "volatile_organic_compounds_parts"},
+		Codes: []string{"voc_value", "voc"}},
+	{Name: "illuminance", Unit: "lx", DeviceClasses: []string{"illuminance"}, Units: []string{"lx"},
+		Codes: []string{"illuminance_value", "illuminance", "lux"}},
+	{Name: "motion", DeviceClasses: []string{"motion", "occupancy", "presence"},
+		Codes: []string{"pir", "pir_state", "presence_state", "motion"}},
+	{Name: "contact", DeviceClasses: []string{"door", "window", "opening", "garage_door"},
+		Codes: []string{"doorcontact_state", "contact_state"}},
+	{Name: "leak", DeviceClasses: []string{"moisture"},
+		Codes: []string{"watersensor_state", "water_leak"}},
+	{Name: "smoke", DeviceClasses: []string{"smoke"},
+		Codes: []string{"smoke_sensor_status", "smoke_sensor_state", "smoke_sensor_value"}},
+}
+
+// Registry holds the built-in kinds plus those defined in config.
+type Registry struct {
+	kinds []Kind
+}
+
+// NewRegistry adds custom kinds to the built-ins. A custom kind named like
+// a built-in replaces it.
+func NewRegistry(custom map[string]config.SensorKind) *Registry {
+	r := &Registry{kinds: append([]Kind(nil), Builtin...)}
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := custom[name]
+		k := Kind{
+			Name:          strings.ToLower(strings.TrimSpace(name)),
+			Unit:          c.Unit,
+			DeviceClasses: c.DeviceClasses,
+			Units:         c.Units,
+			Codes:         c.Codes,
+			Categories:    c.Categories,
+		}
+		if i := r.index(k.Name); i >= 0 {
+			r.kinds[i] = k
+		} else {
+			r.kinds = append(r.kinds, k)
+		}
+	}
+	return r
+}
+
+func (r *Registry) index(name string) int {
+	for i, k := range r.kinds {
+		if k.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Kinds returns every registered kind.
+func (r *Registry) Kinds() []Kind {
+	return append([]Kind(nil), r.kinds...)
+}
+
+// Lookup finds a kind by name.
+func (r *Registry) Lookup(name string) (Kind, bool) {
+	if i := r.index(strings.ToLower(strings.TrimSpace(name))); i >= 0 {
+		return r.kinds[i], true
+	}
+	return Kind{}, false
+}
+
+// Select resolves --kind values. Each value may hold several comma-separated
+// names; "all" selects every kind. Unregistered names still work the way
+// poll always treated them: they match an HA device class of that name or
+// DP codes containing it.
+func (r *Registry) Select(values []string) ([]Kind, error) {
+	var out []Kind
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch {
+			case name == "":
+				continue
+			case name == All:
+				for _, k := range r.kinds {
+					if !seen[k.Name] {
+						seen[k.Name] = true
+						out = append(out, k)
+					}
+				}
+				continue
+			case seen[name]:
+				continue
+			}
+			k, ok := r.Lookup(name)
+			if !ok {
+				if strings.ContainsAny(name, "*?[") {
+					return nil, fmt.Errorf("invalid kind %q", name)
+				}
+				k = Kind{Name: name, DeviceClasses: []string{name}, Codes: []string{"*" + name + "*"}}
+			}
+			seen[name] = true
+			out = append(out, k)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no kind selected")
+	}
+	return out, nil
+}
+
+// Check reports what is wrong with a configured kind.
+func Check(c config.SensorKind) error {
+	if len(c.DeviceClasses) == 0 && len(c.Units) == 0 && len(c.Codes) == 0 {
+		return fmt.Errorf("needs deviceClasses, units or codes")
+	}
+	for _, code := range c.Codes {
+		if _, err := path.Match(code, ""); err != nil {
+			return fmt.Errorf("codes: invalid pattern %q", code)
+		}
+	}
+	return nil
+}
+
+// MatchEntity reports whether an HA entity with the given device_class and
+// unit_of_measurement is of this kind. A device_class decides on its own;
+// the unit is consulted only when there is none.
+func (k Kind) MatchEntity(deviceClass, unit string) bool {
+	if deviceClass != "" {
+		return containsFold(k.DeviceClasses, deviceClass)
+	}
+	return unit != "" && containsFold(k.Units, unit)
+}
+
+// MatchCode reports whether DP code on a device of category is of this kind.
+func (k Kind) MatchCode(category, code string) bool {
+	if len(k.Categories) > 0 && !containsFold(k.Categories, category) {
+		return false
+	}
+	code = strings.ToLower(code)
+	for _, pattern := range k.Codes {
+		if ok, _ := path.Match(strings.ToLower(pattern), code); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchStatus reports whether a DP reading is of this kind: its code
+// matches and, for kinds measured in a unit, its value is a number. Bare
+// codes such as power are a switch on some products.
+func (k Kind) MatchStatus(category, code string, value any) bool {
+	if !k.MatchCode(category, code) {
+		return false
+	}
+	if k.Unit == "" {
+		return true
+	}
+	switch value.(type) {
+	case float64, float32, int, int64:
+		return true
+	}
+	return false
+}
+
+// EntityKind returns the first of kinds matching an HA entity.
+func EntityKind(kinds []Kind, deviceClass, unit string) (Kind, bool) {
+	for _, k := range kinds {
+		if k.MatchEntity(deviceClass, unit) {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// CodeKind returns the first of kinds matching a Tuya DP reading.
+func CodeKind(kinds []Kind, category, code string, value any) (Kind, bool) {
+	for _, k := range kinds {
+		if k.MatchStatus(category, code, value) {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package sensor
+
+import (
+	"testing"
+
+	"tuya-hub/internal/config"
+)
+
+func TestBatteryIsNotHumidity(t *testing.T) {
+	r := NewRegistry(nil)
+	humidity, _ := r.Lookup("humidity")
+	battery, _ := r.Lookup("battery")
+	if humidity.MatchEntity("battery", "%") {
+		t.Fatalf("battery entity matched humidity")
+	}
+	if !battery.MatchEntity("battery", "%") {
+		t.Fatalf("battery entity did not match battery")
+	}
+	if humidity.MatchCode("wsdcg", "battery_percentage") || !battery.MatchCode("wsdcg", "battery_percentage") {
+		t.Fatalf("battery_percentage misclassified")
+	}
+	temperature, _ := r.Lookup("temperature")
+	if temperature.MatchCode("dj", "temp_value") {
+		t.Fatalf("light colour temperature matched temperature")
+	}
+	if !temperature.MatchEntity("", "°F") {
+		t.Fatalf("expected unit fallback for temperature")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	r := NewRegistry(nil)
+	kinds, err := r.Select([]string{"temperature,humidity", "temperature", "Battery"})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(kinds) != 3 || kinds[0].Name != "temperature" || kinds[2].Name != "battery" {
+		t.Fatalf("unexpected kinds: %+v", kinds)
+	}
+
+	all, err := r.Select([]string{"all"})
+	if err != nil || len(all) != len(Builtin) {
+		t.Fatalf("expected all %d kinds, got %d (%v)", len(Builtin), len(all), err)
+	}
+
+	adhoc, err := r.Select([]string{"pressure"})
+	if err != nil || !adhoc[0].MatchEntity("pressure", "hPa") || !adhoc[0].MatchCode("", "va_pressure") {
+		t.Fatalf("expected ad-hoc pressure kind, got %+v (%v)", adhoc, err)
+	}
+	if _, err := r.Select([]string{" , "}); err == nil {
+		t.Fatalf("expected error for empty selection")
+	}
+}
+
+func TestCustomKinds(t *testing.T) {
+	r := NewRegistry(map[string]config.SensorKind{
+		"soil":     {Unit: "%", DeviceClasses: []string{"moisture"}, Codes: []string{"humidity_*"}, Categories: []string{"zwjcy"}},
+		"humidity": {Unit: "%", Codes: []string{"va_humidity"}},
+	})
+	soil, ok := r.Lookup("soil")
+	if !ok || !soil.MatchCode("zwjcy", "humidity_value") || soil.MatchCode("wsdcg", "humidity_value") {
+		t.Fatalf("custom kind did not respect categories: %+v", soil)
+	}
+	humidity, _ := r.Lookup("humidity")
+	if humidity.MatchCode("", "humidity_value") {
+		t.Fatalf("expected custom humidity to replace the built-in")
+	}
+	if len(r.Kinds()) != len(Builtin)+1 {
+		t.Fatalf("expected one added kind, got %d", len(r.Kinds()))
+	}
+}
+
+func TestUnitKindsNeedNumbers(t *testing.T) {
+	r := NewRegistry(nil)
+	power, _ := r.Lookup("power")
+	if power.MatchStatus("kg", "power", true) {
+		t.Fatalf("switch DP named power matched the power kind")
+	}
+	if !power.MatchStatus("cz", "power", float64(125)) {
+		t.Fatalf("numeric power reading did not match")
+	}
+	if k, ok := CodeKind(r.Kinds(), "wsdcg", "battery_state", "low"); !ok || k.Name != "battery_state" {
+		t.Fatalf("expected battery_state kind, got %+v (%v)", k, ok)
+	}
+	motion, _ := r.Lookup("motion")
+	if !motion.MatchStatus("pir", "pir", "pir") {
+		t.Fatalf("kinds without a unit should take any value")
+	}
+}
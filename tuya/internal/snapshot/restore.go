@@ -0,0 +1,125 @@
+package snapshot
+
+import (
+	"sort"
+	"strings"
+
+	"tuya-hub/internal/ha"
+	"tuya-hub/internal/plan"
+)
+
+// Commands returns the DP commands that bring a cloud device from current
+// back to saved: every saved DP whose value differs. Switch DPs go first so
+// a light is on before its colour is set.
+func Commands(current, saved Device) []plan.Command {
+	var out []plan.Command
+	for code, v := range saved.DPs {
+		if cur, ok := current.DPs[code]; ok && equal(cur, v) {
+			continue
+		}
+		out = append(out, plan.Command{Code: code, Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		si, sj := strings.HasPrefix(out[i].Code, "switch"), strings.HasPrefix(out[j].Code, "switch")
+		if si != sj {
+			return si
+		}
+		return out[i].Code < out[j].Code
+	})
+	return out
+}
+
+// Call is one Home Assistant service call; Service is domain.service.
+type Call struct {
+	Service string         `json:"service"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// HACalls returns the service calls that bring an entity from current back
+// to saved, or none when nothing differs. Unavailable or unknown saved
+// states are not restored.
+func HACalls(current, saved Device) []Call {
+	if saved.State == "" || saved.State == "unavailable" || saved.State == "unknown" {
+		return nil
+	}
+	domain := ha.DomainFromEntity(saved.ID)
+	stateDiffers := current.State != saved.State
+	attrDiffers := func(key string) bool {
+		v, ok := saved.Attributes[key]
+		return ok && !equal(current.Attributes[key], v)
+	}
+	switch domain {
+	case "switch", "input_boolean":
+		if stateDiffers && (saved.State == "on" || saved.State == "off") {
+			return []Call{{Service: domain + ".turn_" + saved.State}}
+		}
+	case "light", "fan":
+		if saved.State == "off" {
+			if stateDiffers {
+				return []Call{{Service: domain + ".turn_off"}}
+			}
+			return nil
+		}
+		if saved.State != "on" {
+			return nil
+		}
+		data := map[string]any{}
+		changed := stateDiffers
+		keys := []string{"percentage", "preset_mode"}
+		if domain == "light" {
+			keys = []string{"brightness", lightColorKey(saved.Attributes), "effect"}
+		}
+		for _, key := range keys {
+			if v, ok := saved.Attributes[key]; ok && key != "" && v != "none" {
+				data[key] = v
+				changed = changed || attrDiffers(key)
+			}
+		}
+		var calls []Call
+		if changed {
+			calls = append(calls, Call{Service: domain + ".turn_on", Data: data})
+		}
+		if domain == "fan" && attrDiffers("oscillating") {
+			calls = append(calls, Call{Service: "fan.oscillate", Data: map[string]any{"oscillating": saved.Attributes["oscillating"]}})
+		}
+		return calls
+	case "climate":
+		var calls []Call
+		if stateDiffers {
+			calls = append(calls, Call{Service: "climate.set_hvac_mode", Data: map[string]any{"hvac_mode": saved.State}})
+		}
+		if saved.State != "off" && attrDiffers("temperature") {
+			calls = append(calls, Call{Service: "climate.set_temperature", Data: map[string]any{"temperature": saved.Attributes["temperature"]}})
+		}
+		if saved.State != "off" && attrDiffers("preset_mode") {
+			calls = append(calls, Call{Service: "climate.set_preset_mode", Data: map[string]any{"preset_mode": saved.Attributes["preset_mode"]}})
+		}
+		return calls
+	case "cover":
+		if pos, ok := saved.Attributes["current_position"]; ok {
+			if attrDiffers("current_position") {
+				return []Call{{Service: "cover.set_cover_position", Data: map[string]any{"position": pos}}}
+			}
+			return nil
+		}
+		if stateDiffers && saved.State == "open" {
+			return []Call{{Service: "cover.open_cover"}}
+		}
+		if stateDiffers && saved.State == "closed" {
+			return []Call{{Service: "cover.close_cover"}}
+		}
+	}
+	return nil
+}
+
+// lightColorKey picks the attribute that sets a light's colour back in its
+// saved colour mode.
+func lightColorKey(attrs map[string]any) string {
+	switch mode, _ := attrs["color_mode"].(string); mode {
+	case "color_temp":
+		return "color_temp_kelvin"
+	case "hs", "rgb", "rgbw", "rgbww", "xy":
+		return "hs_color"
+	}
+	return ""
+}
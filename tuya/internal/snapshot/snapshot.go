@@ -0,0 +1,280 @@
+// Package snapshot captures the settable state of devices (Tuya DP values
+// or Home Assistant entity states) so it can be compared later or put
+// back, e.g. "party mode, then restore everything".
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/config"
+	"tuya-hub/internal/countdown"
+	"tuya-hub/internal/ha"
+)
+
+// Snapshot is the saved state of a set of devices on one backend.
+type Snapshot struct {
+	Name    string    `json:"name"`
+	Backend string    `json:"backend"`
+	Profile string    `json:"profile,omitempty"`
+	Taken   time.Time `json:"taken"`
+	Devices []Device  `json:"devices"`
+}
+
+// Device is one device or entity. Cloud devices carry their writable DP
+// values; Home Assistant entities their state and the attributes a restore
+// can set.
+type Device struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name,omitempty"`
+	DPs        map[string]any `json:"dps,omitempty"`
+	State      string         `json:"state,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Find returns the device with id.
+func (s *Snapshot) Find(id string) (Device, bool) {
+	for _, d := range s.Devices {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Writable returns the status values whose codes are also spec functions,
+// i.e. the DPs a command can set back. Countdown timers are left out:
+// restoring one would restart it.
+func Writable(statuses []cloud.Status, spec *cloud.Spec) map[string]any {
+	out := map[string]any{}
+	for _, st := range statuses {
+		if _, ok := countdown.Channel(st.Code); ok {
+			continue
+		}
+		if _, ok := spec.Function(st.Code); ok {
+			out[st.Code] = st.Value
+		}
+	}
+	return out
+}
+
+// Domains are the Home Assistant domains a snapshot captures, with the
+// attributes restore can set for each.
+var Domains = map[string][]string{
+	"switch":        nil,
+	"input_boolean": nil,
+	"light":         {"brightness", "color_mode", "color_temp_kelvin", "hs_color", "effect"},
+	"fan":           {"percentage", "preset_mode", "oscillating"},
+	"climate":       {"temperature", "preset_mode"},
+	"cover":         {"current_position"},
+}
+
+// FromHA captures an entity, or reports false for domains restore cannot
+// drive.
+func FromHA(st ha.State) (Device, bool) {
+	attrs, ok := Domains[ha.DomainFromEntity(st.EntityID)]
+	if !ok {
+		return Device{}, false
+	}
+	name, _ := st.Attributes["friendly_name"].(string)
+	d := Device{ID: st.EntityID, Name: name, State: st.State}
+	for _, key := range attrs {
+		if v, ok := st.Attributes[key]; ok && v != nil {
+			if d.Attributes == nil {
+				d.Attributes = map[string]any{}
+			}
+			d.Attributes[key] = v
+		}
+	}
+	return d, true
+}
+
+// Dir is where named snapshots are kept.
+func Dir() (string, error) {
+	dir, err := config.DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snapshots"), nil
+}
+
+// Path maps a snapshot name to its file. Anything that looks like a path
+// (a separator or a .json suffix) is used as is.
+func Path(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("snapshot name required")
+	}
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Save writes s to path, creating the directory.
+func Save(path string, s *Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// Load reads a snapshot file.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// List returns the saved snapshots in dir, newest first. A missing
+// directory is an empty list.
+func List(dir string) ([]*Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []*Snapshot
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		s, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Taken.After(out[j].Taken) })
+	return out, nil
+}
+
+// Change kinds.
+const (
+	Changed = "changed"
+	Added   = "added"
+	Removed = "removed"
+)
+
+// Change is one difference between two snapshots. Key is a DP code,
+// "state", or an attribute name.
+type Change struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Key    string `json:"key"`
+	Change string `json:"change"`
+	From   any    `json:"from,omitempty"`
+	To     any    `json:"to,omitempty"`
+}
+
+// Diff lists what changed from a to b, by device and key. Devices only in
+// one snapshot show as a single added or removed change with key "*".
+func Diff(a, b *Snapshot) []Change {
+	ids := map[string]bool{}
+	for _, d := range a.Devices {
+		ids[d.ID] = true
+	}
+	for _, d := range b.Devices {
+		ids[d.ID] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	var out []Change
+	for _, id := range sorted {
+		from, inA := a.Find(id)
+		to, inB := b.Find(id)
+		switch {
+		case !inA:
+			out = append(out, Change{ID: id, Name: to.Name, Key: "*", Change: Added})
+			continue
+		case !inB:
+			out = append(out, Change{ID: id, Name: from.Name, Key: "*", Change: Removed})
+			continue
+		}
+		name := to.Name
+		if name == "" {
+			name = from.Name
+		}
+		out = append(out, diffValues(id, name, values(from), values(to))...)
+	}
+	return out
+}
+
+// values flattens a device into key → value.
+func values(d Device) map[string]any {
+	out := map[string]any{}
+	for k, v := range d.DPs {
+		out[k] = v
+	}
+	if d.State != "" {
+		out["state"] = d.State
+	}
+	for k, v := range d.Attributes {
+		out[k] = v
+	}
+	return out
+}
+
+func diffValues(id, name string, a, b map[string]any) []Change {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var out []Change
+	for _, k := range sorted {
+		from, inA := a[k]
+		to, inB := b[k]
+		switch {
+		case !inA:
+			out = append(out, Change{ID: id, Name: name, Key: k, Change: Added, To: to})
+		case !inB:
+			out = append(out, Change{ID: id, Name: name, Key: k, Change: Removed, From: from})
+		case !equal(from, to):
+			out = append(out, Change{ID: id, Name: name, Key: k, Change: Changed, From: from, To: to})
+		}
+	}
+	return out
+}
+
+// equal compares values by their JSON form, so a value read back from a
+// file equals the one decoded from the API.
+func equal(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
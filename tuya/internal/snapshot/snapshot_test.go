@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tuya-hub/internal/cloud"
+	"tuya-hub/internal/ha"
+)
+
+func TestWritable(t *testing.T) {
+	spec := &cloud.Spec{Functions: []cloud.SpecItem{{Code: "switch_1"}, {Code: "countdown_1"}, {Code: "bright_value"}}}
+	statuses := []cloud.Status{
+		{Code: "switch_1", Value: true},
+		{Code: "countdown_1", Value: float64(300)},
+		{Code: "cur_power", Value: float64(120)},
+	}
+	got := Writable(statuses, spec)
+	if !reflect.DeepEqual(got, map[string]any{"switch_1": true}) {
+		t.Fatalf("unexpected writable DPs %v", got)
+	}
+}
+
+func TestFromHA(t *testing.T) {
+	d, ok := FromHA(ha.State{EntityID: "light.desk", State: "on", Attributes: map[string]any{
+		"friendly_name": "Desk", "brightness": float64(120), "color_mode": "hs", "hs_color": []any{float64(300), float64(100)}, "min_mireds": float64(153),
+	}})
+	if !ok || d.Name != "Desk" || d.State != "on" || len(d.Attributes) != 3 {
+		t.Fatalf("unexpected device %+v", d)
+	}
+	if _, ok := FromHA(ha.State{EntityID: "sensor.temp", State: "21"}); ok {
+		t.Fatalf("sensors cannot be restored")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := &Snapshot{Devices: []Device{
+		{ID: "lamp1", Name: "Desk", DPs: map[string]any{"switch_led": true, "bright_value": float64(500)}},
+		{ID: "plug1", DPs: map[string]any{"switch_1": true}},
+	}}
+	b := &Snapshot{Devices: []Device{
+		{ID: "lamp1", Name: "Desk", DPs: map[string]any{"switch_led": true, "bright_value": float64(10), "work_mode": "colour"}},
+		{ID: "plug2", DPs: map[string]any{"switch_1": false}},
+	}}
+	want := []Change{
+		{ID: "lamp1", Name: "Desk", Key: "bright_value", Change: Changed, From: float64(500), To: float64(10)},
+		{ID: "lamp1", Name: "Desk", Key: "work_mode", Change: Added, To: "colour"},
+		{ID: "plug1", Key: "*", Change: Removed},
+		{ID: "plug2", Key: "*", Change: Added},
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	current := Device{DPs: map[string]any{"switch_led": false, "bright_value": float64(500), "work_mode": "white"}}
+	saved := Device{DPs: map[string]any{"switch_led": true, "bright_value": float64(500), "work_mode": "colour"}}
+	got := Commands(current, saved)
+	if len(got) != 2 || got[0].Code != "switch_led" || got[1].Code != "work_mode" || got[1].Value != "colour" {
+		t.Fatalf("unexpected commands %+v", got)
+	}
+	if got := Commands(saved, saved); len(got) != 0 {
+		t.Fatalf("expected no commands for an unchanged device, got %+v", got)
+	}
+}
+
+func TestHACalls(t *testing.T) {
+	cases := []struct {
+		name           string
+		current, saved Device
+		want           []Call
+	}{
+		{"switch off", Device{ID: "switch.fan", State: "on"}, Device{ID: "switch.fan", State: "off"},
+			[]Call{{Service: "switch.turn_off"}}},
+		{"unchanged", Device{ID: "switch.fan", State: "on"}, Device{ID: "switch.fan", State: "on"}, nil},
+		{"unavailable", Device{ID: "switch.fan", State: "on"}, Device{ID: "switch.fan", State: "unavailable"}, nil},
+		{"light colour",
+			Device{ID: "light.desk", State: "on", Attributes: map[string]any{"brightness": float64(255), "color_mode": "color_temp", "color_temp_kelvin": float64(2700)}},
+			Device{ID: "light.desk", State: "on", Attributes: map[string]any{"brightness": float64(120), "color_mode": "hs", "hs_color": []any{float64(300), float64(100)}, "effect": "none"}},
+			[]Call{{Service: "light.turn_on", Data: map[string]any{"brightness": float64(120), "hs_color": []any{float64(300), float64(100)}}}}},
+		{"climate",
+			Device{ID: "climate.hall", State: "off", Attributes: map[string]any{"temperature": float64(18)}},
+			Device{ID: "climate.hall", State: "heat", Attributes: map[string]any{"temperature": float64(21.5)}},
+			[]Call{
+				{Service: "climate.set_hvac_mode", Data: map[string]any{"hvac_mode": "heat"}},
+				{Service: "climate.set_temperature", Data: map[string]any{"temperature": float64(21.5)}},
+			}},
+		{"cover", Device{ID: "cover.blind", State: "open", Attributes: map[string]any{"current_position": float64(100)}},
+			Device{ID: "cover.blind", State: "open", Attributes: map[string]any{"current_position": float64(40)}},
+			[]Call{{Service: "cover.set_cover_position", Data: map[string]any{"position": float64(40)}}}},
+	}
+	for _, c := range cases {
+		if got := HACalls(c.current, c.saved); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%s: expected %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestSaveLoadList(t *testing.T) {
+	dir := t.TempDir()
+	older := &Snapshot{Name: "before", Backend: "cloud", Taken: time.Now().Add(-time.Hour).UTC(), Devices: []Device{{ID: "plug1", DPs: map[string]any{"switch_1": true}}}}
+	newer := &Snapshot{Name: "after", Backend: "cloud", Taken: time.Now().UTC()}
+	for _, s := range []*Snapshot{older, newer} {
+		if err := Save(filepath.Join(dir, s.Name+".json"), s); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	got, err := Load(filepath.Join(dir, "before.json"))
+	if err != nil || len(Diff(got, older)) != 0 {
+		t.Fatalf("round trip: %v %+v", err, got)
+	}
+	list, err := List(dir)
+	if err != nil || len(list) != 2 || list[0].Name != "after" {
+		t.Fatalf("unexpected list %+v (%v)", list, err)
+	}
+	if p, _ := Path("./party.json"); p != "./party.json" {
+		t.Fatalf("expected a path to be used as is, got %s", p)
+	}
+}
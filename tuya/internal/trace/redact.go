@@ -0,0 +1,103 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secret values in traces and dry-run output.
+const Redacted = "[REDACTED]"
+
+var sensitiveHeaders = map[string]bool{
+	"access_token":  true,
+	"sign":          true,
+	"client_id":     true,
+	"authorization": true,
+}
+
+// sensitiveKeys are JSON keys and query parameters whose values are hidden.
+var sensitiveKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"sign":          true,
+	"client_id":     true,
+	"local_key":     true,
+	"localkey":      true,
+	"password":      true,
+	"secret":        true,
+}
+
+func sensitiveHeader(name string) bool {
+	return sensitiveHeaders[strings.ToLower(name)]
+}
+
+func sensitiveKey(name string) bool {
+	return sensitiveKeys[strings.ToLower(name)]
+}
+
+// RedactURL hides sensitive query parameters.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.RawQuery == "" {
+		return raw
+	}
+	q := u.Query()
+	changed := false
+	for key := range q {
+		if sensitiveKey(key) {
+			q.Set(key, Redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// RedactJSON hides sensitive keys at any depth. Bodies that are not JSON are
+// returned unchanged.
+func RedactJSON(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	var v any
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+	if !redactValue(v) {
+		return data
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func redactValue(v any) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]any:
+		for k, inner := range t {
+			if sensitiveKey(k) {
+				t[k] = Redacted
+				changed = true
+				continue
+			}
+			if redactValue(inner) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, inner := range t {
+			if redactValue(inner) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,132 @@
+// Package trace wraps HTTP transports with request logging and a dry-run
+// mode. Credentials are redacted from everything it prints.
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrDryRun is returned in place of a response when a dry run stops a
+// request that would change something.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// maxLoggedBody caps how much of a response body is logged.
+const maxLoggedBody = 4096
+
+// Transport logs requests and responses to Logger (when set) and, with
+// DryRun, prints write requests to Out instead of sending them. Reads (GET
+// and HEAD) still go out so tokens and lookups work during a dry run.
+type Transport struct {
+	Base   http.RoundTripper
+	Logger *slog.Logger
+	DryRun bool
+	Out    io.Writer
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.DryRun && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		fmt.Fprint(t.Out, FormatRequest(req, body))
+		return nil, ErrDryRun
+	}
+
+	if t.Logger != nil {
+		t.Logger.Debug("http request",
+			"method", req.Method,
+			"url", RedactURL(req.URL.String()),
+			"headers", formatHeaders(req.Header),
+			"body", string(RedactJSON(body)))
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	started := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(started)
+	if t.Logger == nil {
+		return resp, err
+	}
+	if err != nil {
+		t.Logger.Debug("http error", "method", req.Method, "url", RedactURL(req.URL.String()), "duration", elapsed, "error", err)
+		return resp, err
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	logged := RedactJSON(respBody)
+	if len(logged) > maxLoggedBody {
+		logged = append(logged[:maxLoggedBody:maxLoggedBody], "..."...)
+	}
+	t.Logger.Debug("http response",
+		"method", req.Method,
+		"url", RedactURL(req.URL.String()),
+		"status", resp.StatusCode,
+		"duration", elapsed,
+		"body", string(logged))
+	if readErr != nil {
+		return nil, readErr
+	}
+	return resp, nil
+}
+
+// readBody drains the request body and replaces it so it can still be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// FormatRequest renders a request in HTTP/1.1 style with credentials
+// redacted.
+func FormatRequest(req *http.Request, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, RedactURL(req.URL.String()))
+	for _, line := range formatHeaders(req.Header) {
+		b.WriteString(line + "\n")
+	}
+	if len(body) > 0 {
+		b.WriteString("\n")
+		b.Write(RedactJSON(body))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func formatHeaders(h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		if sensitiveHeader(name) {
+			value = Redacted
+		}
+		lines = append(lines, name+": "+value)
+	}
+	return lines
+}
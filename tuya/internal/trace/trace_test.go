@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	got := string(RedactJSON([]byte(`{"result":{"access_token":"abc","devices":[{"id":"d1","local_key":"k"}]},"success":true}`)))
+	if strings.Contains(got, "abc") || strings.Contains(got, `"k"`) || !strings.Contains(got, `"d1"`) {
+		t.Fatalf("unexpected redaction: %s", got)
+	}
+	if got := RedactURL("https://x/v1.0/token?grant_type=1&access_token=abc"); strings.Contains(got, "abc") || !strings.Contains(got, "grant_type=1") {
+		t.Fatalf("unexpected url: %s", got)
+	}
+	if got := string(RedactJSON([]byte("plain text"))); got != "plain text" {
+		t.Fatalf("non-JSON body changed: %s", got)
+	}
+}
+
+func TestDryRunBlocksWrites(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	var out, logs bytes.Buffer
+	client := &http.Client{Transport: &Transport{
+		DryRun: true,
+		Out:    &out,
+		Logger: slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/read", nil)
+	req.Header.Set("sign", "SECRET")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/write", strings.NewReader(`{"value":true}`))
+	req.Header.Set("Authorization", "Bearer SECRET")
+	if _, err := client.Do(req); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("expected dry run error, got %v", err)
+	}
+	if hits != 1 {
+		t.Fatalf("expected only the read to reach the server, got %d hits", hits)
+	}
+	if !strings.Contains(out.String(), "POST "+srv.URL+"/write") || !strings.Contains(out.String(), `{"value":true}`) {
+		t.Fatalf("unexpected dry run output: %s", out.String())
+	}
+	if strings.Contains(out.String()+logs.String(), "SECRET") {
+		t.Fatalf("secret leaked:\n%s\n%s", out.String(), logs.String())
+	}
+	if !strings.Contains(logs.String(), "http response") {
+		t.Fatalf("expected response log, got %s", logs.String())
+	}
+}
@@ -0,0 +1,152 @@
+// Package units normalizes unit spellings and converts readings between
+// units of the same dimension, so poll can report every sensor in the
+// user's preferred system.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Measurement systems accepted by --units and units.system.
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// unit is a linear conversion to the base unit of its dimension:
+// base = value*factor + offset.
+type unit struct {
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+var table = map[string]unit{
+	"°C": {dimension: "temperature", factor: 1},
+	"°F": {dimension: "temperature", factor: 5.0 / 9, offset: -32 * 5.0 / 9},
+	"K":  {dimension: "temperature", factor: 1, offset: -273.15},
+
+	"mW": {dimension: "power", factor: 0.001},
+	"W":  {dimension: "power", factor: 1},
+	"kW": {dimension: "power", factor: 1000},
+
+	"Wh":  {dimension: "energy", factor: 1},
+	"kWh": {dimension: "energy", factor: 1000},
+	"MWh": {dimension: "energy", factor: 1e6},
+
+	"mV": {dimension: "voltage", factor: 0.001},
+	"V":  {dimension: "voltage", factor: 1},
+
+	"mA": {dimension: "current", factor: 0.001},
+	"A":  {dimension: "current", factor: 1},
+
+	"ppm": {dimension: "concentration", factor: 1},
+	"ppb": {dimension: "concentration", factor: 0.001},
+}
+
+// aliases maps lower-cased spellings used by Tuya specs and HA to the
+// symbols in table.
+var aliases = map[string]string{
+	"°c": "°C", "℃": "°C", "c": "°C", "celsius": "°C",
+	"°f": "°F", "℉": "°F", "f": "°F", "fahrenheit": "°F",
+	"k": "K", "kelvin": "K",
+	"mw": "mW", "w": "W", "kw": "kW",
+	"wh": "Wh", "kwh": "kWh", "kw·h": "kWh", "kw.h": "kWh", "mwh": "MWh",
+	"mv": "mV", "v": "V",
+	"ma": "mA", "a": "A",
+	"ppm": "ppm", "ppb": "ppb",
+	"lux": "lx", "lx": "lx",
+	"%":     "%",
+	"ug/m3": "µg/m³", "μg/m³": "µg/m³", "µg/m³": "µg/m³", "µg/m3": "µg/m³",
+}
+
+// Normalize returns the canonical symbol for a unit spelling such as "℃",
+// "kwh" or "w". Unknown units are returned trimmed but otherwise unchanged.
+func Normalize(u string) string {
+	u = strings.TrimSpace(u)
+	if canonical, ok := aliases[strings.ToLower(u)]; ok {
+		return canonical
+	}
+	return u
+}
+
+// Known reports whether u is a unit Convert understands.
+func Known(u string) bool {
+	_, ok := table[Normalize(u)]
+	return ok
+}
+
+// Convertible reports whether a value in from can be expressed in to.
+func Convertible(from, to string) bool {
+	a, okA := table[Normalize(from)]
+	b, okB := table[Normalize(to)]
+	return okA && okB && a.dimension == b.dimension
+}
+
+// Convert expresses v (in from) in to. The result is rounded to 4 decimal
+// places to hide floating point noise.
+func Convert(v float64, from, to string) (float64, error) {
+	from, to = Normalize(from), Normalize(to)
+	if from == to {
+		return v, nil
+	}
+	if !Convertible(from, to) {
+		return v, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	a, b := table[from], table[to]
+	base := v*a.factor + a.offset
+	return Round((base-b.offset)/b.factor, 4), nil
+}
+
+// Round rounds v to places decimal places.
+func Round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+// Prefs chooses display units: the system (metric by default) plus
+// per-kind overrides such as {"temperature": "°C", "power": "kW"}.
+type Prefs struct {
+	System string
+	Kinds  map[string]string
+}
+
+// ParseSystem validates a --units value.
+func ParseSystem(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", Metric:
+		return Metric, nil
+	case Imperial:
+		return Imperial, nil
+	}
+	return "", fmt.Errorf("unknown unit system %q (want metric or imperial)", s)
+}
+
+// Target is the unit readings of kind are shown in. canonical is the kind's
+// metric unit; an empty result means "leave the reading's own unit".
+func (p Prefs) Target(kind, canonical string) string {
+	if u, ok := p.Kinds[kind]; ok && strings.TrimSpace(u) != "" {
+		return Normalize(u)
+	}
+	if p.System == Imperial && canonical == "°C" {
+		return "°F"
+	}
+	return canonical
+}
+
+// Apply converts v from unit to the preferred unit for kind. When no
+// conversion applies the value and unit come back unchanged.
+func (p Prefs) Apply(kind, canonical string, v float64, unit string) (float64, string) {
+	unit = Normalize(unit)
+	target := p.Target(kind, canonical)
+	if target == "" || unit == "" || !Convertible(unit, target) {
+		return v, unit
+	}
+	out, err := Convert(v, unit, target)
+	if err != nil {
+		return v, unit
+	}
+	return out, target
+}
@@ -0,0 +1,59 @@
+package units
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{"℃": "°C", " c ": "°C", "℉": "°F", "kwh": "kWh", "w": "W", "ma": "mA", "ug/m3": "µg/m³", "rpm": "rpm"}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Fatalf("Normalize(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		v        float64
+		from, to string
+		want     float64
+	}{
+		{22.5, "°C", "°F", 72.5},
+		{72.5, "℉", "℃", 22.5},
+		{1500, "W", "kW", 1.5},
+		{1234, "Wh", "kWh", 1.234},
+		{230500, "mV", "V", 230.5},
+		{21.3, "°C", "°C", 21.3},
+	}
+	for _, c := range cases {
+		got, err := Convert(c.v, c.from, c.to)
+		if err != nil || got != c.want {
+			t.Fatalf("Convert(%v %s → %s): expected %v, got %v (%v)", c.v, c.from, c.to, c.want, got, err)
+		}
+	}
+	if _, err := Convert(1, "W", "V"); err == nil {
+		t.Fatalf("expected error converting power to voltage")
+	}
+}
+
+func TestPrefs(t *testing.T) {
+	imperial := Prefs{System: Imperial}
+	if v, u := imperial.Apply("temperature", "°C", 20, "C"); v != 68 || u != "°F" {
+		t.Fatalf("expected 68 °F, got %v %s", v, u)
+	}
+	if v, u := imperial.Apply("power", "W", 1.2, "kW"); v != 1200 || u != "W" {
+		t.Fatalf("expected 1200 W, got %v %s", v, u)
+	}
+	override := Prefs{System: Imperial, Kinds: map[string]string{"temperature": "℃", "power": "kW"}}
+	if v, u := override.Apply("temperature", "°C", 68, "°F"); v != 20 || u != "°C" {
+		t.Fatalf("expected 20 °C, got %v %s", v, u)
+	}
+	if v, u := override.Apply("power", "W", 250, "W"); v != 0.25 || u != "kW" {
+		t.Fatalf("expected 0.25 kW, got %v %s", v, u)
+	}
+	if v, u := (Prefs{}).Apply("humidity", "%", 40, "%"); v != 40 || u != "%" {
+		t.Fatalf("expected humidity untouched, got %v %s", v, u)
+	}
+	if _, err := ParseSystem("kelvin"); err == nil {
+		t.Fatalf("expected unknown system error")
+	}
+}
@@ -0,0 +1,101 @@
+// Package verify checks that a device really reached the state a command
+// asked for. Tuya and Home Assistant both accept commands for devices that
+// are offline or ignore them, so success from the API only means "queued".
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"tuya-hub/internal/util"
+)
+
+// DefaultTimeout is how long --wait waits when no timeout is given.
+const DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned by Wait when the state never matched.
+var ErrTimeout = errors.New("timed out waiting for the requested state")
+
+// Fetch reads the current value. ok is false when the device does not
+// report it (yet).
+type Fetch func() (value any, ok bool, err error)
+
+// Match reports whether an observed value equals the requested one,
+// treating numbers by value, strings case-insensitively and JSON objects
+// (sent as strings or maps) by content.
+func Match(want, got any) bool {
+	if a, ok := util.Number(want); ok {
+		b, ok := util.Number(got)
+		return ok && math.Abs(a-b) < 1e-9
+	}
+	if a, ok := want.(bool); ok {
+		b, ok := got.(bool)
+		return ok && a == b
+	}
+	if a, ok := want.(string); ok {
+		if b, ok := got.(string); ok && strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+			return true
+		}
+	}
+	return canonical(want) == canonical(got)
+}
+
+// Wait polls fetch every interval until the value matches want or ctx
+// ends. It returns the last observed value (nil if none was reported); on
+// timeout the error wraps ErrTimeout.
+func Wait(ctx context.Context, interval time.Duration, fetch Fetch, want any) (any, error) {
+	var last any
+	seen := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		got, ok, err := fetch()
+		if err != nil {
+			return last, err
+		}
+		if ok {
+			last, seen = got, true
+			if Match(want, got) {
+				return got, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if seen {
+				return last, fmt.Errorf("%w: want %s, device reports %s", ErrTimeout, Format(want), Format(last))
+			}
+			return nil, fmt.Errorf("%w: want %s, device reports nothing", ErrTimeout, Format(want))
+		case <-ticker.C:
+		}
+	}
+}
+
+// Format renders a value the way the CLI accepts it.
+func Format(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// canonical re-encodes a value, parsing JSON strings first, so maps and
+// their string forms compare equal regardless of key order or spacing.
+func canonical(v any) string {
+	if s, ok := v.(string); ok {
+		var parsed any
+		if err := json.Unmarshal([]byte(s), &parsed); err == nil {
+			v = parsed
+		}
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
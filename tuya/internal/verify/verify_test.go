@@ -0,0 +1,63 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		want, got any
+		match     bool
+	}{
+		{true, true, true},
+		{true, false, false},
+		{float64(215), 215, true},
+		{"ON", "on", true},
+		{"on", "off", false},
+		{`{"h":30,"s":1000,"v":600}`, map[string]any{"v": float64(600), "s": float64(1000), "h": float64(30)}, true},
+		{float64(1), "1", false},
+		{true, nil, false},
+	}
+	for _, c := range cases {
+		if got := Match(c.want, c.got); got != c.match {
+			t.Fatalf("Match(%v, %v): expected %v", c.want, c.got, c.match)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	calls := 0
+	fetch := func() (any, bool, error) {
+		calls++
+		if calls < 3 {
+			return false, true, nil
+		}
+		return true, true, nil
+	}
+	got, err := Wait(context.Background(), time.Millisecond, fetch, true)
+	if err != nil || got != true || calls != 3 {
+		t.Fatalf("expected true after 3 reads, got %v after %d (%v)", got, calls, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, err = Wait(ctx, time.Millisecond, func() (any, bool, error) { return false, true, nil }, true)
+	if !errors.Is(err, ErrTimeout) || got != false {
+		t.Fatalf("expected timeout with last value false, got %v (%v)", got, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, err = Wait(ctx, time.Millisecond, func() (any, bool, error) { return nil, false, nil }, true)
+	if !errors.Is(err, ErrTimeout) || got != nil {
+		t.Fatalf("expected timeout with nothing reported, got %v (%v)", got, err)
+	}
+
+	boom := errors.New("boom")
+	if _, err := Wait(context.Background(), time.Millisecond, func() (any, bool, error) { return nil, false, boom }, true); !errors.Is(err, boom) {
+		t.Fatalf("expected fetch error, got %v", err)
+	}
+}